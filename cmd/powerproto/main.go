@@ -19,10 +19,16 @@ import (
 
 	"github.com/spf13/cobra"
 
+	cmdbreaking "github.com/storyicon/powerproto/cmd/powerproto/subcommands/breaking"
 	cmdbuild "github.com/storyicon/powerproto/cmd/powerproto/subcommands/build"
+	cmdcache "github.com/storyicon/powerproto/cmd/powerproto/subcommands/cache"
 	cmdenv "github.com/storyicon/powerproto/cmd/powerproto/subcommands/env"
+	cmdfmt "github.com/storyicon/powerproto/cmd/powerproto/subcommands/fmt"
 	cmdinit "github.com/storyicon/powerproto/cmd/powerproto/subcommands/init"
+	cmdlint "github.com/storyicon/powerproto/cmd/powerproto/subcommands/lint"
+	cmdoutdated "github.com/storyicon/powerproto/cmd/powerproto/subcommands/outdated"
 	cmdtidy "github.com/storyicon/powerproto/cmd/powerproto/subcommands/tidy"
+	cmdupgrade "github.com/storyicon/powerproto/cmd/powerproto/subcommands/upgrade"
 	"github.com/storyicon/powerproto/pkg/util/logger"
 )
 
@@ -55,6 +61,12 @@ func main() {
 		cmdinit.CommandInit(log),
 		cmdtidy.CommandTidy(log),
 		cmdenv.CommandEnv(log),
+		cmdbreaking.CommandBreaking(log),
+		cmdlint.CommandLint(log),
+		cmdfmt.CommandFmt(log),
+		cmdcache.CommandCache(log),
+		cmdoutdated.CommandOutdated(log),
+		cmdupgrade.CommandUpgrade(log),
 	)
 	cmdRoot.Execute()
 }
@@ -0,0 +1,101 @@
+// Copyright 2021 storyicon@foxmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package breaking
+
+import (
+	"os"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/storyicon/powerproto/pkg/bootstraps"
+	"github.com/storyicon/powerproto/pkg/consts"
+	"github.com/storyicon/powerproto/pkg/util/diagnostic"
+	"github.com/storyicon/powerproto/pkg/util/logger"
+)
+
+const description = `
+Examples:
+detect the breaking changes of the proto files in the current folder recursively, compared to the main branch:
+	powerproto breaking -r --against main .
+
+detect the breaking changes of specific proto file, compared to the last commit:
+	powerproto breaking --against HEAD~1 [proto file]
+
+output the breaking changes as github actions annotations:
+	powerproto breaking -r --against origin/main --format github-actions .
+
+The rules can be selected by the 'breaking' field of config item:
+	breaking:
+	    categories: [WIRE, SOURCE]
+	    except: [FIELD_SAME_NAME]
+`
+
+// CommandBreaking is used to detect breaking changes against a git ref
+// powerproto breaking --against main -r .
+func CommandBreaking(log logger.Logger) *cobra.Command {
+	var recursive bool
+	var debugMode bool
+	var offline bool
+	var against string
+	format := diagnostic.FormatText
+	perCommandTimeout := time.Second * 300
+	cmd := &cobra.Command{
+		Use:   "breaking [dir|proto file]",
+		Short: "detect breaking changes of proto files against a git ref",
+		Long:  strings.TrimSpace(description),
+		Args:  cobra.MaximumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			log.SetLogLevel(logger.LevelInfo)
+			ctx := cmd.Context()
+			ctx = consts.WithPerCommandTimeout(ctx, perCommandTimeout)
+			if debugMode {
+				ctx = consts.WithDebugMode(ctx)
+				log.LogWarn(nil, "running in debug mode")
+				log.SetLogLevel(logger.LevelDebug)
+			}
+			if offline {
+				ctx = consts.WithOffline(ctx)
+			}
+			if against == "" {
+				log.LogFatal(nil, "the git ref to compare against is required, please specify it by --against")
+			}
+			target := "."
+			if len(args) != 0 {
+				target = args[0]
+			}
+			diagnostics, err := bootstraps.Breaking(ctx, target, recursive, against)
+			if err != nil {
+				log.LogFatal(nil, "failed to detect breaking changes: %+v", err)
+			}
+			if err := diagnostic.Write(os.Stdout, format, diagnostics); err != nil {
+				log.LogFatal(nil, "failed to output: %s", err)
+			}
+			if len(diagnostics) != 0 {
+				log.LogFatal(nil, "%d breaking changes found against %s", len(diagnostics), against)
+			}
+			log.LogInfo(nil, "no breaking changes found against %s", against)
+		},
+	}
+	flags := cmd.PersistentFlags()
+	flags.StringVar(&against, "against", against, "the git ref to compare against, e.g. main, HEAD~1, v1.0.0")
+	flags.StringVarP(&format, "format", "f", format, "output format, one of "+strings.Join(diagnostic.Formats, ", "))
+	flags.BoolVarP(&recursive, "recursive", "r", recursive, "whether to recursively traverse all child folders")
+	flags.BoolVarP(&debugMode, "debug", "d", debugMode, "debug mode")
+	flags.BoolVar(&offline, "offline", offline, "only use the local cache and never access the network, same as setting "+consts.EnvOffline+"=1")
+	flags.DurationVarP(&perCommandTimeout, "timeout", "t", perCommandTimeout, "execution timeout for per command")
+	return cmd
+}
@@ -15,8 +15,6 @@
 package build
 
 import (
-	"os"
-	"path/filepath"
 	"strings"
 	"time"
 
@@ -24,7 +22,6 @@ import (
 
 	"github.com/storyicon/powerproto/pkg/bootstraps"
 	"github.com/storyicon/powerproto/pkg/consts"
-	"github.com/storyicon/powerproto/pkg/util"
 	"github.com/storyicon/powerproto/pkg/util/logger"
 )
 
@@ -39,8 +36,24 @@ compile the proto file in the folder, excluding sub folders:
 compile all proto files in the folder recursively, including sub folders:
 	powerproto build -r [dir] 
 
+compile multiple targets, including doublestar glob patterns:
+	powerproto build api/a api/b 'services/**/v1/*.proto'
+
+compile proto files except the excluded ones:
+	powerproto build -r --exclude '**/third_party' --exclude '**/*_internal.proto' [dir]
+
+compile proto files listed in a file, or read from stdin with '-':
+	git diff --name-only HEAD | grep '\.proto$' | powerproto build --files-from -
+
+the paths listed in the .powerprotoignore file of the folders are skipped
+when looking up proto files in them.
+
 compile proto files and execute the post actions/shells:
 	powerproto build -r -a [dir]
+
+compile proto files and add the repositories and import paths that can
+resolve the missing imports to the config:
+	powerproto build -r --fix [dir]
 `
 
 // CommandBuild is used to compile proto files
@@ -49,15 +62,19 @@ compile proto files and execute the post actions/shells:
 // powerproto build xxxxx.proto
 func CommandBuild(log logger.Logger) *cobra.Command {
 	var recursive bool
+	var excludes []string
+	var filesFrom string
 	var dryRun bool
 	var debugMode bool
+	var offline bool
 	var postScriptEnabled bool
+	var fixImports bool
 	perCommandTimeout := time.Second * 300
 	cmd := &cobra.Command{
-		Use:   "build [dir|proto file]",
+		Use:   "build [dir|proto file|pattern]...",
 		Short: "compile proto files",
 		Long:  strings.TrimSpace(description),
-		Args:  cobra.ExactArgs(1),
+		Args:  cobra.ArbitraryArgs,
 		Run: func(cmd *cobra.Command, args []string) {
 			log.SetLogLevel(logger.LevelInfo)
 			ctx := cmd.Context()
@@ -67,6 +84,9 @@ func CommandBuild(log logger.Logger) *cobra.Command {
 				log.LogWarn(nil, "running in debug mode")
 				log.SetLogLevel(logger.LevelDebug)
 			}
+			if offline {
+				ctx = consts.WithOffline(ctx)
+			}
 			if dryRun {
 				ctx = consts.WithDryRun(ctx)
 				log.LogWarn(nil, "running in dryRun mode")
@@ -74,34 +94,26 @@ func CommandBuild(log logger.Logger) *cobra.Command {
 			if !postScriptEnabled {
 				ctx = consts.WithDisableAction(ctx)
 			}
+			if fixImports {
+				ctx = consts.WithFixImports(ctx)
+			}
 
-			target, err := filepath.Abs(args[0])
-			if err != nil {
-				log.LogFatal(nil, "failed to abs target path: %s", err)
+			if filesFrom != "" {
+				items, err := bootstraps.ReadTargets(filesFrom)
+				if err != nil {
+					log.LogFatal(nil, "failed to read targets from %s: %s", filesFrom, err)
+				}
+				args = append(args, items...)
+			} else if len(args) == 0 {
+				log.LogFatal(nil, "at least one target is required, or use --files-from")
 			}
-			fileInfo, err := os.Stat(target)
+
+			log.LogInfo(nil, "search proto files...")
+			targets, err := bootstraps.StepLookUpTargets(ctx, args, recursive, excludes)
 			if err != nil {
 				log.LogFatal(map[string]interface{}{
-					"target": target,
-				}, "failed to stat target: %s", err)
-			}
-
-			var targets []string
-			if fileInfo.IsDir() {
-				log.LogInfo(nil, "search proto files...")
-				if recursive {
-					targets, err = util.GetFilesWithExtRecursively(target, ".proto")
-					if err != nil {
-						log.LogFatal(nil, "failed to walk directory: %s", err)
-					}
-				} else {
-					targets, err = util.GetFilesWithExt(target, ".proto")
-					if err != nil {
-						log.LogFatal(nil, "failed to walk directory: %s", err)
-					}
-				}
-			} else {
-				targets = append(targets, target)
+					"targets": args,
+				}, "failed to look up targets: %s", err)
 			}
 
 			if len(targets) == 0 {
@@ -122,8 +134,12 @@ func CommandBuild(log logger.Logger) *cobra.Command {
 	}
 	flags := cmd.PersistentFlags()
 	flags.BoolVarP(&recursive, "recursive", "r", recursive, "whether to recursively traverse all child folders")
+	flags.StringArrayVar(&excludes, "exclude", excludes, "doublestar pattern of the files or directories to be excluded, can be specified multiple times")
+	flags.StringVar(&filesFrom, "files-from", filesFrom, "read targets line by line from the file, or from stdin if it is '-'")
 	flags.BoolVarP(&postScriptEnabled, "postScriptEnabled", "p", postScriptEnabled, "when this flag is attached, it will allow the execution of postActions and postShell")
 	flags.BoolVarP(&debugMode, "debug", "d", debugMode, "debug mode")
+	flags.BoolVar(&offline, "offline", offline, "only use the local cache and never access the network, same as setting "+consts.EnvOffline+"=1")
+	flags.BoolVar(&fixImports, "fix", fixImports, "update the config to resolve missing imports when compile failed")
 	flags.BoolVarP(&dryRun, "dryRun", "y", dryRun, "dryRun mode")
 	flags.DurationVarP(&perCommandTimeout, "timeout", "t", perCommandTimeout, "execution timeout for per command")
 	return cmd
@@ -0,0 +1,238 @@
+// Copyright 2021 storyicon@foxmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cache
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/storyicon/powerproto/pkg/bootstraps"
+	"github.com/storyicon/powerproto/pkg/component/pluginmanager"
+	"github.com/storyicon/powerproto/pkg/util"
+	"github.com/storyicon/powerproto/pkg/util/logger"
+)
+
+const description = `
+Examples:
+list the installed protoc, plugins and repositories with their sizes:
+	powerproto cache list
+
+remove the entries that are not referenced by any config file in the directories:
+	powerproto cache prune [dir]...
+
+remove the entries that are not used for 30 days:
+	powerproto cache prune --days 30
+
+verify the installed binaries against the recorded checksums:
+	powerproto cache verify
+
+print the directory of cache:
+	powerproto cache path
+
+export the entries required by the config files in the directory into a bundle:
+	powerproto cache export --for [dir] -o bundle.tar.gz
+
+import the bundle on another machine, e.g. the one without network access:
+	powerproto cache import bundle.tar.gz
+
+export the cache prepared by 'powerproto tidy --platform darwin/arm64' for the macs with apple silicon:
+	powerproto cache export --platform darwin/arm64 --for [dir] -o bundle.tar.gz
+`
+
+// CommandCache is used to manage the cache in the program directory
+// powerproto cache list
+// powerproto cache prune .
+func CommandCache(log logger.Logger) *cobra.Command {
+	var platform string
+	cmd := &cobra.Command{
+		Use:   "cache",
+		Short: "manage the cache of protoc, plugins and repositories",
+		Long:  strings.TrimSpace(description),
+		Run: func(cmd *cobra.Command, args []string) {
+			_ = cmd.Help()
+		},
+	}
+	cmd.AddCommand(
+		commandList(log, &platform),
+		commandPrune(log, &platform),
+		commandVerify(log, &platform),
+		commandPath(log, &platform),
+		commandExport(log, &platform),
+		commandImport(log, &platform),
+	)
+	flags := cmd.PersistentFlags()
+	flags.StringVar(&platform, "platform", platform, "the platform of cache in os/arch format, e.g. darwin/arm64, defaults to the current platform")
+	return cmd
+}
+
+// loadConfig is used to load the config of plugin manager for the platform,
+// and the storage dir of the platform
+func loadConfig(log logger.Logger, platform string) (*pluginmanager.Config, string) {
+	cfg, err := pluginmanager.LoadConfig()
+	if err != nil {
+		log.LogFatal(nil, "failed to load config of plugin manager: %s", err)
+	}
+	cfg.Platform = platform
+	storageDir, err := cfg.GetStorageDir()
+	if err != nil {
+		log.LogFatal(nil, "failed to get the storage dir: %s", err)
+	}
+	return cfg, storageDir
+}
+
+func commandList(log logger.Logger, platform *string) *cobra.Command {
+	return &cobra.Command{
+		Use:   "list",
+		Short: "list the installed protoc, plugins and repositories",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			_, storageDir := loadConfig(log, *platform)
+			entries, err := pluginmanager.ListCacheEntries(storageDir)
+			if err != nil {
+				log.LogFatal(nil, "failed to list cache: %s", err)
+			}
+			writer := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+			fmt.Fprintln(writer, "KIND\tNAME\tVERSION\tSIZE\tLAST USED")
+			var total int64
+			for _, entry := range entries {
+				total += entry.Size
+				version := entry.Version + entry.Suffix
+				if entry.Incomplete {
+					version += " (incomplete)"
+				}
+				fmt.Fprintf(writer, "%s\t%s\t%s\t%s\t%s\n",
+					entry.Kind, entry.Name, version,
+					util.FormatSize(entry.Size), entry.LastUsed.Format("2006-01-02 15:04"))
+			}
+			// the include files of protoc are stored per version in the protoc entries,
+			// and the legacy shared include dir is listed until it is pruned
+			includeSize, err := util.GetDirSize(pluginmanager.PathForInclude(storageDir))
+			if err != nil && !os.IsNotExist(err) {
+				log.LogFatal(nil, "failed to stat include files: %s", err)
+			}
+			if err == nil {
+				total += includeSize
+				fmt.Fprintf(writer, "include\t-\tlegacy\t%s\t-\n", util.FormatSize(includeSize))
+			}
+			writer.Flush()
+			fmt.Printf("total: %s\r\n", util.FormatSize(total))
+		},
+	}
+}
+
+func commandPrune(log logger.Logger, platform *string) *cobra.Command {
+	var days int
+	var dryRun bool
+	cmd := &cobra.Command{
+		Use:   "prune [dir]...",
+		Short: "remove the entries not referenced by the config files in dirs, or not used for days",
+		Long:  "remove the entries not referenced by the config files in dirs, or not used for days.\nif both dirs and --days are specified, only the entries satisfying both are removed",
+		Run: func(cmd *cobra.Command, args []string) {
+			ctx := cmd.Context()
+			if len(args) == 0 && days <= 0 {
+				log.LogFatal(nil, "at least one dir or --days is required")
+			}
+			cfg, storageDir := loadConfig(log, *platform)
+			pluginManager, err := pluginmanager.NewPluginManager(cfg, log)
+			if err != nil {
+				log.LogFatal(nil, "failed to create plugin manager: %s", err)
+			}
+			if err := bootstraps.StepPruneCache(ctx, pluginManager, storageDir, &bootstraps.PruneOptions{
+				Roots:     args,
+				UnusedFor: time.Duration(days) * 24 * time.Hour,
+				DryRun:    dryRun,
+			}); err != nil {
+				log.LogFatal(nil, "failed to prune cache: %s", err)
+			}
+		},
+	}
+	flags := cmd.PersistentFlags()
+	flags.IntVar(&days, "days", days, "remove the entries that are not used for the days")
+	flags.BoolVarP(&dryRun, "dryRun", "y", dryRun, "only print the entries to be removed")
+	return cmd
+}
+
+func commandVerify(log logger.Logger, platform *string) *cobra.Command {
+	return &cobra.Command{
+		Use:   "verify",
+		Short: "verify the installed binaries against the recorded checksums",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			_, storageDir := loadConfig(log, *platform)
+			if err := bootstraps.StepVerifyCache(cmd.Context(), storageDir); err != nil {
+				log.LogFatal(nil, "failed to verify cache: %s", err)
+			}
+		},
+	}
+}
+
+func commandPath(log logger.Logger, platform *string) *cobra.Command {
+	return &cobra.Command{
+		Use:   "path",
+		Short: "print the directory of cache",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			_, storageDir := loadConfig(log, *platform)
+			fmt.Println(storageDir)
+		},
+	}
+}
+
+func commandExport(log logger.Logger, platform *string) *cobra.Command {
+	var roots []string
+	var output string
+	cmd := &cobra.Command{
+		Use:   "export --for [dir] -o [bundle file]",
+		Short: "export the protoc, plugins and repositories required by the config files into a bundle",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			ctx := cmd.Context()
+			if len(roots) == 0 || output == "" {
+				log.LogFatal(nil, "both --for and -o are required")
+			}
+			cfg, storageDir := loadConfig(log, *platform)
+			pluginManager, err := pluginmanager.NewPluginManager(cfg, log)
+			if err != nil {
+				log.LogFatal(nil, "failed to create plugin manager: %s", err)
+			}
+			if err := bootstraps.StepExportCache(ctx, pluginManager, storageDir, roots, output); err != nil {
+				log.LogFatal(nil, "failed to export cache: %s", err)
+			}
+		},
+	}
+	flags := cmd.PersistentFlags()
+	flags.StringArrayVar(&roots, "for", roots, "the directory in which the config files are searched recursively, can be specified multiple times")
+	flags.StringVarP(&output, "output", "o", output, "the path of bundle file")
+	return cmd
+}
+
+func commandImport(log logger.Logger, platform *string) *cobra.Command {
+	return &cobra.Command{
+		Use:   "import [bundle file]",
+		Short: "verify the bundle exported by 'powerproto cache export' and install the entries in it",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			_, storageDir := loadConfig(log, *platform)
+			if err := bootstraps.StepImportCache(cmd.Context(), storageDir, args[0]); err != nil {
+				log.LogFatal(nil, "failed to import cache: %s", err)
+			}
+		},
+	}
+}
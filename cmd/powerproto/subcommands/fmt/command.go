@@ -0,0 +1,117 @@
+// Copyright 2021 storyicon@foxmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fmt
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/storyicon/powerproto/pkg/bootstraps"
+	"github.com/storyicon/powerproto/pkg/util/diff"
+	"github.com/storyicon/powerproto/pkg/util/logger"
+	"github.com/storyicon/powerproto/pkg/util/protofmt"
+)
+
+const description = `
+Examples:
+print the formatted content of specific proto file
+	powerproto fmt [proto file]
+
+rewrite all proto files in the folder recursively, including sub folders:
+	powerproto fmt -w -r [dir]
+
+print the diff of proto files that are not formatted:
+	powerproto fmt --diff -r [dir]
+
+check whether proto files are formatted, exit with non-zero code if not:
+	powerproto fmt --check -r [dir]
+`
+
+// CommandFmt is used to format proto files
+// powerproto fmt -w -r .
+// powerproto fmt --check xxxxx.proto
+func CommandFmt(log logger.Logger) *cobra.Command {
+	var recursive bool
+	var excludes []string
+	var write bool
+	var showDiff bool
+	var check bool
+	cmd := &cobra.Command{
+		Use:   "fmt [dir|proto file|pattern]...",
+		Short: "format proto files",
+		Long:  strings.TrimSpace(description),
+		Args:  cobra.MinimumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			ctx := cmd.Context()
+			targets, err := bootstraps.StepLookUpTargets(ctx, args, recursive, excludes)
+			if err != nil {
+				log.LogFatal(map[string]interface{}{
+					"targets": args,
+				}, "failed to look up targets: %s", err)
+			}
+			var unformatted []string
+			for _, target := range targets {
+				data, err := ioutil.ReadFile(target)
+				if err != nil {
+					log.LogFatal(nil, "failed to read %s: %s", target, err)
+				}
+				formatted, err := protofmt.Format(data)
+				if err != nil {
+					log.LogFatal(nil, "failed to format %s: %s", target, err)
+				}
+				if !write && !showDiff && !check {
+					os.Stdout.Write(formatted)
+					continue
+				}
+				if bytes.Equal(data, formatted) {
+					continue
+				}
+				unformatted = append(unformatted, target)
+				if showDiff {
+					os.Stdout.Write(diff.Unified(target+".orig", target, data, formatted))
+				}
+				if write {
+					info, err := os.Stat(target)
+					if err != nil {
+						log.LogFatal(nil, "failed to stat %s: %s", target, err)
+					}
+					if err := ioutil.WriteFile(target, formatted, info.Mode()); err != nil {
+						log.LogFatal(nil, "failed to write %s: %s", target, err)
+					}
+					log.LogInfo(nil, "formatted %s", target)
+				}
+			}
+			if check && len(unformatted) != 0 {
+				if !showDiff && !write {
+					for _, target := range unformatted {
+						log.LogError(nil, "not formatted: %s", target)
+					}
+				}
+				log.LogFatal(nil, "%d files are not formatted", len(unformatted))
+			}
+		},
+	}
+	flags := cmd.PersistentFlags()
+	flags.BoolVarP(&recursive, "recursive", "r", recursive, "whether to recursively traverse all child folders")
+	flags.StringArrayVar(&excludes, "exclude", excludes, "doublestar pattern of the files or directories to be excluded, can be specified multiple times")
+	flags.BoolVarP(&write, "write", "w", write, "write the result to the source file instead of stdout")
+	flags.BoolVar(&showDiff, "diff", showDiff, "display the diff instead of rewriting files")
+	flags.BoolVar(&check, "check", check, "exit with non-zero code if any file is not formatted")
+	return cmd
+}
@@ -57,7 +57,7 @@ func GetUserPreference() (*UserPreference, error) {
 	}
 	if len(preference.Repositories) == 0 {
 		preference.Repositories = []string{
-			GetRepositoryGoogleAPIs().GetOptionsValue(),
+			configs.GetRepositoryGoogleAPIs().GetOptionsValue(),
 		}
 	}
 	return &preference, err
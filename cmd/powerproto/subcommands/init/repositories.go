@@ -15,60 +15,12 @@
 package build
 
 import (
-	"fmt"
-	"strings"
+	"github.com/storyicon/powerproto/pkg/configs"
 )
 
-// Repository defines the plugin options
-type Repository struct {
-	OptionsValue string
-
-	Name        string
-	Pkg         string
-	ImportPaths []string
-}
-
-// OptionsValue is used to return the options value
-func (repo *Repository) GetOptionsValue() string {
-	if repo.OptionsValue != "" {
-		return repo.OptionsValue
-	}
-	return fmt.Sprintf("%s: %s", strings.ToLower(repo.Name), repo.Pkg)
-}
-
-// GetWellKnownRepositories is used to get well known plugins
-func GetWellKnownRepositories() []*Repository {
-	return []*Repository{
-		GetRepositoryGoogleAPIs(),
-		GetRepositoryGoGoProtobuf(),
-	}
-}
-
-// GetRepositoryGoGoProtobuf is used to get gogo protobuf repository
-func GetRepositoryGoGoProtobuf() *Repository {
-	return &Repository{
-		Name: "GOGO_PROTOBUF",
-		Pkg:  "https://github.com/gogo/protobuf@226206f39bd7276e88ec684ea0028c18ec2c91ae",
-		ImportPaths: []string{
-			"$GOGO_PROTOBUF",
-		},
-	}
-}
-
-// GetRepositoryGoogleAPIs is used to get google apis repository
-func GetRepositoryGoogleAPIs() *Repository {
-	return &Repository{
-		Name: "GOOGLE_APIS",
-		Pkg:  "https://github.com/googleapis/googleapis@75e9812478607db997376ccea247dd6928f70f45",
-		ImportPaths: []string{
-			"$GOOGLE_APIS/github.com/googleapis/googleapis",
-		},
-	}
-}
-
 // GetRepositoryFromOptionsValue is used to get plugin by option value
-func GetRepositoryFromOptionsValue(val string) (*Repository, bool) {
-	repositories := GetWellKnownRepositories()
+func GetRepositoryFromOptionsValue(val string) (*configs.Repository, bool) {
+	repositories := configs.GetWellKnownRepositories()
 	for _, repo := range repositories {
 		if repo.GetOptionsValue() == val {
 			return repo, true
@@ -79,7 +31,7 @@ func GetRepositoryFromOptionsValue(val string) (*Repository, bool) {
 
 // GetWellKnownRepositoriesOptionValues is used to get option values of well known plugins
 func GetWellKnownRepositoriesOptionValues() []string {
-	repos := GetWellKnownRepositories()
+	repos := configs.GetWellKnownRepositories()
 	packages := make([]string, 0, len(repos))
 	for _, repo := range repos {
 		packages = append(packages, repo.GetOptionsValue())
@@ -0,0 +1,109 @@
+// Copyright 2021 storyicon@foxmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package lint
+
+import (
+	"os"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/storyicon/powerproto/pkg/bootstraps"
+	"github.com/storyicon/powerproto/pkg/consts"
+	"github.com/storyicon/powerproto/pkg/util/diagnostic"
+	"github.com/storyicon/powerproto/pkg/util/logger"
+)
+
+const description = `
+Examples:
+lint specific proto file
+	powerproto lint [proto file]
+
+lint all proto files in the folder recursively, including sub folders:
+	powerproto lint -r [dir]
+
+The rules can be selected by the 'lint' field of config item:
+	lint:
+	    use: [FIELD_LOWER_SNAKE_CASE, IMPORT_NO_UNUSED]
+	    except: [PACKAGE_DIRECTORY_MATCH]
+
+The rules can also be suppressed by comments, which take effect on the
+commented element and its children, or on the whole file when attached to
+the syntax or package statement:
+	// powerproto:lint:ignore FIELD_LOWER_SNAKE_CASE
+`
+
+// CommandLint is used to lint proto files
+// powerproto lint -r .
+// powerproto lint xxxxx.proto
+func CommandLint(log logger.Logger) *cobra.Command {
+	var recursive bool
+	var excludes []string
+	var debugMode bool
+	var offline bool
+	format := diagnostic.FormatText
+	perCommandTimeout := time.Second * 300
+	cmd := &cobra.Command{
+		Use:   "lint [dir|proto file|pattern]...",
+		Short: "lint proto files",
+		Long:  strings.TrimSpace(description),
+		Args:  cobra.MinimumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			log.SetLogLevel(logger.LevelInfo)
+			ctx := cmd.Context()
+			ctx = consts.WithPerCommandTimeout(ctx, perCommandTimeout)
+			if debugMode {
+				ctx = consts.WithDebugMode(ctx)
+				log.LogWarn(nil, "running in debug mode")
+				log.SetLogLevel(logger.LevelDebug)
+			}
+			if offline {
+				ctx = consts.WithOffline(ctx)
+			}
+
+			log.LogInfo(nil, "search proto files...")
+			targets, err := bootstraps.StepLookUpTargets(ctx, args, recursive, excludes)
+			if err != nil {
+				log.LogFatal(map[string]interface{}{
+					"targets": args,
+				}, "failed to look up targets: %s", err)
+			}
+			if len(targets) == 0 {
+				log.LogWarn(nil, "no file to lint")
+				return
+			}
+			diagnostics, err := bootstraps.Lint(ctx, targets)
+			if err != nil {
+				log.LogFatal(nil, "failed to lint: %+v", err)
+			}
+			if err := diagnostic.Write(os.Stdout, format, diagnostics); err != nil {
+				log.LogFatal(nil, "failed to output: %s", err)
+			}
+			if len(diagnostics) != 0 {
+				log.LogFatal(nil, "%d problems found", len(diagnostics))
+			}
+			log.LogInfo(nil, "no problems found :)")
+		},
+	}
+	flags := cmd.PersistentFlags()
+	flags.StringVarP(&format, "format", "f", format, "output format, one of "+strings.Join(diagnostic.Formats, ", "))
+	flags.BoolVarP(&recursive, "recursive", "r", recursive, "whether to recursively traverse all child folders")
+	flags.StringArrayVar(&excludes, "exclude", excludes, "doublestar pattern of the files or directories to be excluded, can be specified multiple times")
+	flags.BoolVarP(&debugMode, "debug", "d", debugMode, "debug mode")
+	flags.BoolVar(&offline, "offline", offline, "only use the local cache and never access the network, same as setting "+consts.EnvOffline+"=1")
+	flags.DurationVarP(&perCommandTimeout, "timeout", "t", perCommandTimeout, "execution timeout for per command")
+	return cmd
+}
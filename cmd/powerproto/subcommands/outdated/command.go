@@ -0,0 +1,140 @@
+// Copyright 2021 storyicon@foxmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package outdated
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	jsoniter "github.com/json-iterator/go"
+	"github.com/spf13/cobra"
+
+	"github.com/storyicon/powerproto/pkg/bootstraps"
+	"github.com/storyicon/powerproto/pkg/component/pluginmanager"
+	"github.com/storyicon/powerproto/pkg/consts"
+	"github.com/storyicon/powerproto/pkg/util/logger"
+	"github.com/storyicon/powerproto/pkg/util/progressbar"
+)
+
+// defines the output formats of outdated
+const (
+	formatTable = "table"
+	formatJSON  = "json"
+)
+
+const description = `
+List the current and newest versions of protoc, plugins and repositories
+in the config files under the directories, which default to the current directory.
+
+WANTED is the newest version satisfying the constraint recorded in config file,
+e.g. ~1.27, branch:master or tag:v1.2.0, and it is what 'powerproto upgrade' bumps to.
+LATEST is the newest stable version regardless of the constraint.
+
+Examples:
+	powerproto outdated
+	powerproto outdated ./apis --format json
+`
+
+// CommandOutdated is used to list the outdated protoc, plugins and repositories
+// powerproto outdated .
+func CommandOutdated(log logger.Logger) *cobra.Command {
+	var debugMode bool
+	var offline bool
+	format := formatTable
+	perCommandTimeout := time.Second * 300
+	cmd := &cobra.Command{
+		Use:   "outdated [dir]...",
+		Short: "list the current and newest versions of protoc, plugins and repositories in config files",
+		Long:  strings.TrimSpace(description),
+		Run: func(cmd *cobra.Command, args []string) {
+			ctx := cmd.Context()
+			ctx = consts.WithPerCommandTimeout(ctx, perCommandTimeout)
+			log.SetLogLevel(logger.LevelInfo)
+			if debugMode {
+				log.SetLogLevel(logger.LevelDebug)
+				ctx = consts.WithDebugMode(ctx)
+				log.LogWarn(nil, "running in debug mode")
+			}
+			if offline {
+				ctx = consts.WithOffline(ctx)
+			}
+			if format != formatTable && format != formatJSON {
+				log.LogFatal(nil, "unsupported format %s, should be %s or %s", format, formatTable, formatJSON)
+			}
+			if len(args) == 0 {
+				args = []string{"."}
+			}
+			pluginConfig, err := pluginmanager.LoadConfig()
+			if err != nil {
+				log.LogFatal(nil, "failed to load config of plugin manager: %s", err)
+			}
+			pluginManager, err := pluginmanager.NewPluginManager(pluginConfig, log)
+			if err != nil {
+				log.LogFatal(nil, "failed to create plugin manager: %s", err)
+			}
+			entries, err := bootstraps.StepLookUpOutdated(args)
+			if err != nil {
+				log.LogFatal(nil, "failed to look up configs: %s", err)
+			}
+			// the stdout is kept clean for the json output
+			progress := progressbar.GetSilentProgressBar()
+			if format == formatTable {
+				progress = progressbar.GetProgressBar(ctx, len(entries))
+			}
+			if err := bootstraps.StepResolveOutdated(ctx, pluginManager, progress, entries); err != nil {
+				log.LogFatal(nil, "failed to query versions: %s", err)
+			}
+			progress.Wait()
+			if format == formatJSON {
+				data, err := jsoniter.MarshalIndent(entries, "", "  ")
+				if err != nil {
+					log.LogFatal(nil, "failed to output: %s", err)
+				}
+				fmt.Println(string(data))
+				return
+			}
+			writer := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+			fmt.Fprintln(writer, "CONFIG\tKIND\tNAME\tCONSTRAINT\tCURRENT\tWANTED\tLATEST")
+			for _, entry := range entries {
+				fmt.Fprintf(writer, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+					entry.Path, entry.Kind, entry.Name, orDash(entry.Constraint),
+					entry.Current, orDash(entry.Wanted), orDash(entry.Latest))
+			}
+			writer.Flush()
+			for _, entry := range entries {
+				if entry.Error != "" {
+					log.LogWarn(nil, "failed to query versions of %s in %s: %s", entry.Name, entry.Path, entry.Error)
+				}
+			}
+		},
+	}
+	flags := cmd.PersistentFlags()
+	flags.StringVarP(&format, "format", "f", format, "output format, one of "+formatTable+", "+formatJSON)
+	flags.BoolVarP(&debugMode, "debug", "d", debugMode, "debug mode")
+	flags.BoolVar(&offline, "offline", offline, "only use the local cache and never access the network, same as setting "+consts.EnvOffline+"=1")
+	flags.DurationVarP(&perCommandTimeout, "timeout", "t", perCommandTimeout, "execution timeout for per command")
+	return cmd
+}
+
+// orDash returns - for the empty value in table
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
@@ -33,6 +33,7 @@ import (
 
 func tidy(ctx context.Context,
 	pluginManager pluginmanager.PluginManager,
+	log logger.Logger,
 	configFilePath string) error {
 	progress := progressbar.GetProgressBar(ctx, 1)
 	progress.SetPrefix("tidy config")
@@ -42,20 +43,17 @@ func tidy(ctx context.Context,
 	}
 	progress.Incr()
 	progress.Wait()
+	// the retractions can only be queried from the network
+	if !consts.IsOffline(ctx) {
+		if err := bootstraps.StepCheckRetractedPlugins(ctx, pluginManager, log, configFilePath); err != nil {
+			return err
+		}
+	}
 	configItems, err := configs.LoadConfigItems(configFilePath)
 	if err != nil {
 		return err
 	}
-	if err := bootstraps.StepInstallProtoc(ctx, pluginManager, configItems); err != nil {
-		return err
-	}
-	if err := bootstraps.StepInstallRepositories(ctx, pluginManager, configItems); err != nil {
-		return err
-	}
-	if err := bootstraps.StepInstallPlugins(ctx, pluginManager, configItems); err != nil {
-		return err
-	}
-	return nil
+	return bootstraps.StepInstallDependencies(ctx, pluginManager, configItems)
 }
 
 // CommandTidy is used to clean the config file
@@ -63,6 +61,8 @@ func tidy(ctx context.Context,
 // You can also explicitly specify the configuration file to clean up
 func CommandTidy(log logger.Logger) *cobra.Command {
 	var debugMode bool
+	var offline bool
+	var platform string
 	perCommandTimeout := time.Second * 300
 	cmd := &cobra.Command{
 		Use:   "tidy [config file]",
@@ -76,6 +76,9 @@ func CommandTidy(log logger.Logger) *cobra.Command {
 				ctx = consts.WithDebugMode(ctx)
 				log.LogWarn(nil, "running in debug mode")
 			}
+			if offline {
+				ctx = consts.WithOffline(ctx)
+			}
 
 			var targets []string
 			if len(args) != 0 {
@@ -90,7 +93,12 @@ func CommandTidy(log logger.Logger) *cobra.Command {
 				}
 				targets = configs.ListConfigPaths(dir)
 			}
-			pluginManager, err := pluginmanager.NewPluginManager(pluginmanager.NewConfig(), log)
+			pluginConfig, err := pluginmanager.LoadConfig()
+			if err != nil {
+				log.LogFatal(nil, "failed to load config of plugin manager: %s", err)
+			}
+			pluginConfig.Platform = platform
+			pluginManager, err := pluginmanager.NewPluginManager(pluginConfig, log)
 			if err != nil {
 				log.LogFatal(nil, "failed to create plugin manager: %s", err)
 			}
@@ -107,7 +115,7 @@ func CommandTidy(log logger.Logger) *cobra.Command {
 					continue
 				}
 				log.LogInfo(nil, "tidy %s", path)
-				if err := tidy(ctx, pluginManager, path); err != nil {
+				if err := tidy(ctx, pluginManager, log, path); err != nil {
 					log.LogFatal(map[string]interface{}{
 						"path": path,
 						"err":  err,
@@ -124,6 +132,9 @@ func CommandTidy(log logger.Logger) *cobra.Command {
 	}
 	flags := cmd.PersistentFlags()
 	flags.BoolVarP(&debugMode, "debug", "d", debugMode, "debug mode")
+	flags.BoolVar(&offline, "offline", offline, "only use the local cache and never access the network, same as setting "+consts.EnvOffline+"=1")
 	flags.DurationVarP(&perCommandTimeout, "timeout", "t", perCommandTimeout, "execution timeout for per command")
+	flags.StringVar(&platform, "platform", platform, "install protoc and plugins for the platform in os/arch format, e.g. darwin/arm64 or linux/amd64/musl, "+
+		"they are installed into the cache of the platform, which can be exported by 'powerproto cache export --platform'")
 	return cmd
 }
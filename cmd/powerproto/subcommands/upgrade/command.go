@@ -0,0 +1,196 @@
+// Copyright 2021 storyicon@foxmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package upgrade
+
+import (
+	"strings"
+	"time"
+
+	"github.com/AlecAivazis/survey/v2"
+	"github.com/spf13/cobra"
+
+	"github.com/storyicon/powerproto/pkg/bootstraps"
+	"github.com/storyicon/powerproto/pkg/component/pluginmanager"
+	"github.com/storyicon/powerproto/pkg/consts"
+	"github.com/storyicon/powerproto/pkg/util/logger"
+	"github.com/storyicon/powerproto/pkg/util/progressbar"
+)
+
+const description = `
+Upgrade protoc, plugins and repositories in the config files under the directories
+to the newest versions satisfying their constraints, i.e. the WANTED of 'powerproto outdated'.
+The directories default to the current directory.
+
+The entries to upgrade are selected interactively, unless --all or --only is specified.
+--only accepts the name in plugins or repositories, protoc, or the go package or url of them.
+
+Examples:
+	powerproto upgrade
+	powerproto upgrade --all
+	powerproto upgrade ./apis --only protoc --only protoc-gen-go
+`
+
+// CommandUpgrade is used to upgrade the protoc, plugins and repositories in config files
+// powerproto upgrade --all
+func CommandUpgrade(log logger.Logger) *cobra.Command {
+	var debugMode bool
+	var offline bool
+	var all bool
+	var only []string
+	perCommandTimeout := time.Second * 300
+	cmd := &cobra.Command{
+		Use:   "upgrade [dir]...",
+		Short: "upgrade protoc, plugins and repositories in config files to the newest versions satisfying their constraints",
+		Long:  strings.TrimSpace(description),
+		Run: func(cmd *cobra.Command, args []string) {
+			ctx := cmd.Context()
+			ctx = consts.WithPerCommandTimeout(ctx, perCommandTimeout)
+			log.SetLogLevel(logger.LevelInfo)
+			if debugMode {
+				log.SetLogLevel(logger.LevelDebug)
+				ctx = consts.WithDebugMode(ctx)
+				log.LogWarn(nil, "running in debug mode")
+			}
+			if offline {
+				ctx = consts.WithOffline(ctx)
+			}
+			if all && len(only) != 0 {
+				log.LogFatal(nil, "--all and --only can not be specified at the same time")
+			}
+			if len(args) == 0 {
+				args = []string{"."}
+			}
+			pluginConfig, err := pluginmanager.LoadConfig()
+			if err != nil {
+				log.LogFatal(nil, "failed to load config of plugin manager: %s", err)
+			}
+			pluginManager, err := pluginmanager.NewPluginManager(pluginConfig, log)
+			if err != nil {
+				log.LogFatal(nil, "failed to create plugin manager: %s", err)
+			}
+			entries, err := bootstraps.StepLookUpOutdated(args)
+			if err != nil {
+				log.LogFatal(nil, "failed to look up configs: %s", err)
+			}
+			progress := progressbar.GetProgressBar(ctx, len(entries))
+			if err := bootstraps.StepResolveOutdated(ctx, pluginManager, progress, entries); err != nil {
+				log.LogFatal(nil, "failed to query versions: %s", err)
+			}
+			progress.Wait()
+			var outdated []*bootstraps.OutdatedEntry
+			for _, entry := range entries {
+				if entry.Error != "" {
+					log.LogWarn(nil, "failed to query versions of %s in %s: %s", entry.Name, entry.Path, entry.Error)
+					continue
+				}
+				if entry.IsOutdated() {
+					outdated = append(outdated, entry)
+				}
+			}
+
+			var selected []*bootstraps.OutdatedEntry
+			switch {
+			case all:
+				selected = outdated
+			case len(only) != 0:
+				selected = getOnlySelection(log, entries, outdated, only)
+			case len(outdated) != 0:
+				selected, err = getUserSelection(outdated)
+				if err != nil {
+					log.LogFatal(nil, "failed to select: %s", err)
+				}
+			}
+			if len(outdated) == 0 {
+				log.LogInfo(nil, "nothing to upgrade, everything is up to date :)")
+				return
+			}
+			if len(selected) == 0 {
+				log.LogInfo(nil, "nothing to upgrade")
+				return
+			}
+			if err := bootstraps.StepUpgrade(ctx, selected); err != nil {
+				log.LogFatal(nil, "failed to upgrade: %s", err)
+			}
+			log.LogInfo(nil, "these following entries were upgraded:")
+			for _, entry := range selected {
+				log.LogInfo(nil, "	%s", entry)
+			}
+			log.LogInfo(nil, "\r\nsucceeded, you can use `powerproto tidy` to install them")
+		},
+	}
+	flags := cmd.PersistentFlags()
+	flags.BoolVar(&all, "all", all, "upgrade all the outdated entries without asking")
+	flags.StringArrayVar(&only, "only", only, "only upgrade the entries of the name, go package or url, can be specified multiple times")
+	flags.BoolVarP(&debugMode, "debug", "d", debugMode, "debug mode")
+	flags.BoolVar(&offline, "offline", offline, "only use the local cache and never access the network, same as setting "+consts.EnvOffline+"=1")
+	flags.DurationVarP(&perCommandTimeout, "timeout", "t", perCommandTimeout, "execution timeout for per command")
+	return cmd
+}
+
+// getOnlySelection is used to select the outdated entries matching the names of --only,
+// the names matching no outdated entry are warned
+func getOnlySelection(log logger.Logger,
+	entries []*bootstraps.OutdatedEntry,
+	outdated []*bootstraps.OutdatedEntry,
+	only []string,
+) []*bootstraps.OutdatedEntry {
+	var selected []*bootstraps.OutdatedEntry
+	for _, entry := range outdated {
+		for _, name := range only {
+			if entry.Match(name) {
+				selected = append(selected, entry)
+				break
+			}
+		}
+	}
+	for _, name := range only {
+		var found, upgradable bool
+		for _, entry := range entries {
+			if entry.Match(name) {
+				found = true
+				upgradable = upgradable || entry.IsOutdated()
+			}
+		}
+		switch {
+		case !found:
+			log.LogWarn(nil, "%s does not match any protoc, plugin or repository", name)
+		case !upgradable:
+			log.LogWarn(nil, "%s is up to date or its versions can not be queried", name)
+		}
+	}
+	return selected
+}
+
+// getUserSelection is used to ask the user to select the entries to upgrade
+func getUserSelection(entries []*bootstraps.OutdatedEntry) ([]*bootstraps.OutdatedEntry, error) {
+	options := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		options = append(options, entry.String())
+	}
+	// the indexes are answered since the options may be the same
+	var answers []int
+	err := survey.AskOne(&survey.MultiSelect{
+		Message: "select the entries to upgrade",
+		Options: options,
+	}, &answers)
+	if err != nil {
+		return nil, err
+	}
+	selected := make([]*bootstraps.OutdatedEntry, 0, len(answers))
+	for _, answer := range answers {
+		selected = append(selected, entries[answer])
+	}
+	return selected, nil
+}
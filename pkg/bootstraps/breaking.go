@@ -0,0 +1,194 @@
+// Copyright 2021 storyicon@foxmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bootstraps
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/storyicon/powerproto/pkg/component/breakingmanager"
+	"github.com/storyicon/powerproto/pkg/component/configmanager"
+	"github.com/storyicon/powerproto/pkg/configs"
+	"github.com/storyicon/powerproto/pkg/consts"
+	"github.com/storyicon/powerproto/pkg/util"
+	"github.com/storyicon/powerproto/pkg/util/command"
+	"github.com/storyicon/powerproto/pkg/util/descriptor"
+	"github.com/storyicon/powerproto/pkg/util/diagnostic"
+	"github.com/storyicon/powerproto/pkg/util/logger"
+)
+
+// StepCreateGitWorktree is used to check out the ref of the git repository where dir is located
+// into a temporary worktree. It returns the root of the repository and the root of the worktree,
+// cleanup should be called to remove the worktree
+func StepCreateGitWorktree(ctx context.Context,
+	log logger.Logger,
+	dir string, ref string) (root string, worktree string, cleanup func(), err error) {
+	ctx = consts.WithIgnoreDryRun(ctx)
+	data, err := command.Execute(ctx, log, dir, "git", []string{
+		"rev-parse", "--show-toplevel",
+	}, nil)
+	if err != nil {
+		return "", "", nil, errors.Wrapf(err, "%s is not in a git repository", dir)
+	}
+	root, err = filepath.EvalSymlinks(strings.TrimSpace(string(data)))
+	if err != nil {
+		return "", "", nil, err
+	}
+	worktree, err = os.MkdirTemp("", "powerproto-worktree-")
+	if err != nil {
+		return "", "", nil, err
+	}
+	_, err = command.Execute(ctx, log, root, "git", []string{
+		"worktree", "add", "--detach", worktree, ref,
+	}, nil)
+	if err != nil {
+		_ = os.RemoveAll(worktree)
+		return "", "", nil, errors.Wrapf(err, "failed to check out %s", ref)
+	}
+	cleanup = func() {
+		_, err := command.Execute(ctx, log, root, "git", []string{
+			"worktree", "remove", "--force", worktree,
+		}, nil)
+		if err != nil {
+			log.LogWarn(nil, "failed to remove worktree %s: %s", worktree, err)
+		}
+		_ = os.RemoveAll(worktree)
+	}
+	return root, worktree, cleanup, nil
+}
+
+// Breaking is used to detect the breaking changes of the proto files in target
+// against the specified git ref
+func Breaking(ctx context.Context, target string, recursive bool, against string) ([]*diagnostic.Diagnostic, error) {
+	log := logger.NewDefault("breaking")
+	log.SetLogLevel(logger.LevelInfo)
+	if consts.IsDebugMode(ctx) {
+		log.SetLogLevel(logger.LevelDebug)
+	}
+
+	target, err := filepath.Abs(target)
+	if err != nil {
+		return nil, err
+	}
+	target, err = filepath.EvalSymlinks(target)
+	if err != nil {
+		return nil, err
+	}
+	currentTargets, err := StepLookUpTargets(ctx, []string{target}, recursive, nil)
+	if err != nil {
+		return nil, err
+	}
+	dir := target
+	if ok, _ := util.IsDirExists(target); !ok {
+		dir = filepath.Dir(target)
+	}
+	root, worktree, cleanup, err := StepCreateGitWorktree(ctx, log, dir, against)
+	if err != nil {
+		return nil, err
+	}
+	defer cleanup()
+
+	rel, err := filepath.Rel(root, target)
+	if err != nil {
+		return nil, err
+	}
+	var previousTargets []string
+	if _, err := os.Stat(filepath.Join(worktree, rel)); err == nil {
+		previousTargets, err = StepLookUpTargets(ctx, []string{filepath.Join(worktree, rel)}, recursive, nil)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	configManager, err := configmanager.NewConfigManager(log)
+	if err != nil {
+		return nil, err
+	}
+	breakingManager, err := breakingmanager.NewBreakingManager(log)
+	if err != nil {
+		return nil, err
+	}
+	current, err := buildDescriptors(ctx, log, configManager, currentTargets)
+	if err != nil {
+		return nil, err
+	}
+	log.LogInfo(nil, "build descriptors of %s", against)
+	previous, err := buildDescriptors(ctx, log, configManager, previousTargets)
+	if err != nil {
+		return nil, err
+	}
+
+	type group struct {
+		config   configs.ConfigItem
+		previous []*breakingmanager.File
+		current  []*breakingmanager.File
+	}
+	groups := map[string]*group{}
+	var groupIDs []string
+	getGroup := func(path string) (*group, error) {
+		cfg, err := configManager.GetConfig(ctx, path)
+		if err != nil {
+			return nil, err
+		}
+		g, ok := groups[cfg.ID()]
+		if !ok {
+			g = &group{config: cfg}
+			groups[cfg.ID()] = g
+			groupIDs = append(groupIDs, cfg.ID())
+		}
+		return g, nil
+	}
+	for _, path := range currentTargets {
+		g, err := getGroup(path)
+		if err != nil {
+			return nil, err
+		}
+		g.current = append(g.current, &breakingmanager.File{
+			Path:       path,
+			Descriptor: descriptor.GetCompiledFile(current[path]),
+		})
+	}
+	for _, path := range previousTargets {
+		rel, err := filepath.Rel(worktree, path)
+		if err != nil {
+			return nil, err
+		}
+		mapped := filepath.Join(root, rel)
+		g, err := getGroup(mapped)
+		if err != nil {
+			return nil, err
+		}
+		g.previous = append(g.previous, &breakingmanager.File{
+			Path:       mapped,
+			Descriptor: descriptor.GetCompiledFile(previous[path]),
+		})
+	}
+
+	var diagnostics []*diagnostic.Diagnostic
+	for _, id := range groupIDs {
+		g := groups[id]
+		data, err := breakingManager.Check(ctx, g.config, g.previous, g.current)
+		if err != nil {
+			return nil, err
+		}
+		diagnostics = append(diagnostics, data...)
+	}
+	diagnostic.Sort(diagnostics)
+	return diagnostics, nil
+}
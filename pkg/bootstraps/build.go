@@ -26,7 +26,6 @@ import (
 	"github.com/storyicon/powerproto/pkg/component/pluginmanager"
 	"github.com/storyicon/powerproto/pkg/configs"
 	"github.com/storyicon/powerproto/pkg/consts"
-	"github.com/storyicon/powerproto/pkg/util"
 	"github.com/storyicon/powerproto/pkg/util/concurrent"
 	"github.com/storyicon/powerproto/pkg/util/logger"
 	"github.com/storyicon/powerproto/pkg/util/progressbar"
@@ -67,168 +66,6 @@ func StepLookUpConfigs(
 	return configItems, nil
 }
 
-// StepInstallRepositories is used to install repositories
-func StepInstallRepositories(ctx context.Context,
-	pluginManager pluginmanager.PluginManager,
-	configItems []configs.ConfigItem) error {
-	deduplicate := map[string]struct{}{}
-	for _, config := range configItems {
-		for _, pkg := range config.Config().Repositories {
-			deduplicate[pkg] = struct{}{}
-		}
-	}
-	if len(deduplicate) == 0 {
-		return nil
-	}
-	progress := progressbar.GetProgressBar(ctx, len(deduplicate))
-	progress.SetPrefix("Install repositories")
-
-	repoMap := map[string]struct{}{}
-	for pkg := range deduplicate {
-		path, version, ok := util.SplitGoPackageVersion(pkg)
-		if !ok {
-			return errors.Errorf("invalid format: %s, should in path@version format", pkg)
-		}
-		if version == "latest" {
-			progress.SetSuffix("query latest version of %s", path)
-			latestVersion, err := pluginManager.GetGitRepoLatestVersion(ctx, path)
-			if err != nil {
-				return errors.Wrapf(err, "failed to query latest version of %s", path)
-			}
-			version = latestVersion
-			pkg = util.JoinGoPackageVersion(path, version)
-		}
-		progress.SetSuffix("check cache of %s", pkg)
-		exists, _, err := pluginManager.IsGitRepoInstalled(ctx, path, version)
-		if err != nil {
-			return err
-		}
-		if exists {
-			progress.SetSuffix("the %s version of %s is already cached", version, path)
-		} else {
-			progress.SetSuffix("install %s version of %s", version, path)
-			_, err = pluginManager.InstallGitRepo(ctx, path, version)
-			if err != nil {
-				return err
-			}
-			progress.SetSuffix("the %s version of %s is installed", version, path)
-		}
-		repoMap[pkg] = struct{}{}
-		progress.Incr()
-	}
-	progress.SetSuffix("all repositories have been installed")
-	progress.Wait()
-	fmt.Println("the following versions of googleapis will be used:")
-	for pkg := range repoMap {
-		fmt.Printf("	%s\r\n", pkg)
-	}
-	return nil
-}
-
-// StepInstallProtoc is used to install protoc
-func StepInstallProtoc(ctx context.Context,
-	pluginManager pluginmanager.PluginManager,
-	configItems []configs.ConfigItem) error {
-	deduplicate := map[string]struct{}{}
-	for _, config := range configItems {
-		version := config.Config().Protoc
-		if version == "" {
-			return errors.Errorf("protoc version is required: %s", config.Path())
-		}
-		deduplicate[version] = struct{}{}
-	}
-	progress := progressbar.GetProgressBar(ctx, len(deduplicate))
-	progress.SetPrefix("Install protoc")
-
-	versionsMap := map[string]struct{}{}
-	for version := range deduplicate {
-		if version == "latest" {
-			progress.SetSuffix("query latest version of protoc")
-			latestVersion, err := pluginManager.GetProtocLatestVersion(ctx)
-			if err != nil {
-				return errors.Wrap(err, "failed to list protoc versions")
-			}
-			version = latestVersion
-		}
-		progress.SetSuffix("check cache of protoc %s", version)
-		exists, _, err := pluginManager.IsProtocInstalled(ctx, version)
-		if err != nil {
-			return err
-		}
-		if exists {
-			progress.SetSuffix("the %s version of protoc is already cached", version)
-		} else {
-			progress.SetSuffix("install %s version of protoc", version)
-			_, err = pluginManager.InstallProtoc(ctx, version)
-			if err != nil {
-				return err
-			}
-			progress.SetSuffix("the %s version of protoc is installed", version)
-		}
-		versionsMap[version] = struct{}{}
-		progress.Incr()
-	}
-	progress.Wait()
-	fmt.Println("the following versions of protoc will be used:", util.SetToSlice(versionsMap))
-	return nil
-}
-
-// StepInstallPlugins is used to install plugins
-func StepInstallPlugins(ctx context.Context,
-	pluginManager pluginmanager.PluginManager,
-	configItems []configs.ConfigItem,
-) error {
-	deduplicate := map[string]struct{}{}
-	for _, config := range configItems {
-		for _, pkg := range config.Config().Plugins {
-			deduplicate[pkg] = struct{}{}
-		}
-	}
-	progress := progressbar.GetProgressBar(ctx, len(deduplicate))
-	progress.SetPrefix("Install plugins")
-	pluginsMap := map[string]struct{}{}
-	for pkg := range deduplicate {
-		path, version, ok := util.SplitGoPackageVersion(pkg)
-		if !ok {
-			return errors.Errorf("invalid format: %s, should in path@version format", pkg)
-		}
-		if version == "latest" {
-			progress.SetSuffix("query latest version of %s", path)
-			data, err := pluginManager.GetPluginLatestVersion(ctx, path)
-			if err != nil {
-				return err
-			}
-			version = data
-			pkg = util.JoinGoPackageVersion(path, version)
-		}
-		progress.SetSuffix("check cache of %s", pkg)
-		exists, _, err := pluginManager.IsPluginInstalled(ctx, path, version)
-		if err != nil {
-			return err
-		}
-		if exists {
-			progress.SetSuffix("%s is cached", pkg)
-		} else {
-			progress.SetSuffix("installing %s", pkg)
-			_, err := pluginManager.InstallPlugin(ctx, path, version)
-			if err != nil {
-				panic(err)
-			}
-			progress.SetSuffix("%s installed", pkg)
-		}
-		pluginsMap[pkg] = struct{}{}
-		progress.Incr()
-	}
-	progress.SetSuffix("all plugins have been installed")
-	progress.Wait()
-
-	fmt.Println("the following plugins will be used:")
-	for pkg := range pluginsMap {
-		fmt.Printf("	%s\r\n", pkg)
-	}
-	return nil
-}
-
 // StepCompile is used to compile proto files
 func StepCompile(ctx context.Context,
 	compilerManager compilermanager.CompilerManager,
@@ -296,6 +133,15 @@ func StepPostShell(ctx context.Context,
 
 // Compile is used to compile proto files
 func Compile(ctx context.Context, targets []string) error {
+	fixed, err := compile(ctx, targets, consts.IsFixImports(ctx))
+	if fixed {
+		fmt.Println("the config has been updated to resolve missing imports, compile again")
+		_, err = compile(ctx, targets, false)
+	}
+	return err
+}
+
+func compile(ctx context.Context, targets []string, fix bool) (fixed bool, err error) {
 	log := logger.NewDefault("compile")
 	log.SetLogLevel(logger.LevelInfo)
 	if consts.IsDebugMode(ctx) {
@@ -304,45 +150,43 @@ func Compile(ctx context.Context, targets []string) error {
 
 	configManager, err := configmanager.NewConfigManager(log)
 	if err != nil {
-		return err
+		return false, err
 	}
-	pluginManager, err := pluginmanager.NewPluginManager(pluginmanager.NewConfig(), log)
+	pluginConfig, err := pluginmanager.LoadConfig()
 	if err != nil {
-		return err
+		return false, err
+	}
+	pluginManager, err := pluginmanager.NewPluginManager(pluginConfig, log)
+	if err != nil {
+		return false, err
 	}
 	compilerManager, err := compilermanager.NewCompilerManager(ctx, log, configManager, pluginManager)
 	if err != nil {
-		return err
+		return false, err
 	}
 	actionManager, err := actionmanager.NewActionManager(log)
 	if err != nil {
-		return err
+		return false, err
 	}
 
 	configItems, err := StepLookUpConfigs(ctx, targets, configManager)
 	if err != nil {
-		return err
+		return false, err
 	}
 
-	if err := StepInstallProtoc(ctx, pluginManager, configItems); err != nil {
-		return err
-	}
-	if err := StepInstallRepositories(ctx, pluginManager, configItems); err != nil {
-		return err
-	}
-	if err := StepInstallPlugins(ctx, pluginManager, configItems); err != nil {
-		return err
+	if err := StepInstallDependencies(ctx, pluginManager, configItems); err != nil {
+		return false, err
 	}
 	if err := StepCompile(ctx, compilerManager, targets); err != nil {
-		return err
+		return StepResolveMissingImports(ctx, compilerManager, pluginManager, err, fix), err
 	}
 
 	if !consts.IsDisableAction(ctx) {
 		if err := StepPostAction(ctx, actionManager, configItems); err != nil {
-			return err
+			return false, err
 		}
 		if err := StepPostShell(ctx, actionManager, configItems); err != nil {
-			return err
+			return false, err
 		}
 	} else {
 		displayWarn := false
@@ -358,5 +202,5 @@ func Compile(ctx context.Context, targets []string) error {
 	}
 
 	log.LogInfo(nil, "Good job! you are ready to go :)")
-	return nil
+	return false, nil
 }
@@ -0,0 +1,484 @@
+// Copyright 2021 storyicon@foxmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bootstraps
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/storyicon/powerproto/pkg/component/pluginmanager"
+	"github.com/storyicon/powerproto/pkg/configs"
+	"github.com/storyicon/powerproto/pkg/consts"
+	"github.com/storyicon/powerproto/pkg/util"
+)
+
+// PruneOptions defines the options of pruning cache
+type PruneOptions struct {
+	// Roots are the directories in which config files are searched recursively,
+	// the entries not referenced by the config files are pruned
+	Roots []string
+	// UnusedFor is the duration, the entries not used for it are pruned
+	UnusedFor time.Duration
+	// DryRun only prints the entries to be pruned
+	DryRun bool
+}
+
+// cacheReferences defines the cache entries referenced by config files,
+// the maps are keyed by the reference key of entry, and the values are the packages in config files.
+// The repositories and archives are keyed with the suffix of include patterns, so that only the
+// variants filtered by the patterns in use are referenced
+type cacheReferences struct {
+	protoc       map[string]string
+	plugins      map[string]string
+	repositories map[string]string
+	archives     map[string]string
+	// unresolved are the packages whose version can not be resolved from the cache, e.g. the branch of repository,
+	// they are keyed by the kind, name and suffix of entry, and all the cached versions of them are referenced
+	unresolved map[string]string
+	// goModules are the go module repositories, which are stored in the module cache of go
+	// instead of the storage dir, so they can not be pruned or exported
+	goModules []string
+}
+
+// addUnresolved is used to reference all the cached versions of package
+func (r *cacheReferences) addUnresolved(kind string, name string, suffix string, pkg string) {
+	r.unresolved[kind+":"+name+suffix] = pkg
+}
+
+func (r *cacheReferences) contains(entry *pluginmanager.CacheEntry) bool {
+	if _, ok := r.unresolved[entry.Kind+":"+entry.Name+entry.Suffix]; ok {
+		return true
+	}
+	var ok bool
+	switch entry.Kind {
+	case pluginmanager.CacheKindProtoc:
+		_, ok = r.protoc[normalizeProtocVersion(entry.Version)]
+	case pluginmanager.CacheKindPlugin:
+		_, ok = r.plugins[util.JoinGoPackageVersion(entry.Name, entry.Version)]
+	case pluginmanager.CacheKindRepository:
+		_, ok = r.repositories[entry.Version+entry.Suffix]
+	case pluginmanager.CacheKindArchive:
+		_, ok = r.archives[entry.Version+entry.Suffix]
+	}
+	return ok
+}
+
+// missing is used to list the referenced packages that are not in entries
+func (r *cacheReferences) missing(entries []*pluginmanager.CacheEntry) []string {
+	found := map[string]struct{}{}
+	for _, entry := range entries {
+		if pkg, ok := r.unresolved[entry.Kind+":"+entry.Name+entry.Suffix]; ok {
+			found[pkg] = struct{}{}
+		}
+		switch entry.Kind {
+		case pluginmanager.CacheKindProtoc:
+			found[r.protoc[normalizeProtocVersion(entry.Version)]] = struct{}{}
+		case pluginmanager.CacheKindPlugin:
+			found[r.plugins[util.JoinGoPackageVersion(entry.Name, entry.Version)]] = struct{}{}
+		case pluginmanager.CacheKindRepository:
+			found[r.repositories[entry.Version+entry.Suffix]] = struct{}{}
+		case pluginmanager.CacheKindArchive:
+			found[r.archives[entry.Version+entry.Suffix]] = struct{}{}
+		}
+	}
+	var missing []string
+	for _, references := range []map[string]string{r.protoc, r.plugins, r.repositories, r.archives, r.unresolved} {
+		for _, pkg := range references {
+			if _, ok := found[pkg]; !ok {
+				missing = append(missing, pkg)
+			}
+		}
+	}
+	sort.Strings(missing)
+	return util.DeduplicateSliceStably(missing)
+}
+
+func normalizeProtocVersion(version string) string {
+	if strings.HasPrefix(version, "v") {
+		return version
+	}
+	return "v" + version
+}
+
+// StepPruneCache is used to remove the cache entries selected by options.
+// If both roots and unusedFor are specified, only the entries satisfying both are pruned
+func StepPruneCache(ctx context.Context,
+	pluginManager pluginmanager.PluginManager,
+	storageDir string,
+	options *PruneOptions,
+) error {
+	entries, err := pluginmanager.ListCacheEntries(storageDir)
+	if err != nil {
+		return err
+	}
+	var references *cacheReferences
+	if len(options.Roots) != 0 {
+		references, err = collectCacheReferences(ctx, pluginManager, options.Roots)
+		if err != nil {
+			return err
+		}
+	}
+	var count int
+	var size int64
+	for _, entry := range entries {
+		// the incomplete entries are never used, so they are pruned even if referenced
+		if references != nil && !entry.Incomplete && references.contains(entry) {
+			continue
+		}
+		if options.UnusedFor != 0 && time.Since(entry.LastUsed) < options.UnusedFor {
+			continue
+		}
+		if options.DryRun {
+			fmt.Printf("would remove %s (%s)\r\n", entry, util.FormatSize(entry.Size))
+		} else {
+			if err := pluginmanager.RemoveCacheEntry(entry); err != nil {
+				return errors.Wrapf(err, "failed to remove %s", entry)
+			}
+			fmt.Printf("removed %s (%s)\r\n", entry, util.FormatSize(entry.Size))
+		}
+		count++
+		size += entry.Size
+	}
+	// the legacy shared include dir is removed once every installed protoc has its own include files
+	removed, includeSize, err := pruneLegacyInclude(storageDir, options.DryRun)
+	if err != nil {
+		return err
+	}
+	if removed {
+		count++
+		size += includeSize
+	}
+	if options.DryRun {
+		fmt.Printf("%d entries would be pruned, %s would be freed\r\n", count, util.FormatSize(size))
+	} else {
+		fmt.Printf("%d entries are pruned, %s is freed\r\n", count, util.FormatSize(size))
+	}
+	return nil
+}
+
+// pruneLegacyInclude is used to remove the legacy shared include dir if it is no longer used,
+// it is not removed in dry run mode
+func pruneLegacyInclude(storageDir string, dryRun bool) (bool, int64, error) {
+	dir := pluginmanager.PathForInclude(storageDir)
+	exists, err := util.IsDirExists(dir)
+	if err != nil || !exists {
+		return false, 0, err
+	}
+	used, err := pluginmanager.IsLegacyIncludeUsed(storageDir)
+	if err != nil || used {
+		return false, 0, err
+	}
+	size, err := util.GetDirSize(dir)
+	if err != nil {
+		return false, 0, err
+	}
+	if dryRun {
+		fmt.Printf("would remove the legacy include dir %s (%s)\r\n", dir, util.FormatSize(size))
+		return true, size, nil
+	}
+	if err := os.RemoveAll(dir); err != nil {
+		return false, 0, errors.Wrapf(err, "failed to remove %s", dir)
+	}
+	fmt.Printf("removed the legacy include dir %s (%s)\r\n", dir, util.FormatSize(size))
+	return true, size, nil
+}
+
+// collectCacheReferences is used to collect the cache entries referenced by the config files
+// under roots and the global config file. The 'latest' is resolved to the newest cached version, the version constraints
+// reference all the cached versions satisfying them, and all the cached versions are referenced for the packages
+// that can not be resolved offline
+func collectCacheReferences(ctx context.Context,
+	pluginManager pluginmanager.PluginManager,
+	roots []string,
+) (*cacheReferences, error) {
+	var paths []string
+	for _, root := range roots {
+		items, err := findConfigFiles(root)
+		if err != nil {
+			return nil, err
+		}
+		paths = append(paths, items...)
+	}
+	exists, err := util.IsFileExists(consts.PathForGlobalConfig())
+	if err != nil {
+		return nil, err
+	}
+	if exists {
+		paths = append(paths, consts.PathForGlobalConfig())
+	}
+
+	ctx = consts.WithOffline(ctx)
+	references := &cacheReferences{
+		protoc:       map[string]string{},
+		plugins:      map[string]string{},
+		repositories: map[string]string{},
+		archives:     map[string]string{},
+		unresolved:   map[string]string{},
+	}
+	for _, path := range paths {
+		items, err := configs.LoadConfigs(path)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to load config %s", path)
+		}
+		for _, item := range items {
+			if version := item.Protoc; version == "latest" || version == consts.VersionLatestPrerelease {
+				latest, err := pluginManager.GetProtocLatestVersion(ctx, version == consts.VersionLatestPrerelease)
+				if err != nil {
+					references.addUnresolved(pluginmanager.CacheKindProtoc, "protoc", "", "protoc@"+version)
+				} else {
+					references.protoc[normalizeProtocVersion(latest)] = "protoc@" + normalizeProtocVersion(latest)
+				}
+			} else if util.IsVersionConstraint(version) {
+				versions, _ := pluginManager.ListProtocVersions(ctx)
+				matched := matchCachedVersions(version, versions)
+				if len(matched) == 0 {
+					references.addUnresolved(pluginmanager.CacheKindProtoc, "protoc", "", "protoc@"+version)
+				}
+				for _, item := range matched {
+					references.protoc[normalizeProtocVersion(item)] = "protoc@" + normalizeProtocVersion(item)
+				}
+			} else if source, err := pluginmanager.ParseProtocSource(version); err == nil && source.Kind == pluginmanager.ProtocSourceRelease {
+				references.protoc[normalizeProtocVersion(version)] = "protoc@" + normalizeProtocVersion(version)
+			}
+			for _, pkg := range item.Plugins {
+				source, err := pluginmanager.ParsePluginSource(pkg)
+				if err != nil {
+					continue
+				}
+				// the prebuilt plugins are installed into the same location as go plugins
+				if source.Kind != pluginmanager.PluginSourceGo && source.Kind != pluginmanager.PluginSourceRelease {
+					continue
+				}
+				path, version := source.Path, source.Version
+				if version == "latest" || version == consts.VersionLatestPrerelease {
+					latest, err := pluginManager.GetPluginLatestVersion(ctx, path, version == consts.VersionLatestPrerelease)
+					if err != nil {
+						references.addUnresolved(pluginmanager.CacheKindPlugin, path, "", pkg)
+						continue
+					}
+					version = latest
+				}
+				if util.IsVersionConstraint(version) {
+					versions, _ := pluginManager.ListPluginVersions(ctx, path)
+					matched := matchCachedVersions(version, versions)
+					if len(matched) == 0 {
+						references.addUnresolved(pluginmanager.CacheKindPlugin, path, "", pkg)
+					}
+					for _, item := range matched {
+						item = util.JoinGoPackageVersion(path, item)
+						references.plugins[item] = item
+					}
+					continue
+				}
+				pkg = util.JoinGoPackageVersion(path, version)
+				references.plugins[pkg] = pkg
+			}
+			for key, pkg := range item.Repositories {
+				source, err := pluginmanager.ParseRepositorySource(pkg)
+				if err != nil {
+					continue
+				}
+				suffix := pluginmanager.GetIncludeSuffix(item.GetRepositoryInclude(key))
+				// the go modules are stored in the module cache of go
+				switch source.Kind {
+				case pluginmanager.RepositorySourceArchive:
+					references.archives[source.Version+suffix] = source.String()
+					continue
+				case pluginmanager.RepositorySourceGoModule:
+					references.goModules = append(references.goModules, pkg)
+					continue
+				}
+				path, version := source.URI, source.Version
+				name, err := pluginmanager.GetGitRepoName(path)
+				if err != nil {
+					return nil, err
+				}
+				if util.IsVersionConstraint(version) {
+					// the tags can not be listed in offline mode, and the cached commits can not be matched
+					// against the constraint, so all of them are referenced
+					references.addUnresolved(pluginmanager.CacheKindRepository, name, suffix, pkg)
+					continue
+				}
+				if _, ok := pluginmanager.ParseGitRef(version); ok {
+					latest, err := pluginManager.GetGitRepoLatestVersion(ctx, path, version)
+					if err != nil {
+						references.addUnresolved(pluginmanager.CacheKindRepository, name, suffix, pkg)
+						continue
+					}
+					version = latest
+				}
+				references.repositories[version+suffix] = util.JoinGoPackageVersion(path, version)
+			}
+		}
+	}
+	return references, nil
+}
+
+// matchCachedVersions is used to get the cached versions satisfying the constraint. All of them are referenced,
+// because the one used depends on the versions available when the config is tidied
+func matchCachedVersions(constraint string, versions []string) []string {
+	c, err := util.ParseVersionConstraint(constraint)
+	if err != nil {
+		return nil
+	}
+	var matched []string
+	for _, version := range versions {
+		if c.Check(version) {
+			matched = append(matched, version)
+		}
+	}
+	return matched
+}
+
+// findConfigFiles is used to find the config files in dir recursively
+func findConfigFiles(dir string) ([]string, error) {
+	var paths []string
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			if info.Name() == ".git" {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if info.Name() == consts.ConfigFileName {
+			paths = append(paths, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to walk %s", dir)
+	}
+	return paths, nil
+}
+
+// StepVerifyCache is used to verify the installed binaries against their recorded checksums
+func StepVerifyCache(ctx context.Context, storageDir string) error {
+	entries, err := pluginmanager.ListCacheEntries(storageDir)
+	if err != nil {
+		return err
+	}
+	var failed int
+	for _, entry := range entries {
+		if entry.Binary == "" {
+			continue
+		}
+		recorded, err := pluginmanager.VerifyChecksum(entry.Binary)
+		switch {
+		case err != nil:
+			failed++
+			fmt.Printf("FAIL	%s: %s\r\n", entry, err)
+		case !recorded:
+			fmt.Printf("SKIP	%s: no checksum recorded\r\n", entry)
+		default:
+			fmt.Printf("OK	%s\r\n", entry)
+		}
+	}
+	if failed != 0 {
+		return errors.Errorf("%d binaries failed to verify", failed)
+	}
+	return nil
+}
+
+// StepExportCache is used to export the cache entries referenced by the config files
+// under roots into the bundle file, which can be imported by StepImportCache
+func StepExportCache(ctx context.Context,
+	pluginManager pluginmanager.PluginManager,
+	storageDir string,
+	roots []string,
+	output string,
+) error {
+	references, err := collectCacheReferences(ctx, pluginManager, roots)
+	if err != nil {
+		return err
+	}
+	entries, err := pluginmanager.ListCacheEntries(storageDir)
+	if err != nil {
+		return err
+	}
+	var selected []*pluginmanager.CacheEntry
+	for _, entry := range entries {
+		if !entry.Incomplete && references.contains(entry) {
+			selected = append(selected, entry)
+		}
+	}
+	if missing := references.missing(selected); len(missing) != 0 {
+		return errors.Errorf("the following packages are not cached, run 'powerproto tidy' to install them first:\r\n\t%s",
+			strings.Join(missing, "\r\n\t"))
+	}
+
+	temp := output + ".tmp"
+	file, err := os.Create(temp)
+	if err != nil {
+		return err
+	}
+	manifest, err := pluginmanager.ExportBundle(storageDir, selected, file)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(temp)
+		return errors.Wrap(err, "failed to export bundle")
+	}
+	if err := os.Rename(temp, output); err != nil {
+		os.Remove(temp)
+		return err
+	}
+	fmt.Printf("the following entries are exported to %s:\r\n", output)
+	printBundleEntries(manifest)
+	if len(references.goModules) != 0 {
+		goModules := util.DeduplicateSliceStably(references.goModules)
+		sort.Strings(goModules)
+		fmt.Printf("the following go module repositories are stored in the module cache of go and not exported, "+
+			"download them by 'go mod download' or copy the module cache to the target machine:\r\n\t%s\r\n",
+			strings.Join(goModules, "\r\n\t"))
+	}
+	return nil
+}
+
+// StepImportCache is used to verify the bundle exported by StepExportCache and install the entries in it
+func StepImportCache(ctx context.Context, storageDir string, input string) error {
+	file, err := os.Open(input)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	manifest, err := pluginmanager.ImportBundle(ctx, storageDir, file)
+	if err != nil {
+		return errors.Wrapf(err, "failed to import %s", input)
+	}
+	fmt.Printf("the following entries are imported to %s:\r\n", storageDir)
+	printBundleEntries(manifest)
+	return nil
+}
+
+func printBundleEntries(manifest *pluginmanager.BundleManifest) {
+	for _, entry := range manifest.Entries {
+		if entry.Kind == pluginmanager.CacheKindInclude {
+			fmt.Printf("\t%s\r\n", entry.Name)
+			continue
+		}
+		fmt.Printf("\t%s %s@%s\r\n", entry.Kind, entry.Name, entry.Version)
+	}
+}
@@ -0,0 +1,283 @@
+// Copyright 2021 storyicon@foxmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bootstraps
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/storyicon/powerproto/pkg/component/pluginmanager"
+	"github.com/storyicon/powerproto/pkg/consts"
+	"github.com/storyicon/powerproto/pkg/util"
+	"github.com/storyicon/powerproto/pkg/util/logger"
+)
+
+const (
+	testGoogleAPIs = "https://github.com/googleapis/googleapis"
+	testGogo       = "https://github.com/gogo/protobuf"
+	testCommitA    = "27156597fdf4fb77004434d4409154a230dc9a32"
+	testCommitB    = "1f4bc8e07ec64f1fe4c49f6a5b47d0e8fdc8c7f5"
+	testCommitC    = "226206f39bd7276e88ec684ea0028c18ec2c91ae"
+)
+
+// newTestPluginManager is used to create plugin manager with the storage dir in temp dir
+func newTestPluginManager(t *testing.T) (pluginmanager.PluginManager, string) {
+	dir, err := ioutil.TempDir("", "powerproto-bootstraps")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		os.RemoveAll(dir)
+	})
+	cfg := pluginmanager.NewConfig()
+	cfg.StorageDir = dir
+	storageDir, err := cfg.GetStorageDir()
+	if err != nil {
+		t.Fatal(err)
+	}
+	manager, err := pluginmanager.NewPluginManager(cfg, logger.NewDefault("bootstraps"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return manager, storageDir
+}
+
+// writeTestConfig is used to write the config file into a new temp dir and return the dir
+func writeTestConfig(t *testing.T, content string) string {
+	dir, err := ioutil.TempDir("", "powerproto-config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		os.RemoveAll(dir)
+	})
+	if err := ioutil.WriteFile(filepath.Join(dir, consts.ConfigFileName), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+// installTestGitRepo is used to mark the git repo of commit filtered by include patterns as installed in the storage dir
+func installTestGitRepo(t *testing.T, storageDir string, uri string, commitId string, include []string) string {
+	dir, err := pluginmanager.PathForGitReposCode(storageDir, uri, commitId, include)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(pluginmanager.PathForCompletionMarker(dir), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func TestStepPruneCache(t *testing.T) {
+	tests := []struct {
+		name       string
+		repository string
+		// kept are the commits of googleapis that should survive the prune
+		kept []string
+	}{
+		{
+			name:       "commit",
+			repository: testGoogleAPIs + "@" + testCommitA,
+			kept:       []string{testCommitA},
+		},
+		{
+			name:       "branch",
+			repository: testGoogleAPIs + "@branch:master",
+			kept:       []string{testCommitA, testCommitB},
+		},
+		{
+			name:       "tag",
+			repository: testGoogleAPIs + "@tag:v1.0.0",
+			kept:       []string{testCommitA, testCommitB},
+		},
+		{
+			name:       "tidied branch",
+			repository: testGoogleAPIs + "@" + testCommitB + " # branch:master",
+			kept:       []string{testCommitB},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			manager, storageDir := newTestPluginManager(t)
+			root := writeTestConfig(t, "scopes:\n  - ./\nrepositories:\n  GOOGLE_APIS: "+tt.repository+"\n")
+			dirs := map[string]string{
+				testCommitA: installTestGitRepo(t, storageDir, testGoogleAPIs, testCommitA, nil),
+				testCommitB: installTestGitRepo(t, storageDir, testGoogleAPIs, testCommitB, nil),
+			}
+			unused := installTestGitRepo(t, storageDir, testGogo, testCommitC, nil)
+
+			err := StepPruneCache(context.TODO(), manager, storageDir, &PruneOptions{
+				Roots: []string{root},
+			})
+			if err != nil {
+				t.Fatalf("StepPruneCache() error = %v", err)
+			}
+			for commitId, dir := range dirs {
+				exists, err := util.IsDirExists(dir)
+				if err != nil {
+					t.Fatal(err)
+				}
+				want := util.Contains(tt.kept, commitId)
+				if exists != want {
+					t.Errorf("StepPruneCache() kept %s = %v, want %v", commitId, exists, want)
+				}
+			}
+			if exists, _ := util.IsDirExists(unused); exists {
+				t.Errorf("StepPruneCache() kept the unreferenced %s", unused)
+			}
+		})
+	}
+}
+
+// installTestFile is used to create the file and mark the installation in its directory as completed
+func installTestFile(t *testing.T, path string) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	for _, file := range []string{path, pluginmanager.PathForCompletionMarker(filepath.Dir(path))} {
+		if err := ioutil.WriteFile(file, nil, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestStepPruneCacheConstraints(t *testing.T) {
+	const pluginPath = "google.golang.org/protobuf/cmd/protoc-gen-go"
+	tests := []struct {
+		name   string
+		config string
+		want   []string
+	}{
+		{
+			name:   "protoc constraint",
+			config: "protoc: ~3.17",
+			want:   []string{"protoc@v3.17.0", "protoc@v3.17.3"},
+		},
+		{
+			name:   "tidied protoc constraint",
+			config: "protoc: v3.17.0 # ~3.17",
+			want:   []string{"protoc@v3.17.0"},
+		},
+		{
+			name:   "plugin constraint",
+			config: "plugins:\n  protoc-gen-go: " + pluginPath + "@~1.27",
+			want:   []string{pluginPath + "@v1.27.0", pluginPath + "@v1.27.1"},
+		},
+		{
+			name:   "unmatched plugin constraint",
+			config: "plugins:\n  protoc-gen-go: " + pluginPath + "@^2",
+			want:   []string{pluginPath + "@v1.25.0", pluginPath + "@v1.27.0", pluginPath + "@v1.27.1"},
+		},
+		{
+			name:   "repository constraint",
+			config: "repositories:\n  GOOGLE_APIS: " + testGoogleAPIs + "@^1.2",
+			want:   []string{"github.com/googleapis/googleapis@" + testCommitB, "github.com/googleapis/googleapis@" + testCommitA},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			manager, storageDir := newTestPluginManager(t)
+			root := writeTestConfig(t, "scopes:\n  - ./\n"+tt.config+"\n")
+			for _, version := range []string{"3.9.0", "3.17.0", "3.17.3"} {
+				installTestFile(t, pluginmanager.PathForProtoc(storageDir, version))
+			}
+			for _, version := range []string{"v1.25.0", "v1.27.0", "v1.27.1"} {
+				local, err := pluginmanager.PathForPlugin(storageDir, pluginPath, version)
+				if err != nil {
+					t.Fatal(err)
+				}
+				installTestFile(t, local)
+			}
+			installTestGitRepo(t, storageDir, testGoogleAPIs, testCommitA, nil)
+			installTestGitRepo(t, storageDir, testGoogleAPIs, testCommitB, nil)
+
+			err := StepPruneCache(context.TODO(), manager, storageDir, &PruneOptions{
+				Roots: []string{root},
+			})
+			if err != nil {
+				t.Fatalf("StepPruneCache() error = %v", err)
+			}
+			entries, err := pluginmanager.ListCacheEntries(storageDir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, entry := range entries {
+				got = append(got, entry.String())
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("StepPruneCache() kept %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStepPruneCacheInclude(t *testing.T) {
+	include := []string{"google/api/**"}
+	tests := []struct {
+		name   string
+		config string
+		// filtered reports whether the repository filtered by include patterns should survive the prune,
+		// the unfiltered one should survive otherwise
+		filtered bool
+	}{
+		{
+			name:   "without include",
+			config: "repositories:\n  GOOGLE_APIS: " + testGoogleAPIs + "@" + testCommitA,
+		},
+		{
+			name:     "with include",
+			config:   "repositories:\n  GOOGLE_APIS: " + testGoogleAPIs + "@" + testCommitA + "\nrepositoryConfigs:\n  GOOGLE_APIS:\n    include:\n      - google/api/**",
+			filtered: true,
+		},
+		{
+			name:     "branch with include",
+			config:   "repositories:\n  GOOGLE_APIS: " + testGoogleAPIs + "@branch:master\nrepositoryConfigs:\n  GOOGLE_APIS:\n    include:\n      - google/api/**",
+			filtered: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			manager, storageDir := newTestPluginManager(t)
+			root := writeTestConfig(t, "scopes:\n  - ./\n"+tt.config+"\n")
+			unfiltered := installTestGitRepo(t, storageDir, testGoogleAPIs, testCommitA, nil)
+			filtered := installTestGitRepo(t, storageDir, testGoogleAPIs, testCommitA, include)
+
+			err := StepPruneCache(context.TODO(), manager, storageDir, &PruneOptions{
+				Roots: []string{root},
+			})
+			if err != nil {
+				t.Fatalf("StepPruneCache() error = %v", err)
+			}
+			for dir, want := range map[string]bool{filtered: tt.filtered, unfiltered: !tt.filtered} {
+				exists, err := util.IsDirExists(dir)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if exists != want {
+					t.Errorf("StepPruneCache() kept %s = %v, want %v", dir, exists, want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,106 @@
+// Copyright 2021 storyicon@foxmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bootstraps
+
+import (
+	"context"
+	"sync"
+
+	"github.com/pkg/errors"
+	"google.golang.org/protobuf/types/descriptorpb"
+
+	"github.com/storyicon/powerproto/pkg/component/compilermanager"
+	"github.com/storyicon/powerproto/pkg/component/configmanager"
+	"github.com/storyicon/powerproto/pkg/component/pluginmanager"
+	"github.com/storyicon/powerproto/pkg/util/concurrent"
+	"github.com/storyicon/powerproto/pkg/util/logger"
+	"github.com/storyicon/powerproto/pkg/util/progressbar"
+)
+
+// StepBuildDescriptors is used to build descriptor sets of proto files
+// The returned map is keyed by proto file path
+func StepBuildDescriptors(ctx context.Context,
+	compilerManager compilermanager.CompilerManager,
+	targets []string,
+) (map[string]*descriptorpb.FileDescriptorSet, error) {
+	progress := progressbar.GetProgressBar(ctx, len(targets))
+	progress.SetPrefix("Build descriptors")
+	var lock sync.Mutex
+	descriptors := make(map[string]*descriptorpb.FileDescriptorSet, len(targets))
+	c := concurrent.NewErrGroup(ctx, 10)
+	for _, target := range targets {
+		func(target string) {
+			c.Go(func(ctx context.Context) error {
+				progress.SetSuffix(target)
+				comp, err := compilerManager.GetCompiler(ctx, target)
+				if err != nil {
+					return err
+				}
+				set, err := comp.BuildDescriptorSet(ctx, target)
+				if err != nil {
+					return err
+				}
+				if len(set.GetFile()) == 0 {
+					return errors.Errorf("empty descriptor set: %s", target)
+				}
+				lock.Lock()
+				descriptors[target] = set
+				lock.Unlock()
+				progress.Incr()
+				return nil
+			})
+		}(target)
+	}
+	if err := c.Wait(); err != nil {
+		return nil, err
+	}
+	progress.Wait()
+	return descriptors, nil
+}
+
+func buildDescriptors(ctx context.Context,
+	log logger.Logger,
+	configManager configmanager.ConfigManager,
+	targets []string,
+) (map[string]*descriptorpb.FileDescriptorSet, error) {
+	if len(targets) == 0 {
+		return map[string]*descriptorpb.FileDescriptorSet{}, nil
+	}
+	if err := StepTidyConfig(ctx, targets); err != nil {
+		return nil, err
+	}
+	pluginConfig, err := pluginmanager.LoadConfig()
+	if err != nil {
+		return nil, err
+	}
+	pluginManager, err := pluginmanager.NewPluginManager(pluginConfig, log)
+	if err != nil {
+		return nil, err
+	}
+	compilerManager, err := compilermanager.NewCompilerManager(ctx, log, configManager, pluginManager)
+	if err != nil {
+		return nil, err
+	}
+	configItems, err := StepLookUpConfigs(ctx, targets, configManager)
+	if err != nil {
+		return nil, err
+	}
+	err = installDependencies(ctx, pluginManager, configItems,
+		installKindProtoc, installKindRepository)
+	if err != nil {
+		return nil, err
+	}
+	return StepBuildDescriptors(ctx, compilerManager, targets)
+}
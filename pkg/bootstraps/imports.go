@@ -0,0 +1,136 @@
+// Copyright 2021 storyicon@foxmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bootstraps
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/pkg/errors"
+
+	"github.com/storyicon/powerproto/pkg/component/compilermanager"
+	"github.com/storyicon/powerproto/pkg/component/pluginmanager"
+	"github.com/storyicon/powerproto/pkg/configs"
+	"github.com/storyicon/powerproto/pkg/util"
+)
+
+// StepResolveMissingImports is used to display the config entries that can resolve
+// the missing imports of compile error, and apply them to the config if fix is true.
+// It returns whether the config is updated
+func StepResolveMissingImports(ctx context.Context,
+	compilerManager compilermanager.CompilerManager,
+	pluginManager pluginmanager.PluginManager,
+	err error,
+	fix bool,
+) bool {
+	var errCompile *compilermanager.ErrCompile
+	if !errors.As(err, &errCompile) {
+		return false
+	}
+	imports := errCompile.MissingImports()
+	if len(imports) == 0 {
+		return false
+	}
+	comp, err := compilerManager.GetCompiler(ctx, errCompile.ProtoFile)
+	if err != nil {
+		return false
+	}
+	config := comp.GetConfig(ctx)
+	suggestions, err := compilermanager.SuggestImports(ctx, pluginManager, config, imports)
+	if err != nil {
+		fmt.Printf("failed to search missing imports: %s\r\n", err)
+		return false
+	}
+	fmt.Printf("the following imports of %s can not be found:\r\n", errCompile.ProtoFile)
+	found := map[string]struct{}{}
+	for _, suggestion := range suggestions {
+		found[suggestion.Import] = struct{}{}
+		fmt.Printf("	%s, found in %s\r\n", suggestion.Import, suggestion.Source)
+	}
+	for _, item := range imports {
+		if _, ok := found[item]; !ok {
+			fmt.Printf("	%s, not found in any known location\r\n", item)
+		}
+	}
+	if len(suggestions) == 0 {
+		return false
+	}
+	if !fix {
+		fmt.Printf("add the following entries to %s, or use '--fix' to apply them:\r\n", config.Path())
+		repositories, importPaths := mergeImportSuggestions(suggestions)
+		if len(repositories) != 0 {
+			fmt.Println("repositories:")
+			for _, name := range sortedKeys(repositories) {
+				fmt.Printf("    %s: %s\r\n", name, repositories[name])
+			}
+		}
+		fmt.Println("importPaths:")
+		for _, path := range importPaths {
+			fmt.Printf("    - %s\r\n", path)
+		}
+		return false
+	}
+	if err := StepFixImports(ctx, config, suggestions); err != nil {
+		fmt.Printf("failed to update %s: %s\r\n", config.Path(), err)
+		return false
+	}
+	return true
+}
+
+// StepFixImports is used to apply the import suggestions to the config
+func StepFixImports(ctx context.Context, config configs.ConfigItem, suggestions []*compilermanager.ImportSuggestion) error {
+	items, err := configs.LoadConfigs(config.Path())
+	if err != nil {
+		return err
+	}
+	if config.Index() >= len(items) {
+		return errors.Errorf("config %s is changed", config.ID())
+	}
+	item := items[config.Index()]
+	repositories, importPaths := mergeImportSuggestions(suggestions)
+	for name, pkg := range repositories {
+		if item.Repositories == nil {
+			item.Repositories = map[string]string{}
+		}
+		if existing, ok := item.Repositories[name]; ok && existing != pkg {
+			return errors.Errorf("repository %s already exists: %s", name, existing)
+		}
+		item.Repositories[name] = pkg
+	}
+	item.ImportPaths = util.DeduplicateSliceStably(append(item.ImportPaths, importPaths...))
+	return configs.SaveConfigs(config.Path(), items...)
+}
+
+func mergeImportSuggestions(suggestions []*compilermanager.ImportSuggestion) (map[string]string, []string) {
+	repositories := map[string]string{}
+	var importPaths []string
+	for _, suggestion := range suggestions {
+		for name, pkg := range suggestion.Repositories {
+			repositories[name] = pkg
+		}
+		importPaths = append(importPaths, suggestion.ImportPaths...)
+	}
+	return repositories, util.DeduplicateSliceStably(importPaths)
+}
+
+func sortedKeys(data map[string]string) []string {
+	keys := make([]string, 0, len(data))
+	for key := range data {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
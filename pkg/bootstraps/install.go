@@ -0,0 +1,609 @@
+// Copyright 2021 storyicon@foxmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bootstraps
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/hashicorp/go-multierror"
+	"github.com/pkg/errors"
+
+	"github.com/storyicon/powerproto/pkg/component/pluginmanager"
+	"github.com/storyicon/powerproto/pkg/configs"
+	"github.com/storyicon/powerproto/pkg/consts"
+	"github.com/storyicon/powerproto/pkg/util"
+	"github.com/storyicon/powerproto/pkg/util/progressbar"
+)
+
+// installConcurrency is the max number of packages installed concurrently
+const installConcurrency = 8
+
+// defines the kinds of install task
+const (
+	installKindProtoc     = "protoc"
+	installKindRepository = "repositories"
+	installKindPlugin     = "plugins"
+)
+
+// installTask defines the installation of a package declared in config files
+type installTask struct {
+	kind string
+	// pkg is the package declared in config files, e.g. protoc@latest
+	pkg string
+	// install is used to resolve the version of package and install it,
+	// it returns the package with resolved version
+	install func(ctx context.Context, progress progressbar.ProgressBar) (string, error)
+}
+
+// errNotCached defines the error that the package is required but not cached in offline mode
+type errNotCached struct {
+	pkg string
+}
+
+// Error implements the error interface
+func (err *errNotCached) Error() string {
+	return fmt.Sprintf("%s is not cached", err.pkg)
+}
+
+// StepInstallDependencies is used to install protoc, repositories and plugins concurrently
+func StepInstallDependencies(ctx context.Context,
+	pluginManager pluginmanager.PluginManager,
+	configItems []configs.ConfigItem,
+) error {
+	return installDependencies(ctx, pluginManager, configItems,
+		installKindProtoc, installKindRepository, installKindPlugin)
+}
+
+// StepInstallProtoc is used to install protoc
+func StepInstallProtoc(ctx context.Context,
+	pluginManager pluginmanager.PluginManager,
+	configItems []configs.ConfigItem) error {
+	return installDependencies(ctx, pluginManager, configItems, installKindProtoc)
+}
+
+// StepInstallRepositories is used to install repositories
+func StepInstallRepositories(ctx context.Context,
+	pluginManager pluginmanager.PluginManager,
+	configItems []configs.ConfigItem) error {
+	return installDependencies(ctx, pluginManager, configItems, installKindRepository)
+}
+
+// StepInstallPlugins is used to install plugins
+func StepInstallPlugins(ctx context.Context,
+	pluginManager pluginmanager.PluginManager,
+	configItems []configs.ConfigItem,
+) error {
+	return installDependencies(ctx, pluginManager, configItems, installKindPlugin)
+}
+
+func installDependencies(ctx context.Context,
+	pluginManager pluginmanager.PluginManager,
+	configItems []configs.ConfigItem,
+	kinds ...string,
+) error {
+	var tasks []*installTask
+	for _, kind := range kinds {
+		var items []*installTask
+		var err error
+		switch kind {
+		case installKindProtoc:
+			items, err = getProtocInstallTasks(pluginManager, configItems)
+		case installKindRepository:
+			items, err = getRepositoryInstallTasks(pluginManager, configItems)
+		case installKindPlugin:
+			items, err = getPluginInstallTasks(pluginManager, configItems)
+		}
+		if err != nil {
+			return err
+		}
+		tasks = append(tasks, items...)
+	}
+	if len(tasks) == 0 {
+		return nil
+	}
+	installed, err := runInstallTasks(ctx, tasks)
+	if err != nil {
+		return err
+	}
+	for _, kind := range kinds {
+		if len(installed[kind]) == 0 {
+			continue
+		}
+		sort.Strings(installed[kind])
+		installed[kind] = util.DeduplicateSliceStably(installed[kind])
+		switch kind {
+		case installKindProtoc:
+			fmt.Println("the following versions of protoc will be used:", installed[kind])
+		case installKindRepository:
+			fmt.Println("the following versions of googleapis will be used:")
+		case installKindPlugin:
+			fmt.Println("the following plugins will be used:")
+		}
+		if kind == installKindProtoc {
+			continue
+		}
+		for _, pkg := range installed[kind] {
+			fmt.Printf("	%s\r\n", pkg)
+		}
+	}
+	return nil
+}
+
+// runInstallTasks is used to run the tasks with a bounded worker pool.
+// All the failures are collected instead of stopping at the first one.
+// It returns the packages with resolved version grouped by kind
+func runInstallTasks(ctx context.Context, tasks []*installTask) (map[string][]string, error) {
+	progress := progressbar.GetProgressBar(ctx, len(tasks))
+	progress.SetPrefix("Install dependencies")
+
+	var lock sync.Mutex
+	var wg sync.WaitGroup
+	limit := make(chan struct{}, installConcurrency)
+	installed := map[string][]string{}
+	missing := map[string][]string{}
+	var errs error
+	for _, task := range tasks {
+		limit <- struct{}{}
+		wg.Add(1)
+		go func(task *installTask) {
+			defer func() {
+				<-limit
+				wg.Done()
+			}()
+			pkg, err := task.install(ctx, progress)
+			lock.Lock()
+			defer lock.Unlock()
+			var notCached *errNotCached
+			switch {
+			case errors.As(err, &notCached):
+				missing[task.kind] = append(missing[task.kind], notCached.pkg)
+			case err != nil:
+				errs = multierror.Append(errs, errors.Wrapf(err, "failed to install %s", task.pkg))
+			default:
+				installed[task.kind] = append(installed[task.kind], pkg)
+			}
+			progress.Incr()
+		}(task)
+	}
+	wg.Wait()
+	progress.SetSuffix("all dependencies have been processed")
+	progress.Wait()
+
+	for _, kind := range []string{installKindProtoc, installKindRepository, installKindPlugin} {
+		if len(missing[kind]) != 0 {
+			errs = multierror.Append(errs, errOfflineMissing(kind, missing[kind]))
+		}
+	}
+	if errs != nil {
+		if merr, ok := errs.(*multierror.Error); ok {
+			sort.Slice(merr.Errors, func(i, j int) bool {
+				return merr.Errors[i].Error() < merr.Errors[j].Error()
+			})
+		}
+		return nil, errs
+	}
+	return installed, nil
+}
+
+// errOfflineMissing is used to build the error listing the items
+// that are required but not cached in offline mode
+func errOfflineMissing(kind string, missing []string) error {
+	sort.Strings(missing)
+	return errors.Errorf("the following %s are not cached, which is required in offline mode:\r\n\t%s",
+		kind, strings.Join(missing, "\r\n\t"))
+}
+
+func getProtocInstallTasks(pluginManager pluginmanager.PluginManager,
+	configItems []configs.ConfigItem) ([]*installTask, error) {
+	deduplicate := map[string]struct{}{}
+	locals := map[string]struct{}{}
+	var tasks []*installTask
+	for _, config := range configItems {
+		source, err := pluginmanager.ParseProtocSource(config.Config().Protoc)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid protoc of %s", config.Path())
+		}
+		if source.Kind == pluginmanager.ProtocSourceRelease {
+			deduplicate[source.Version] = struct{}{}
+			continue
+		}
+		// the protoc not installed by PowerProto belongs to the machine running it,
+		// so it can not be verified for other platforms
+		if !pluginManager.Platform().IsHost() {
+			continue
+		}
+		// the protoc not installed by PowerProto is only verified
+		var binary, include string
+		if source.Kind == pluginmanager.ProtocSourcePath {
+			binary = configs.ResolvePath(config, source.Path)
+		}
+		if dir := config.Config().ProtocInclude; dir != "" {
+			include = configs.ResolvePath(config, dir)
+		}
+		key := strings.Join([]string{binary, source.Version, include}, "\x00")
+		if _, ok := locals[key]; ok {
+			continue
+		}
+		locals[key] = struct{}{}
+		tasks = append(tasks, getLocalProtocInstallTask(pluginManager, binary, source.Version, include))
+	}
+	for _, version := range util.SetToSlice(deduplicate) {
+		version := version
+		tasks = append(tasks, &installTask{
+			kind: installKindProtoc,
+			pkg:  util.JoinGoPackageVersion("protoc", version),
+			install: func(ctx context.Context, progress progressbar.ProgressBar) (string, error) {
+				if version == "latest" || version == consts.VersionLatestPrerelease {
+					progress.SetSuffix("query latest version of protoc")
+					latestVersion, err := pluginManager.GetProtocLatestVersion(ctx, version == consts.VersionLatestPrerelease)
+					if err != nil {
+						if consts.IsOffline(ctx) {
+							return "", &errNotCached{pkg: "protoc@" + version}
+						}
+						return "", errors.Wrap(err, "failed to list protoc versions")
+					}
+					version = latestVersion
+				}
+				progress.SetSuffix("check cache of protoc %s", version)
+				exists, _, err := pluginManager.IsProtocInstalled(ctx, version)
+				if err != nil {
+					return "", err
+				}
+				if exists {
+					// the protoc installed by earlier releases has no include files of its own,
+					// and they are fetched by InstallProtoc
+					if !consts.IsOffline(ctx) {
+						if _, err := pluginManager.InstallProtoc(ctx, version); err != nil {
+							return "", err
+						}
+					}
+					progress.SetSuffix("the %s version of protoc is already cached", version)
+					return version, nil
+				}
+				if consts.IsOffline(ctx) {
+					return "", &errNotCached{pkg: "protoc@" + version}
+				}
+				progress.SetSuffix("install %s version of protoc", version)
+				if _, err := pluginManager.InstallProtoc(ctx, version); err != nil {
+					return "", err
+				}
+				progress.SetSuffix("the %s version of protoc is installed", version)
+				return version, nil
+			},
+		})
+	}
+	return tasks, nil
+}
+
+func getRepositoryInstallTasks(pluginManager pluginmanager.PluginManager,
+	configItems []configs.ConfigItem) ([]*installTask, error) {
+	// the repository filtered by different include patterns is installed separately
+	deduplicate := map[string][]string{}
+	for _, config := range configItems {
+		for name, pkg := range config.Config().Repositories {
+			// the repository replaced by local directory is not installed
+			if source, err := pluginmanager.ParseRepositorySource(pkg); err == nil {
+				if _, rel, ok := config.Config().GetReplace(source.URI); ok && rel == "." {
+					continue
+				}
+			}
+			include := config.Config().GetRepositoryInclude(name)
+			deduplicate[pkg+"\x00"+strings.Join(include, "\x00")] = append([]string{pkg}, include...)
+		}
+	}
+	keys := make([]string, 0, len(deduplicate))
+	for key := range deduplicate {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var tasks []*installTask
+	for _, key := range keys {
+		pkg, include := deduplicate[key][0], deduplicate[key][1:]
+		source, err := pluginmanager.ParseRepositorySource(pkg)
+		if err != nil {
+			return nil, err
+		}
+		switch source.Kind {
+		case pluginmanager.RepositorySourceArchive:
+			tasks = append(tasks, getArchiveRepoInstallTask(pluginManager, source, include))
+			continue
+		case pluginmanager.RepositorySourceGoModule:
+			tasks = append(tasks, getGoModuleInstallTask(pluginManager, source))
+			continue
+		}
+		path, version := source.URI, source.Version
+		tasks = append(tasks, &installTask{
+			kind: installKindRepository,
+			pkg:  pkg,
+			install: func(ctx context.Context, progress progressbar.ProgressBar) (string, error) {
+				version := version
+				if _, ok := pluginmanager.ParseGitRef(version); ok {
+					progress.SetSuffix("query %s version of %s", version, path)
+					latestVersion, err := pluginManager.GetGitRepoLatestVersion(ctx, path, version)
+					if err != nil {
+						if consts.IsOffline(ctx) {
+							return "", &errNotCached{pkg: pkg}
+						}
+						return "", errors.Wrapf(err, "failed to query %s version of %s", version, path)
+					}
+					version = latestVersion
+				}
+				resolved := util.JoinGoPackageVersion(path, version)
+				progress.SetSuffix("check cache of %s", resolved)
+				exists, _, err := pluginManager.IsGitRepoInstalled(ctx, path, version, include)
+				if err != nil {
+					return "", err
+				}
+				if exists {
+					progress.SetSuffix("the %s version of %s is already cached", version, path)
+					return resolved, nil
+				}
+				if consts.IsOffline(ctx) {
+					return "", &errNotCached{pkg: resolved}
+				}
+				progress.SetSuffix("install %s version of %s", version, path)
+				if _, err := pluginManager.InstallGitRepo(ctx, path, version, include); err != nil {
+					return "", err
+				}
+				progress.SetSuffix("the %s version of %s is installed", version, path)
+				return resolved, nil
+			},
+		})
+	}
+	return tasks, nil
+}
+
+func getArchiveRepoInstallTask(pluginManager pluginmanager.PluginManager,
+	source *pluginmanager.RepositorySource, include []string) *installTask {
+	return &installTask{
+		kind: installKindRepository,
+		pkg:  source.String(),
+		install: func(ctx context.Context, progress progressbar.ProgressBar) (string, error) {
+			progress.SetSuffix("check cache of %s", source.URI)
+			exists, _, err := pluginManager.IsArchiveRepoInstalled(ctx, source.URI, source.Version, include)
+			if err != nil {
+				return "", err
+			}
+			if exists {
+				progress.SetSuffix("%s is already cached", source.URI)
+				return source.String(), nil
+			}
+			if consts.IsOffline(ctx) {
+				return "", &errNotCached{pkg: source.String()}
+			}
+			progress.SetSuffix("install %s", source.URI)
+			if _, err := pluginManager.InstallArchiveRepo(ctx, source.URI, source.Version, include); err != nil {
+				return "", err
+			}
+			progress.SetSuffix("%s is installed", source.URI)
+			return source.String(), nil
+		},
+	}
+}
+
+func getGoModuleInstallTask(pluginManager pluginmanager.PluginManager,
+	source *pluginmanager.RepositorySource) *installTask {
+	return &installTask{
+		kind: installKindRepository,
+		pkg:  source.String(),
+		install: func(ctx context.Context, progress progressbar.ProgressBar) (string, error) {
+			progress.SetSuffix("download %s version of %s", source.Version, source.URI)
+			module, err := pluginManager.GetGoModule(ctx, source.URI, source.Version)
+			if err != nil {
+				if consts.IsOffline(ctx) {
+					return "", &errNotCached{pkg: source.String()}
+				}
+				return "", err
+			}
+			progress.SetSuffix("the %s version of %s is downloaded", module.Version, source.URI)
+			resolved := *source
+			resolved.Version = module.Version
+			return resolved.String(), nil
+		},
+	}
+}
+
+func getPluginInstallTasks(pluginManager pluginmanager.PluginManager,
+	configItems []configs.ConfigItem) ([]*installTask, error) {
+	deduplicate := map[string]struct{}{}
+	locals := map[string]struct{}{}
+	var tasks []*installTask
+	for _, config := range configItems {
+		for name, pkg := range config.Config().Plugins {
+			source, err := pluginmanager.ParsePluginSource(pkg)
+			if err != nil {
+				return nil, err
+			}
+			var dir, rel string
+			switch source.Kind {
+			case pluginmanager.PluginSourceRelease:
+				if _, ok := locals[pkg]; ok {
+					continue
+				}
+				locals[pkg] = struct{}{}
+				release := config.Config().GetPluginRelease(name)
+				if release == nil {
+					return nil, errors.Errorf("the release of plugin %s is not configured in pluginReleases", name)
+				}
+				asset, err := pluginmanager.GetPluginAsset(release, source.Version, pluginManager.Platform().String())
+				if err != nil {
+					return nil, errors.Wrapf(err, "failed to get the release of plugin %s", name)
+				}
+				tasks = append(tasks, getReleasePluginInstallTask(pluginManager, source, asset))
+				continue
+			case pluginmanager.PluginSourcePath:
+				// the prebuilt local binary is only used on the current machine
+				if !pluginManager.Platform().IsHost() {
+					continue
+				}
+				binary := configs.ResolvePath(config, source.Path)
+				if _, ok := locals[binary]; !ok {
+					locals[binary] = struct{}{}
+					tasks = append(tasks, getPrebuiltPluginInstallTask(binary))
+				}
+				continue
+			case pluginmanager.PluginSourceLocal:
+				dir, rel, err = pluginmanager.FindGoModule(configs.ResolvePath(config, source.Path))
+				if err != nil {
+					return nil, err
+				}
+			default:
+				// the plugin replaced by local directory is built from it
+				var ok bool
+				if dir, rel, ok = configs.GetReplaceDir(config, source.Path); !ok {
+					deduplicate[pkg] = struct{}{}
+					continue
+				}
+			}
+			if _, ok := locals[filepath.Join(dir, rel)]; !ok {
+				locals[filepath.Join(dir, rel)] = struct{}{}
+				tasks = append(tasks, getLocalPluginInstallTask(pluginManager, source.Path, dir, rel))
+			}
+		}
+	}
+	for _, pkg := range util.SetToSlice(deduplicate) {
+		path, version, ok := util.SplitGoPackageVersion(pkg)
+		if !ok {
+			return nil, errors.Errorf("invalid format: %s, should in path@version format", pkg)
+		}
+		pkg := pkg
+		tasks = append(tasks, &installTask{
+			kind: installKindPlugin,
+			pkg:  pkg,
+			install: func(ctx context.Context, progress progressbar.ProgressBar) (string, error) {
+				version := version
+				if version == "latest" || version == consts.VersionLatestPrerelease {
+					progress.SetSuffix("query latest version of %s", path)
+					latestVersion, err := pluginManager.GetPluginLatestVersion(ctx, path, version == consts.VersionLatestPrerelease)
+					if err != nil {
+						if consts.IsOffline(ctx) {
+							return "", &errNotCached{pkg: pkg}
+						}
+						return "", errors.Wrapf(err, "failed to query latest version of %s", path)
+					}
+					version = latestVersion
+				}
+				resolved := util.JoinGoPackageVersion(path, version)
+				progress.SetSuffix("check cache of %s", resolved)
+				exists, _, err := pluginManager.IsPluginInstalled(ctx, path, version)
+				if err != nil {
+					return "", err
+				}
+				if exists {
+					progress.SetSuffix("%s is cached", resolved)
+					return resolved, nil
+				}
+				if consts.IsOffline(ctx) {
+					return "", &errNotCached{pkg: resolved}
+				}
+				progress.SetSuffix("installing %s", resolved)
+				if _, err := pluginManager.InstallPlugin(ctx, path, version); err != nil {
+					return "", err
+				}
+				progress.SetSuffix("%s installed", resolved)
+				return resolved, nil
+			},
+		})
+	}
+	return tasks, nil
+}
+
+func getLocalPluginInstallTask(pluginManager pluginmanager.PluginManager,
+	path string, dir string, rel string) *installTask {
+	return &installTask{
+		kind: installKindPlugin,
+		pkg:  path + " => " + dir,
+		install: func(ctx context.Context, progress progressbar.ProgressBar) (string, error) {
+			progress.SetSuffix("build %s from %s", path, dir)
+			if _, err := pluginManager.InstallLocalPlugin(ctx, dir, rel); err != nil {
+				return "", err
+			}
+			progress.SetSuffix("%s is built from %s", path, dir)
+			return path + " => " + dir, nil
+		},
+	}
+}
+
+func getPrebuiltPluginInstallTask(binary string) *installTask {
+	return &installTask{
+		kind: installKindPlugin,
+		pkg:  binary,
+		install: func(ctx context.Context, progress progressbar.ProgressBar) (string, error) {
+			exists, err := util.IsFileExists(binary)
+			if err != nil {
+				return "", err
+			}
+			if !exists {
+				return "", errors.Errorf("%s is not found", binary)
+			}
+			return binary, nil
+		},
+	}
+}
+
+func getReleasePluginInstallTask(pluginManager pluginmanager.PluginManager,
+	source *pluginmanager.PluginSource, asset *pluginmanager.PluginAsset) *installTask {
+	return &installTask{
+		kind: installKindPlugin,
+		pkg:  source.String(),
+		install: func(ctx context.Context, progress progressbar.ProgressBar) (string, error) {
+			resolved := util.JoinGoPackageVersion(source.Path, source.Version)
+			progress.SetSuffix("check cache of %s", resolved)
+			exists, _, err := pluginManager.IsPluginInstalled(ctx, source.Path, source.Version)
+			if err != nil {
+				return "", err
+			}
+			if exists {
+				progress.SetSuffix("%s is cached", resolved)
+				return source.String(), nil
+			}
+			if consts.IsOffline(ctx) {
+				return "", &errNotCached{pkg: source.String()}
+			}
+			progress.SetSuffix("downloading %s", asset.URL)
+			if _, err := pluginManager.InstallPluginRelease(ctx, source.Path, source.Version, asset); err != nil {
+				return "", err
+			}
+			progress.SetSuffix("%s installed", resolved)
+			return source.String(), nil
+		},
+	}
+}
+
+func getLocalProtocInstallTask(pluginManager pluginmanager.PluginManager,
+	binary string, version string, include string) *installTask {
+	name := binary
+	if name == "" {
+		name = pluginmanager.ProtocSourceSystem
+	}
+	return &installTask{
+		kind: installKindProtoc,
+		pkg:  util.JoinGoPackageVersion("protoc", name),
+		install: func(ctx context.Context, progress progressbar.ProgressBar) (string, error) {
+			progress.SetSuffix("verify protoc %s", name)
+			protoc, err := pluginManager.GetLocalProtoc(ctx, binary, version, include)
+			if err != nil {
+				return "", err
+			}
+			progress.SetSuffix("the %s version of protoc is found at %s", protoc.Version, protoc.Binary)
+			return protoc.Version, nil
+		},
+	}
+}
@@ -0,0 +1,61 @@
+// Copyright 2021 storyicon@foxmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bootstraps
+
+import (
+	"context"
+
+	"github.com/storyicon/powerproto/pkg/component/configmanager"
+	"github.com/storyicon/powerproto/pkg/component/lintmanager"
+	"github.com/storyicon/powerproto/pkg/consts"
+	"github.com/storyicon/powerproto/pkg/util/diagnostic"
+	"github.com/storyicon/powerproto/pkg/util/logger"
+)
+
+// Lint is used to lint proto files
+func Lint(ctx context.Context, targets []string) ([]*diagnostic.Diagnostic, error) {
+	log := logger.NewDefault("lint")
+	log.SetLogLevel(logger.LevelInfo)
+	if consts.IsDebugMode(ctx) {
+		log.SetLogLevel(logger.LevelDebug)
+	}
+
+	configManager, err := configmanager.NewConfigManager(log)
+	if err != nil {
+		return nil, err
+	}
+	lintManager, err := lintmanager.NewLintManager(log)
+	if err != nil {
+		return nil, err
+	}
+	descriptors, err := buildDescriptors(ctx, log, configManager, targets)
+	if err != nil {
+		return nil, err
+	}
+	var diagnostics []*diagnostic.Diagnostic
+	for _, target := range targets {
+		cfg, err := configManager.GetConfig(ctx, target)
+		if err != nil {
+			return nil, err
+		}
+		data, err := lintManager.Lint(ctx, cfg, target, descriptors[target])
+		if err != nil {
+			return nil, err
+		}
+		diagnostics = append(diagnostics, data...)
+	}
+	diagnostic.Sort(diagnostics)
+	return diagnostics, nil
+}
@@ -0,0 +1,351 @@
+// Copyright 2021 storyicon@foxmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bootstraps
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/storyicon/powerproto/pkg/component/pluginmanager"
+	"github.com/storyicon/powerproto/pkg/configs"
+	"github.com/storyicon/powerproto/pkg/consts"
+	"github.com/storyicon/powerproto/pkg/util"
+	"github.com/storyicon/powerproto/pkg/util/concurrent"
+	"github.com/storyicon/powerproto/pkg/util/progressbar"
+)
+
+// defines the kinds of outdated entry
+const (
+	OutdatedKindProtoc     = "protoc"
+	OutdatedKindPlugin     = "plugin"
+	OutdatedKindRepository = "repository"
+)
+
+// OutdatedEntry defines the current and newest versions of protoc, plugin or repository in config file
+type OutdatedEntry struct {
+	// Path is the path of config file
+	Path string `json:"path"`
+	// Index is the index of config item in the config file
+	Index int    `json:"index"`
+	Kind  string `json:"kind"`
+	// Name is the name in plugins or repositories, it is protoc for protoc
+	Name string `json:"name"`
+	// Package is the go package of plugin, or the url or module path of repository
+	Package string `json:"package,omitempty"`
+	// Constraint is the version constraint, branch or tag that the version is resolved from
+	Constraint string `json:"constraint,omitempty"`
+	Current    string `json:"current"`
+	// Wanted is the newest version satisfying the constraint, which is used by upgrade
+	Wanted string `json:"wanted"`
+	// Latest is the newest stable version regardless of the constraint
+	Latest string `json:"latest"`
+	// Error is the reason why the newest versions can not be resolved
+	Error string `json:"error,omitempty"`
+
+	// source is the repository source to be upgraded
+	source *pluginmanager.RepositorySource
+}
+
+// IsOutdated reports whether the entry can be upgraded to the wanted version
+func (e *OutdatedEntry) IsOutdated() bool {
+	return e.Error == "" && e.Wanted != "" && e.Wanted != e.Current
+}
+
+// String returns the entry in the format of path[index]: kind name current -> wanted,
+// the index tells apart the entries of the same name in the multiple config items of file
+func (e *OutdatedEntry) String() string {
+	return fmt.Sprintf("%s[%d]: %s %s %s -> %s", e.Path, e.Index, e.Kind, e.Name, e.Current, e.Wanted)
+}
+
+// Match reports whether the entry is referred by the name in plugins or repositories, protoc,
+// or the go package or url of it
+func (e *OutdatedEntry) Match(name string) bool {
+	return e.Name == name || (e.Package != "" && e.Package == name)
+}
+
+// StepLookUpOutdated is used to look up the versioned protoc, plugins and repositories
+// in the config files under roots, their newest versions are resolved by StepResolveOutdated
+func StepLookUpOutdated(roots []string) ([]*OutdatedEntry, error) {
+	var paths []string
+	for _, root := range roots {
+		items, err := findConfigFiles(root)
+		if err != nil {
+			return nil, err
+		}
+		paths = append(paths, items...)
+	}
+	var entries []*OutdatedEntry
+	for _, path := range paths {
+		items, err := configs.LoadConfigs(path)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to load config %s", path)
+		}
+		for index, item := range items {
+			entries = append(entries, getOutdatedEntries(path, index, item)...)
+		}
+	}
+	return entries, nil
+}
+
+// StepResolveOutdated is used to resolve the wanted and latest versions of entries concurrently,
+// the error is recorded in the entry that can not be resolved
+func StepResolveOutdated(ctx context.Context,
+	pluginManager pluginmanager.PluginManager,
+	progress progressbar.ProgressBar,
+	entries []*OutdatedEntry,
+) error {
+	progress.SetPrefix("query versions")
+	c := concurrent.NewErrGroup(ctx, installConcurrency)
+	for _, entry := range entries {
+		entry := entry
+		c.Go(func(ctx context.Context) error {
+			progress.SetSuffix("query versions of %s", entry.Name)
+			if err := resolveOutdatedEntry(ctx, pluginManager, entry); err != nil {
+				entry.Error = err.Error()
+			}
+			progress.Incr()
+			return nil
+		})
+	}
+	return c.Wait()
+}
+
+// getOutdatedEntries is used to get the entries of the versioned protoc, plugins and repositories in config item,
+// the system protoc, local plugins, prebuilt plugins and archives are not listed
+func getOutdatedEntries(path string, index int, item *configs.Config) []*OutdatedEntry {
+	var entries []*OutdatedEntry
+	if source, err := pluginmanager.ParseProtocSource(item.Protoc); err == nil && source.Kind == pluginmanager.ProtocSourceRelease {
+		entries = append(entries, &OutdatedEntry{
+			Path:       path,
+			Index:      index,
+			Kind:       OutdatedKindProtoc,
+			Name:       "protoc",
+			Constraint: getConstraint(item.ProtocConstraint, item.Protoc),
+			Current:    item.Protoc,
+		})
+	}
+	// the names are sorted so that the entries are listed in a stable order
+	pluginNames := util.GetMapKeys(item.Plugins)
+	sort.Strings(pluginNames)
+	for _, name := range pluginNames {
+		source, err := pluginmanager.ParsePluginSource(item.Plugins[name])
+		if err != nil || source.Kind != pluginmanager.PluginSourceGo {
+			continue
+		}
+		entries = append(entries, &OutdatedEntry{
+			Path:       path,
+			Index:      index,
+			Kind:       OutdatedKindPlugin,
+			Name:       name,
+			Package:    source.Path,
+			Constraint: getConstraint(item.PluginConstraints[name], source.Version),
+			Current:    source.Version,
+		})
+	}
+	repositoryNames := util.GetMapKeys(item.Repositories)
+	sort.Strings(repositoryNames)
+	for _, name := range repositoryNames {
+		source, err := pluginmanager.ParseRepositorySource(item.Repositories[name])
+		if err != nil || source.Kind == pluginmanager.RepositorySourceArchive {
+			continue
+		}
+		entries = append(entries, &OutdatedEntry{
+			Path:       path,
+			Index:      index,
+			Kind:       OutdatedKindRepository,
+			Name:       name,
+			Package:    source.URI,
+			Constraint: getConstraint(item.RepositoryRefs[name], source.Version),
+			Current:    source.Version,
+			source:     source,
+		})
+	}
+	return entries
+}
+
+// getConstraint is used to get the constraint that the version is resolved from,
+// the version itself is the constraint or ref if it has not been tidied
+func getConstraint(recorded string, version string) string {
+	if recorded != "" {
+		return recorded
+	}
+	if _, ok := pluginmanager.ParseGitRef(version); ok && version != "latest" {
+		return version
+	}
+	if util.IsVersionConstraint(version) {
+		return version
+	}
+	return ""
+}
+
+// resolveOutdatedEntry is used to resolve the wanted and latest versions of entry
+func resolveOutdatedEntry(ctx context.Context, pluginManager pluginmanager.PluginManager, entry *OutdatedEntry) error {
+	var err error
+	switch entry.Kind {
+	case OutdatedKindProtoc:
+		entry.Latest, err = pluginManager.GetProtocLatestVersion(ctx, false)
+		if err != nil {
+			return err
+		}
+		switch {
+		case util.IsVersionConstraint(entry.Constraint):
+			entry.Wanted, err = resolveProtocConstraint(ctx, pluginManager, entry.Constraint)
+		case entry.Current == consts.VersionLatestPrerelease:
+			entry.Wanted, err = pluginManager.GetProtocLatestVersion(ctx, true)
+		default:
+			entry.Wanted = entry.Latest
+		}
+		// the version of protoc can be declared with or without the prefix v
+		if normalizeProtocVersion(entry.Wanted) == normalizeProtocVersion(entry.Current) {
+			entry.Wanted = entry.Current
+		}
+		return err
+	case OutdatedKindPlugin:
+		return resolveOutdatedGoEntry(ctx, pluginManager, entry)
+	}
+	if entry.source.Kind == pluginmanager.RepositorySourceGoModule {
+		return resolveOutdatedGoEntry(ctx, pluginManager, entry)
+	}
+	// the git repository follows the recorded branch, tag or constraint, and the default branch otherwise.
+	// The latest of the repository tracking tags is the commit of the newest tag
+	switch {
+	case util.IsVersionConstraint(entry.Constraint):
+		entry.Wanted, err = resolveGitRepoConstraint(ctx, pluginManager, entry.Package, entry.Constraint)
+	case entry.Constraint != "":
+		entry.Wanted, err = pluginManager.GetGitRepoLatestVersion(ctx, entry.Package, entry.Constraint)
+	default:
+		entry.Wanted, err = pluginManager.GetGitRepoLatestVersion(ctx, entry.Package, "latest")
+	}
+	if err != nil {
+		return err
+	}
+	entry.Latest = entry.Wanted
+	if !util.IsVersionConstraint(entry.Constraint) && !strings.HasPrefix(entry.Constraint, configs.RepositoryRefTagPrefix) {
+		return nil
+	}
+	tags, err := pluginManager.ListGitRepoTags(ctx, entry.Package)
+	if err != nil {
+		return err
+	}
+	_, sorted := util.SortSemanticVersion(tags)
+	for i := len(sorted) - 1; i >= 0; i-- {
+		if util.IsStableVersion(sorted[i]) {
+			entry.Latest, err = pluginManager.GetGitRepoLatestVersion(ctx, entry.Package, configs.RepositoryRefTagPrefix+sorted[i])
+			return err
+		}
+	}
+	return nil
+}
+
+// resolveOutdatedGoEntry is used to resolve the wanted and latest versions of go plugin or go module
+func resolveOutdatedGoEntry(ctx context.Context, pluginManager pluginmanager.PluginManager, entry *OutdatedEntry) error {
+	var err error
+	entry.Latest, err = pluginManager.GetPluginLatestVersion(ctx, entry.Package, false)
+	if err != nil {
+		return err
+	}
+	switch {
+	case util.IsVersionConstraint(entry.Constraint):
+		entry.Wanted, err = resolvePluginConstraint(ctx, pluginManager, entry.Package, entry.Constraint)
+	case entry.Current == consts.VersionLatestPrerelease:
+		entry.Wanted, err = pluginManager.GetPluginLatestVersion(ctx, entry.Package, true)
+	default:
+		entry.Wanted = entry.Latest
+	}
+	return err
+}
+
+// StepUpgrade is used to upgrade the entries to their wanted versions,
+// the config files are written back by configs.SaveConfigs and the constraints are kept
+func StepUpgrade(ctx context.Context, entries []*OutdatedEntry) error {
+	grouped := map[string][]*OutdatedEntry{}
+	for _, entry := range entries {
+		if entry.IsOutdated() {
+			grouped[entry.Path] = append(grouped[entry.Path], entry)
+		}
+	}
+	paths := make([]string, 0, len(grouped))
+	for path := range grouped {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		items, err := configs.LoadConfigs(path)
+		if err != nil {
+			return errors.Wrapf(err, "failed to load config %s", path)
+		}
+		for _, entry := range grouped[path] {
+			if entry.Index >= len(items) {
+				return errors.Errorf("config item %d of %s does not exist", entry.Index, path)
+			}
+			if err := upgradeConfigItem(items[entry.Index], entry); err != nil {
+				return errors.Wrapf(err, "failed to upgrade %s", entry)
+			}
+		}
+		if err := configs.SaveConfigs(path, items...); err != nil {
+			return errors.Wrapf(err, "failed to save config %s", path)
+		}
+	}
+	return nil
+}
+
+// upgradeConfigItem is used to set the version of entry in config item to the wanted version,
+// and record the constraint that it is resolved from like tidy does
+func upgradeConfigItem(item *configs.Config, entry *OutdatedEntry) error {
+	switch entry.Kind {
+	case OutdatedKindProtoc:
+		item.Protoc = entry.Wanted
+		if util.IsVersionConstraint(entry.Constraint) {
+			item.ProtocConstraint = entry.Constraint
+		}
+		return nil
+	case OutdatedKindPlugin:
+		pkg, ok := item.Plugins[entry.Name]
+		if !ok {
+			return errors.Errorf("plugin %s does not exist", entry.Name)
+		}
+		source, err := pluginmanager.ParsePluginSource(pkg)
+		if err != nil {
+			return err
+		}
+		source.Version = entry.Wanted
+		item.Plugins[entry.Name] = source.String()
+		if util.IsVersionConstraint(entry.Constraint) {
+			if item.PluginConstraints == nil {
+				item.PluginConstraints = map[string]string{}
+			}
+			item.PluginConstraints[entry.Name] = entry.Constraint
+		}
+		return nil
+	}
+	pkg, ok := item.Repositories[entry.Name]
+	if !ok {
+		return errors.Errorf("repository %s does not exist", entry.Name)
+	}
+	source, err := pluginmanager.ParseRepositorySource(pkg)
+	if err != nil {
+		return err
+	}
+	source.Version = entry.Wanted
+	item.Repositories[entry.Name] = source.String()
+	if entry.Constraint != "" {
+		setRepositoryRef(item, entry.Name, entry.Constraint)
+	}
+	return nil
+}
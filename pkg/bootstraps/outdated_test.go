@@ -0,0 +1,278 @@
+// Copyright 2021 storyicon@foxmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bootstraps
+
+import (
+	"context"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/storyicon/powerproto/pkg/configs"
+	"github.com/storyicon/powerproto/pkg/consts"
+)
+
+const testPluginPath = "google.golang.org/protobuf/cmd/protoc-gen-go"
+
+func Test_getConstraint(t *testing.T) {
+	tests := []struct {
+		name     string
+		recorded string
+		version  string
+		want     string
+	}{
+		{name: "recorded constraint", recorded: "~1.27", version: "v1.27.1", want: "~1.27"},
+		{name: "recorded branch", recorded: "branch:master", version: testCommitA, want: "branch:master"},
+		{name: "untidied constraint", version: "^2.5", want: "^2.5"},
+		{name: "untidied major version", version: "v1", want: "v1"},
+		{name: "untidied branch", version: "branch:master", want: "branch:master"},
+		{name: "untidied tag", version: "tag:v1.0.0", want: "tag:v1.0.0"},
+		{name: "latest", version: "latest", want: ""},
+		{name: "version", version: "v1.27.1", want: ""},
+		{name: "commit", version: testCommitA, want: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := getConstraint(tt.recorded, tt.version); got != tt.want {
+				t.Errorf("getConstraint() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_getOutdatedEntries(t *testing.T) {
+	tests := []struct {
+		name string
+		item *configs.Config
+		// want are the entries in the format of kind name constraint current
+		want [][4]string
+	}{
+		{
+			name: "protoc",
+			item: &configs.Config{Protoc: "3.17.3", ProtocConstraint: "~3.17"},
+			want: [][4]string{{OutdatedKindProtoc, "protoc", "~3.17", "3.17.3"}},
+		},
+		{
+			name: "system protoc",
+			item: &configs.Config{Protoc: "system@3.21.12"},
+		},
+		{
+			name: "plugins",
+			item: &configs.Config{
+				Plugins: map[string]string{
+					"protoc-gen-go":       testPluginPath + "@v1.27.1",
+					"protoc-gen-go-grpc":  "google.golang.org/grpc/cmd/protoc-gen-go-grpc@~1.1",
+					"protoc-gen-foo":      "path:./bin/protoc-gen-foo",
+					"protoc-gen-bar":      "local:./tools/protoc-gen-bar",
+					"protoc-gen-grpc-web": "release:github.com/grpc/grpc-web/protoc-gen-grpc-web@v1.4.2",
+				},
+				PluginConstraints: map[string]string{
+					"protoc-gen-go": "~1.27",
+				},
+			},
+			want: [][4]string{
+				{OutdatedKindPlugin, "protoc-gen-go", "~1.27", "v1.27.1"},
+				{OutdatedKindPlugin, "protoc-gen-go-grpc", "~1.1", "~1.1"},
+			},
+		},
+		{
+			name: "repositories",
+			item: &configs.Config{
+				Repositories: map[string]string{
+					"GOOGLE_APIS":         testGoogleAPIs + "@" + testCommitA,
+					"GOGO_PROTOBUF":       testGogo + "@tag:v1.3.2",
+					"PROTOS":              "https://example.com/protos.tar.gz#sha256=9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08",
+					"PROTOC_GEN_VALIDATE": "gomod:github.com/envoyproxy/protoc-gen-validate@v1.0.2",
+				},
+				RepositoryRefs: map[string]string{
+					"GOOGLE_APIS": "branch:master",
+				},
+			},
+			want: [][4]string{
+				{OutdatedKindRepository, "GOGO_PROTOBUF", "tag:v1.3.2", "tag:v1.3.2"},
+				{OutdatedKindRepository, "GOOGLE_APIS", "branch:master", testCommitA},
+				{OutdatedKindRepository, "PROTOC_GEN_VALIDATE", "", "v1.0.2"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got [][4]string
+			for _, entry := range getOutdatedEntries("powerproto.yaml", 1, tt.item) {
+				if entry.Path != "powerproto.yaml" || entry.Index != 1 {
+					t.Errorf("getOutdatedEntries() got %s in %s[%d]", entry.Name, entry.Path, entry.Index)
+				}
+				got = append(got, [4]string{entry.Kind, entry.Name, entry.Constraint, entry.Current})
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("getOutdatedEntries() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_upgradeConfigItem(t *testing.T) {
+	tests := []struct {
+		name  string
+		item  *configs.Config
+		entry *OutdatedEntry
+		want  *configs.Config
+	}{
+		{
+			name:  "protoc constraint",
+			item:  &configs.Config{Protoc: "~3.17"},
+			entry: &OutdatedEntry{Kind: OutdatedKindProtoc, Name: "protoc", Constraint: "~3.17", Wanted: "v3.17.3"},
+			want:  &configs.Config{Protoc: "v3.17.3", ProtocConstraint: "~3.17"},
+		},
+		{
+			name:  "protoc latest",
+			item:  &configs.Config{Protoc: "3.9.0"},
+			entry: &OutdatedEntry{Kind: OutdatedKindProtoc, Name: "protoc", Wanted: "v21.12"},
+			want:  &configs.Config{Protoc: "v21.12"},
+		},
+		{
+			name: "plugin",
+			item: &configs.Config{Plugins: map[string]string{
+				"protoc-gen-go":      testPluginPath + "@v1.25.0",
+				"protoc-gen-go-grpc": "google.golang.org/grpc/cmd/protoc-gen-go-grpc@v1.1.0",
+			}},
+			entry: &OutdatedEntry{Kind: OutdatedKindPlugin, Name: "protoc-gen-go", Constraint: "~1.27", Wanted: "v1.27.1"},
+			want: &configs.Config{
+				Plugins: map[string]string{
+					"protoc-gen-go":      testPluginPath + "@v1.27.1",
+					"protoc-gen-go-grpc": "google.golang.org/grpc/cmd/protoc-gen-go-grpc@v1.1.0",
+				},
+				PluginConstraints: map[string]string{"protoc-gen-go": "~1.27"},
+			},
+		},
+		{
+			name: "repository branch",
+			item: &configs.Config{Repositories: map[string]string{
+				"GOOGLE_APIS": testGoogleAPIs + "@branch:master",
+			}},
+			entry: &OutdatedEntry{Kind: OutdatedKindRepository, Name: "GOOGLE_APIS", Constraint: "branch:master", Wanted: testCommitB},
+			want: &configs.Config{
+				Repositories:   map[string]string{"GOOGLE_APIS": testGoogleAPIs + "@" + testCommitB},
+				RepositoryRefs: map[string]string{"GOOGLE_APIS": "branch:master"},
+			},
+		},
+		{
+			name: "go module repository",
+			item: &configs.Config{Repositories: map[string]string{
+				"PROTOC_GEN_VALIDATE": "gomod:github.com/envoyproxy/protoc-gen-validate@v1.0.0",
+			}},
+			entry: &OutdatedEntry{Kind: OutdatedKindRepository, Name: "PROTOC_GEN_VALIDATE", Wanted: "v1.0.2"},
+			want: &configs.Config{
+				Repositories: map[string]string{"PROTOC_GEN_VALIDATE": "gomod:github.com/envoyproxy/protoc-gen-validate@v1.0.2"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := upgradeConfigItem(tt.item, tt.entry); err != nil {
+				t.Fatalf("upgradeConfigItem() error = %v", err)
+			}
+			if !reflect.DeepEqual(tt.item, tt.want) {
+				t.Errorf("upgradeConfigItem() = %+v, want %+v", tt.item, tt.want)
+			}
+		})
+	}
+	err := upgradeConfigItem(&configs.Config{}, &OutdatedEntry{Kind: OutdatedKindPlugin, Name: "protoc-gen-go"})
+	if err == nil {
+		t.Errorf("upgradeConfigItem() of the missing plugin should fail")
+	}
+}
+
+func TestStepUpgrade(t *testing.T) {
+	root := writeTestConfig(t, `scopes:
+  - ./a
+protoc: v3.17.0 # ~3.17
+plugins:
+  protoc-gen-go: `+testPluginPath+`@v1.27.0 # ~1.27
+repositories:
+  GOOGLE_APIS: `+testGoogleAPIs+`@`+testCommitA+` # branch:master
+  GOGO_PROTOBUF: `+testGogo+`@tag:v1.3.2
+---
+scopes:
+  - ./b
+protoc: v3.17.0 # ~3.17
+plugins:
+  protoc-gen-go: `+testPluginPath+`@v1.27.0 # ~1.27
+repositories:
+  GOOGLE_APIS: `+testGoogleAPIs+`@`+testCommitA+` # branch:master
+`)
+	path := filepath.Join(root, consts.ConfigFileName)
+	entries, err := StepLookUpOutdated([]string{root})
+	if err != nil {
+		t.Fatalf("StepLookUpOutdated() error = %v", err)
+	}
+	if len(entries) != 7 {
+		t.Fatalf("StepLookUpOutdated() got %d entries, want 7", len(entries))
+	}
+	// only the entries in the second config item are upgraded
+	var selected []*OutdatedEntry
+	for _, entry := range entries {
+		if entry.Index != 1 {
+			continue
+		}
+		switch entry.Kind {
+		case OutdatedKindProtoc:
+			entry.Wanted = "v3.17.3"
+		case OutdatedKindPlugin:
+			entry.Wanted = "v1.27.1"
+		case OutdatedKindRepository:
+			entry.Wanted = testCommitB
+		}
+		selected = append(selected, entry)
+	}
+	if err := StepUpgrade(context.TODO(), selected); err != nil {
+		t.Fatalf("StepUpgrade() error = %v", err)
+	}
+
+	items, err := configs.LoadConfigs(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 2 {
+		t.Fatalf("StepUpgrade() saved %d config items, want 2", len(items))
+	}
+	tests := []struct {
+		index      int
+		protoc     string
+		plugin     string
+		repository string
+	}{
+		{index: 0, protoc: "v3.17.0", plugin: "v1.27.0", repository: testCommitA},
+		{index: 1, protoc: "v3.17.3", plugin: "v1.27.1", repository: testCommitB},
+	}
+	for _, tt := range tests {
+		item := items[tt.index]
+		if item.Protoc != tt.protoc || item.ProtocConstraint != "~3.17" {
+			t.Errorf("config item %d: protoc = %s # %s, want %s # ~3.17", tt.index, item.Protoc, item.ProtocConstraint, tt.protoc)
+		}
+		if want := testPluginPath + "@" + tt.plugin; item.Plugins["protoc-gen-go"] != want || item.PluginConstraints["protoc-gen-go"] != "~1.27" {
+			t.Errorf("config item %d: plugin = %s # %s, want %s # ~1.27", tt.index,
+				item.Plugins["protoc-gen-go"], item.PluginConstraints["protoc-gen-go"], want)
+		}
+		if want := testGoogleAPIs + "@" + tt.repository; item.Repositories["GOOGLE_APIS"] != want || item.RepositoryRefs["GOOGLE_APIS"] != "branch:master" {
+			t.Errorf("config item %d: repository = %s # %s, want %s # branch:master", tt.index,
+				item.Repositories["GOOGLE_APIS"], item.RepositoryRefs["GOOGLE_APIS"], want)
+		}
+	}
+	// the tag that is not resolved is kept
+	if got, want := items[0].Repositories["GOGO_PROTOBUF"], testGogo+"@tag:v1.3.2"; got != want {
+		t.Errorf("config item 0: repository = %s, want %s", got, want)
+	}
+}
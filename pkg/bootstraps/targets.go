@@ -0,0 +1,198 @@
+// Copyright 2021 storyicon@foxmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bootstraps
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/bmatcuk/doublestar"
+	"github.com/pkg/errors"
+
+	"github.com/storyicon/powerproto/pkg/util"
+)
+
+// StepLookUpTargets is used to look up the proto files of targets
+// The target can be a proto file, a directory or a doublestar glob pattern such as
+// 'services/**/v1/*.proto'. If target is a directory, the proto files in it will be listed,
+// and the sub folders will be included when recursive is true.
+// The files matched by the exclude patterns, or in the directories matched by them, are skipped
+func StepLookUpTargets(ctx context.Context, targets []string, recursive bool, excludes []string) ([]string, error) {
+	excludes, err := absPatterns(excludes)
+	if err != nil {
+		return nil, err
+	}
+	var files []string
+	for _, target := range targets {
+		items, err := lookUpTarget(target, recursive)
+		if err != nil {
+			return nil, err
+		}
+		for _, item := range items {
+			excluded, err := isExcluded(excludes, item)
+			if err != nil {
+				return nil, err
+			}
+			if !excluded {
+				files = append(files, item)
+			}
+		}
+	}
+	return util.DeduplicateSliceStably(files), nil
+}
+
+func lookUpTarget(target string, recursive bool) ([]string, error) {
+	target, err := filepath.Abs(target)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to abs target path")
+	}
+	if isGlobPattern(target) {
+		matches, err := doublestar.Glob(target)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid pattern: %s", target)
+		}
+		var files []string
+		for _, match := range matches {
+			fileInfo, err := os.Stat(match)
+			if err != nil {
+				return nil, errors.Wrapf(err, "failed to stat target: %s", match)
+			}
+			if !fileInfo.IsDir() {
+				if filepath.Ext(match) == ".proto" {
+					files = append(files, match)
+				}
+				continue
+			}
+			items, err := lookUpDir(match, recursive)
+			if err != nil {
+				return nil, err
+			}
+			files = append(files, items...)
+		}
+		// the ignore files between the static part of the pattern and the matches
+		// take effect in the same way as they do when the directory is the target
+		matcher := util.NewIgnoreMatcher(globBase(target))
+		result := make([]string, 0, len(files))
+		for _, file := range files {
+			ignored, err := matcher.IsIgnored(file)
+			if err != nil {
+				return nil, errors.Wrapf(err, "failed to check ignore files of %s", file)
+			}
+			if !ignored {
+				result = append(result, file)
+			}
+		}
+		return result, nil
+	}
+	fileInfo, err := os.Stat(target)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to stat target: %s", target)
+	}
+	if !fileInfo.IsDir() {
+		return []string{target}, nil
+	}
+	return lookUpDir(target, recursive)
+}
+
+func lookUpDir(dir string, recursive bool) ([]string, error) {
+	var targets []string
+	var err error
+	if recursive {
+		targets, err = util.GetFilesWithExtRecursively(dir, ".proto")
+	} else {
+		targets, err = util.GetFilesWithExt(dir, ".proto")
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to walk directory")
+	}
+	return targets, nil
+}
+
+func isGlobPattern(target string) bool {
+	return strings.ContainsAny(target, "*?[{")
+}
+
+// globBase is used to get the longest leading directory of the pattern that contains no glob syntax
+func globBase(pattern string) string {
+	base := pattern
+	for isGlobPattern(base) {
+		base = filepath.Dir(base)
+	}
+	return base
+}
+
+func absPatterns(patterns []string) ([]string, error) {
+	result := make([]string, 0, len(patterns))
+	for _, pattern := range patterns {
+		pattern, err := filepath.Abs(pattern)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to abs pattern: %s", pattern)
+		}
+		result = append(result, pattern)
+	}
+	return result, nil
+}
+
+// isExcluded is used to check whether the file or any of its parent directories
+// is matched by the patterns
+func isExcluded(patterns []string, file string) (bool, error) {
+	for _, pattern := range patterns {
+		for cur := file; ; cur = filepath.Dir(cur) {
+			matched, err := util.MatchPath(pattern, cur)
+			if err != nil {
+				return false, errors.Wrapf(err, "invalid pattern: %s", pattern)
+			}
+			if matched {
+				return true, nil
+			}
+			if filepath.Dir(cur) == cur {
+				break
+			}
+		}
+	}
+	return false, nil
+}
+
+// ReadTargets is used to read targets line by line from file,
+// the targets are read from stdin if path is '-'.
+// Empty lines and lines starting with '#' are skipped
+func ReadTargets(path string) ([]string, error) {
+	var reader io.Reader = os.Stdin
+	if path != "-" {
+		file, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer file.Close()
+		reader = file
+	}
+	var targets []string
+	scanner := bufio.NewScanner(reader)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		targets = append(targets, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return targets, nil
+}
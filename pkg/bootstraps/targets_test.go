@@ -0,0 +1,82 @@
+// Copyright 2021 storyicon@foxmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bootstraps
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/storyicon/powerproto/pkg/util"
+)
+
+func Test_lookUpTarget(t *testing.T) {
+	dir, err := ioutil.TempDir("", "powerproto-targets")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	files := map[string]string{
+		"apis/" + util.IgnoreFileName:        "third_party/\n*_internal.proto\n",
+		"apis/v1/a.proto":                    "",
+		"apis/v1/a_internal.proto":           "",
+		"apis/v1/third_party/b.proto":        "",
+		"apis/v2/" + util.IgnoreFileName:     "/legacy/\n",
+		"apis/v2/c.proto":                    "",
+		"apis/v2/legacy/d.proto":             "",
+		"apis/third_party/v1/e.proto":        "",
+		"apis/third_party/v1/nested/f.proto": "",
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tests := []struct {
+		name      string
+		target    string
+		recursive bool
+		want      []string
+	}{
+		{name: "directory", target: "apis", recursive: true, want: []string{"apis/v1/a.proto", "apis/v2/c.proto"}},
+		{name: "file glob", target: "apis/**/*.proto", want: []string{"apis/v1/a.proto", "apis/v2/c.proto"}},
+		{name: "directory glob", target: "apis/*", recursive: true, want: []string{"apis/v1/a.proto", "apis/v2/c.proto"}},
+		{name: "glob in ignored directory", target: "apis/*/v1/*.proto"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			items, err := lookUpTarget(filepath.Join(dir, filepath.FromSlash(tt.target)), tt.recursive)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, item := range items {
+				rel, _ := filepath.Rel(dir, item)
+				got = append(got, filepath.ToSlash(rel))
+			}
+			sort.Strings(got)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("lookUpTarget() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
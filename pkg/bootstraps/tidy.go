@@ -16,6 +16,7 @@ package bootstraps
 
 import (
 	"context"
+	"strings"
 
 	"github.com/pkg/errors"
 
@@ -40,7 +41,11 @@ func StepTidyConfig(ctx context.Context, targets []string) error {
 	if err != nil {
 		return err
 	}
-	pluginManager, err := pluginmanager.NewPluginManager(pluginmanager.NewConfig(), log)
+	pluginConfig, err := pluginmanager.LoadConfig()
+	if err != nil {
+		return err
+	}
+	pluginManager, err := pluginmanager.NewPluginManager(pluginConfig, log)
 	if err != nil {
 		return err
 	}
@@ -73,7 +78,9 @@ func StepTidyConfig(ctx context.Context, targets []string) error {
 }
 
 // StepTidyConfigFile is used clean config
-// It will amend the 'latest' version to the latest version number in 'vx.y.z' format
+// It will amend the 'latest' version to the latest version number in 'vx.y.z' format,
+// and resolve the version constraints such as ~1.27 to the newest version satisfying them,
+// the constraints are kept as the line comments in config file
 func StepTidyConfigFile(ctx context.Context,
 	pluginManager pluginmanager.PluginManager,
 	progress progressbar.ProgressBar,
@@ -86,38 +93,110 @@ func StepTidyConfigFile(ctx context.Context,
 	}
 	var cleanable bool
 	for _, item := range configItems {
-		if item.Protoc == "latest" {
+		if item.Protoc == "latest" || item.Protoc == consts.VersionLatestPrerelease {
 			progress.SetSuffix("query latest version of protoc")
-			version, err := pluginManager.GetProtocLatestVersion(ctx)
+			version, err := pluginManager.GetProtocLatestVersion(ctx, item.Protoc == consts.VersionLatestPrerelease)
+			if err != nil {
+				return err
+			}
+			item.Protoc = version
+			cleanable = true
+		}
+		if constraint := item.Protoc; util.IsVersionConstraint(constraint) {
+			progress.SetSuffix("resolve %s of protoc", constraint)
+			version, err := resolveProtocConstraint(ctx, pluginManager, constraint)
 			if err != nil {
 				return err
 			}
 			item.Protoc = version
+			item.ProtocConstraint = constraint
 			cleanable = true
 		}
 		for name, pkg := range item.Repositories {
-			path, version, ok := util.SplitGoPackageVersion(pkg)
-			if !ok {
-				return errors.Errorf("invalid package format: %s, should be in path@version format", pkg)
+			source, err := pluginmanager.ParseRepositorySource(pkg)
+			if err != nil {
+				return err
 			}
-			if version == "latest" {
-				progress.SetSuffix("query latest version of %s", path)
-				version, err := pluginManager.GetGitRepoLatestVersion(ctx, path)
+			switch source.Kind {
+			case pluginmanager.RepositorySourceArchive:
+				// the archive is pinned by its checksum
+				continue
+			case pluginmanager.RepositorySourceGoModule:
+				if constraint := source.Version; util.IsVersionConstraint(constraint) {
+					progress.SetSuffix("resolve %s of %s", constraint, source.URI)
+					source.Version, err = resolvePluginConstraint(ctx, pluginManager, source.URI, constraint)
+					if err != nil {
+						return err
+					}
+					item.Repositories[name] = source.String()
+					setRepositoryRef(item, name, constraint)
+					cleanable = true
+				}
+				if source.Version == "latest" {
+					progress.SetSuffix("query latest version of %s", source.URI)
+					module, err := pluginManager.GetGoModule(ctx, source.URI, source.Version)
+					if err != nil {
+						return err
+					}
+					source.Version = module.Version
+					item.Repositories[name] = source.String()
+					cleanable = true
+				}
+				continue
+			}
+			path, version := source.URI, source.Version
+			if constraint := version; util.IsVersionConstraint(constraint) {
+				progress.SetSuffix("resolve %s of %s", constraint, path)
+				commitId, err := resolveGitRepoConstraint(ctx, pluginManager, path, constraint)
 				if err != nil {
 					return err
 				}
-				item.Repositories[name] = util.JoinGoPackageVersion(path, version)
+				item.Repositories[name] = util.JoinGoPackageVersion(path, commitId)
+				setRepositoryRef(item, name, constraint)
+				cleanable = true
+				continue
+			}
+			if _, ok := pluginmanager.ParseGitRef(version); ok {
+				progress.SetSuffix("query %s version of %s", version, path)
+				commitId, err := pluginManager.GetGitRepoLatestVersion(ctx, path, version)
+				if err != nil {
+					return err
+				}
+				item.Repositories[name] = util.JoinGoPackageVersion(path, commitId)
+				// the tracked branch or tag is recorded to be upgraded later
+				if version != "latest" {
+					setRepositoryRef(item, name, version)
+				}
 				cleanable = true
 			}
 		}
 		for name, pkg := range item.Plugins {
-			path, version, ok := util.SplitGoPackageVersion(pkg)
-			if !ok {
-				return errors.Errorf("invalid package format: %s, should be in path@version format", pkg)
+			source, err := pluginmanager.ParsePluginSource(pkg)
+			if err != nil {
+				return err
+			}
+			// the local plugins have no version
+			if source.Kind != pluginmanager.PluginSourceGo {
+				continue
+			}
+			path, version := source.Path, source.Version
+			if constraint := version; util.IsVersionConstraint(constraint) {
+				progress.SetSuffix("resolve %s of %s", constraint, path)
+				version, err := resolvePluginConstraint(ctx, pluginManager, path, constraint)
+				if err != nil {
+					return err
+				}
+				item.Plugins[name] = util.JoinGoPackageVersion(path, version)
+				if item.PluginConstraints == nil {
+					item.PluginConstraints = map[string]string{}
+				}
+				item.PluginConstraints[name] = constraint
+				cleanable = true
+				continue
 			}
-			if version == "latest" {
+			if version == "latest" || version == consts.VersionLatestPrerelease {
 				progress.SetSuffix("query latest version of %s", path)
-				version, err := pluginManager.GetPluginLatestVersion(ctx, path)
+				version, err := pluginManager.GetPluginLatestVersion(ctx, path, version == consts.VersionLatestPrerelease)
 				if err != nil {
 					return err
 				}
@@ -135,3 +214,90 @@ func StepTidyConfigFile(ctx context.Context,
 	progress.SetSuffix("config file tidied: %s", configFilePath)
 	return nil
 }
+
+// StepCheckRetractedPlugins is used to warn the go plugins pinned in config file
+// whose versions have been retracted by the authors of module
+func StepCheckRetractedPlugins(ctx context.Context,
+	pluginManager pluginmanager.PluginManager,
+	log logger.Logger,
+	configFilePath string,
+) error {
+	configItems, err := configs.LoadConfigs(configFilePath)
+	if err != nil {
+		return err
+	}
+	checked := map[string]struct{}{}
+	for _, item := range configItems {
+		for _, pkg := range item.Plugins {
+			source, err := pluginmanager.ParsePluginSource(pkg)
+			if err != nil {
+				return err
+			}
+			// the versions not resolved by tidy are never pinned
+			if source.Kind != pluginmanager.PluginSourceGo || source.Version == "latest" ||
+				source.Version == consts.VersionLatestPrerelease || util.IsVersionConstraint(source.Version) {
+				continue
+			}
+			if _, ok := checked[pkg]; ok {
+				continue
+			}
+			checked[pkg] = struct{}{}
+			rationales, err := pluginManager.GetPluginRetraction(ctx, source.Path, source.Version)
+			if err != nil {
+				log.LogWarn(nil, "failed to check whether %s is retracted: %s", pkg, err)
+				continue
+			}
+			if len(rationales) != 0 {
+				log.LogWarn(nil, "%s has been retracted by the module author: %s", pkg, strings.Join(rationales, "; "))
+			}
+		}
+	}
+	return nil
+}
+
+// setRepositoryRef is used to record the branch, tag or version constraint that the repository is resolved from
+func setRepositoryRef(item *configs.Config, name string, ref string) {
+	if item.RepositoryRefs == nil {
+		item.RepositoryRefs = map[string]string{}
+	}
+	item.RepositoryRefs[name] = ref
+}
+
+// resolveProtocConstraint is used to get the newest release of protoc satisfying the constraint
+func resolveProtocConstraint(ctx context.Context, pluginManager pluginmanager.PluginManager, constraint string) (string, error) {
+	versions, err := pluginManager.ListProtocVersions(ctx)
+	if err != nil {
+		return "", err
+	}
+	version, err := util.ResolveVersionConstraint(constraint, versions)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to resolve version of protoc")
+	}
+	return version, nil
+}
+
+// resolvePluginConstraint is used to get the newest version of plugin or go module satisfying the constraint
+func resolvePluginConstraint(ctx context.Context, pluginManager pluginmanager.PluginManager, path string, constraint string) (string, error) {
+	versions, err := pluginManager.ListPluginVersions(ctx, path)
+	if err != nil {
+		return "", err
+	}
+	version, err := util.ResolveVersionConstraint(constraint, versions)
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to resolve version of %s", path)
+	}
+	return version, nil
+}
+
+// resolveGitRepoConstraint is used to get the commit of the newest tag of git repo satisfying the constraint
+func resolveGitRepoConstraint(ctx context.Context, pluginManager pluginmanager.PluginManager, uri string, constraint string) (string, error) {
+	tags, err := pluginManager.ListGitRepoTags(ctx, uri)
+	if err != nil {
+		return "", err
+	}
+	tag, err := util.ResolveVersionConstraint(constraint, tags)
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to resolve version of %s", uri)
+	}
+	return pluginManager.GetGitRepoLatestVersion(ctx, uri, configs.RepositoryRefTagPrefix+tag)
+}
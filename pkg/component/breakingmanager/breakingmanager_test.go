@@ -0,0 +1,154 @@
+// Copyright 2021 storyicon@foxmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package breakingmanager_test
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/descriptorpb"
+
+	"github.com/storyicon/powerproto/pkg/component/breakingmanager"
+	"github.com/storyicon/powerproto/pkg/configs"
+	"github.com/storyicon/powerproto/pkg/util/diagnostic"
+	"github.com/storyicon/powerproto/pkg/util/logger"
+)
+
+func newFile(pkg string, fields []*descriptorpb.FieldDescriptorProto, methods []*descriptorpb.MethodDescriptorProto) *breakingmanager.File {
+	return &breakingmanager.File{
+		Path: "/apis/greeter.proto",
+		Descriptor: &descriptorpb.FileDescriptorProto{
+			Name:    proto.String("apis/greeter.proto"),
+			Package: proto.String(pkg),
+			MessageType: []*descriptorpb.DescriptorProto{
+				{
+					Name:  proto.String("HelloRequest"),
+					Field: fields,
+				},
+			},
+			Service: []*descriptorpb.ServiceDescriptorProto{
+				{
+					Name:   proto.String("Greeter"),
+					Method: methods,
+				},
+			},
+		},
+	}
+}
+
+func newField(name string, number int32, typ descriptorpb.FieldDescriptorProto_Type) *descriptorpb.FieldDescriptorProto {
+	return &descriptorpb.FieldDescriptorProto{
+		Name:   proto.String(name),
+		Number: proto.Int32(number),
+		Type:   typ.Enum(),
+		Label:  descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+	}
+}
+
+func newMethod(name string) *descriptorpb.MethodDescriptorProto {
+	return &descriptorpb.MethodDescriptorProto{
+		Name:       proto.String(name),
+		InputType:  proto.String(".greeter.HelloRequest"),
+		OutputType: proto.String(".greeter.HelloRequest"),
+	}
+}
+
+func getRules(diagnostics []*diagnostic.Diagnostic) []string {
+	var rules []string
+	for _, item := range diagnostics {
+		rules = append(rules, item.Rule)
+	}
+	return rules
+}
+
+var _ = Describe("BreakingManager", func() {
+	manager, err := breakingmanager.NewBreakingManager(logger.NewDefault("breakingmanager"))
+	previous := newFile("greeter",
+		[]*descriptorpb.FieldDescriptorProto{
+			newField("name", 1, descriptorpb.FieldDescriptorProto_TYPE_STRING),
+			newField("age", 2, descriptorpb.FieldDescriptorProto_TYPE_INT32),
+			newField("email", 3, descriptorpb.FieldDescriptorProto_TYPE_STRING),
+		},
+		[]*descriptorpb.MethodDescriptorProto{newMethod("SayHello"), newMethod("SayGoodbye")},
+	)
+	current := newFile("greeter.v1",
+		[]*descriptorpb.FieldDescriptorProto{
+			newField("name", 1, descriptorpb.FieldDescriptorProto_TYPE_BYTES),
+			newField("age", 4, descriptorpb.FieldDescriptorProto_TYPE_INT32),
+		},
+		[]*descriptorpb.MethodDescriptorProto{newMethod("SayHello")},
+	)
+	newConfig := func(breaking *configs.BreakingConfig) configs.ConfigItem {
+		return configs.GetConfigItems([]*configs.Config{{Breaking: breaking}}, "/powerproto.yaml")[0]
+	}
+
+	It("should able to init", func() {
+		Expect(err).To(BeNil())
+		Expect(manager).To(Not(BeNil()))
+	})
+	It("should able to detect breaking changes", func() {
+		diagnostics, err := manager.Check(context.TODO(), newConfig(nil),
+			[]*breakingmanager.File{previous}, []*breakingmanager.File{current})
+		Expect(err).To(BeNil())
+		Expect(getRules(diagnostics)).To(ConsistOf(
+			breakingmanager.RuleFileSamePackage,
+			breakingmanager.RuleFieldSameType,
+			breakingmanager.RuleFieldSameNumber,
+			breakingmanager.RuleFieldNoDelete,
+			breakingmanager.RuleFieldNoDeleteUnlessNumberReserved,
+			breakingmanager.RuleRPCNoDelete,
+		))
+	})
+	It("should able to select categories and except rules", func() {
+		diagnostics, err := manager.Check(context.TODO(), newConfig(&configs.BreakingConfig{
+			Categories: []string{breakingmanager.CategoryWire},
+			Except:     []string{breakingmanager.RuleFileSamePackage},
+		}), []*breakingmanager.File{previous}, []*breakingmanager.File{current})
+		Expect(err).To(BeNil())
+		Expect(getRules(diagnostics)).To(ConsistOf(
+			breakingmanager.RuleFieldSameType,
+			breakingmanager.RuleFieldSameNumber,
+			breakingmanager.RuleFieldNoDeleteUnlessNumberReserved,
+			breakingmanager.RuleRPCNoDelete,
+		))
+	})
+	It("should able to accept reserved numbers", func() {
+		reserved := proto.Clone(previous.Descriptor).(*descriptorpb.FileDescriptorProto)
+		message := reserved.MessageType[0]
+		message.Field = message.Field[:2]
+		message.ReservedRange = []*descriptorpb.DescriptorProto_ReservedRange{
+			{Start: proto.Int32(3), End: proto.Int32(4)},
+		}
+		diagnostics, err := manager.Check(context.TODO(), newConfig(nil),
+			[]*breakingmanager.File{previous},
+			[]*breakingmanager.File{{Path: previous.Path, Descriptor: reserved}})
+		Expect(err).To(BeNil())
+		Expect(getRules(diagnostics)).To(ConsistOf(breakingmanager.RuleFieldNoDelete))
+	})
+	It("should able to detect deleted files", func() {
+		diagnostics, err := manager.Check(context.TODO(), newConfig(nil),
+			[]*breakingmanager.File{previous}, nil)
+		Expect(err).To(BeNil())
+		Expect(getRules(diagnostics)).To(ConsistOf(breakingmanager.RuleFileNoDelete))
+	})
+	It("should reject unknown rules", func() {
+		_, err := manager.Check(context.TODO(), newConfig(&configs.BreakingConfig{
+			Except: []string{"UNKNOWN_RULE"},
+		}), nil, nil)
+		Expect(err).To(Not(BeNil()))
+	})
+})
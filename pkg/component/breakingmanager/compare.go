@@ -0,0 +1,249 @@
+// Copyright 2021 storyicon@foxmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package breakingmanager
+
+import (
+	"fmt"
+	"strings"
+
+	"google.golang.org/protobuf/types/descriptorpb"
+
+	"github.com/storyicon/powerproto/pkg/util/descriptor"
+)
+
+// finding is a breaking change found in the current file
+type finding struct {
+	rule    string
+	path    []int32
+	message string
+}
+
+// comparer is used to compare the previous and the current version of a proto file
+type comparer struct {
+	current  *descriptorpb.FileDescriptorProto
+	findings []*finding
+}
+
+func (c *comparer) add(rule string, path []int32, format string, args ...interface{}) {
+	c.findings = append(c.findings, &finding{
+		rule:    rule,
+		path:    path,
+		message: fmt.Sprintf(format, args...),
+	})
+}
+
+func compareFiles(previous, current *descriptorpb.FileDescriptorProto) []*finding {
+	c := &comparer{current: current}
+	if previous.GetPackage() != current.GetPackage() {
+		c.add(RuleFileSamePackage, []int32{descriptor.FilePackageTag},
+			"package changed from %q to %q", previous.GetPackage(), current.GetPackage())
+	}
+	c.compareMessages(nil, descriptor.FileMessageTypeTag, previous.GetMessageType(), current.GetMessageType())
+	c.compareEnums(nil, descriptor.FileEnumTypeTag, previous.GetEnumType(), current.GetEnumType())
+	c.compareServices(previous.GetService(), current.GetService())
+	return c.findings
+}
+
+func (c *comparer) compareMessages(parent []int32, tag int32,
+	previous, current []*descriptorpb.DescriptorProto) {
+	indexes := map[string]int{}
+	for i, message := range current {
+		indexes[message.GetName()] = i
+	}
+	for _, message := range previous {
+		i, ok := indexes[message.GetName()]
+		if !ok {
+			c.add(RuleMessageNoDelete, parent, "message %q was deleted", message.GetName())
+			continue
+		}
+		c.compareMessage(descriptor.JoinPath(parent, tag, int32(i)), message, current[i])
+	}
+}
+
+func (c *comparer) compareMessage(path []int32, previous, current *descriptorpb.DescriptorProto) {
+	byNumber := map[int32]int{}
+	byName := map[string]int{}
+	for i, field := range current.GetField() {
+		byNumber[field.GetNumber()] = i
+		byName[field.GetName()] = i
+	}
+	for _, field := range previous.GetField() {
+		i, ok := byNumber[field.GetNumber()]
+		if !ok {
+			if j, ok := byName[field.GetName()]; ok {
+				c.add(RuleFieldSameNumber,
+					descriptor.JoinPath(path, descriptor.MessageFieldTag, int32(j), descriptor.FieldNumberTag),
+					"field %q on message %q changed number from %d to %d",
+					field.GetName(), current.GetName(), field.GetNumber(), current.GetField()[j].GetNumber())
+				continue
+			}
+			c.add(RuleFieldNoDelete, path,
+				"field %d (%q) on message %q was deleted", field.GetNumber(), field.GetName(), current.GetName())
+			if !isNumberReserved(current, field.GetNumber()) {
+				c.add(RuleFieldNoDeleteUnlessNumberReserved, path,
+					"field %d (%q) on message %q was deleted without reserving the number",
+					field.GetNumber(), field.GetName(), current.GetName())
+			}
+			continue
+		}
+		fieldPath := descriptor.JoinPath(path, descriptor.MessageFieldTag, int32(i))
+		c.compareField(fieldPath, current.GetName(), field, current.GetField()[i])
+	}
+	c.compareMessages(path, descriptor.MessageNestedTypeTag, previous.GetNestedType(), current.GetNestedType())
+	c.compareEnums(path, descriptor.MessageEnumTypeTag, previous.GetEnumType(), current.GetEnumType())
+}
+
+func (c *comparer) compareField(path []int32, message string, previous, current *descriptorpb.FieldDescriptorProto) {
+	if previous.GetName() != current.GetName() {
+		c.add(RuleFieldSameName, descriptor.JoinPath(path, descriptor.FieldNameTag),
+			"field %d on message %q changed name from %q to %q",
+			current.GetNumber(), message, previous.GetName(), current.GetName())
+	}
+	if previous.GetType() != current.GetType() || previous.GetTypeName() != current.GetTypeName() {
+		c.add(RuleFieldSameType, descriptor.JoinPath(path, descriptor.FieldTypeTag),
+			"field %d (%q) on message %q changed type from %q to %q",
+			current.GetNumber(), current.GetName(), message, fieldTypeString(previous), fieldTypeString(current))
+	}
+	if previous.GetLabel() != current.GetLabel() {
+		c.add(RuleFieldSameLabel, descriptor.JoinPath(path, descriptor.FieldLabelTag),
+			"field %d (%q) on message %q changed label from %q to %q",
+			current.GetNumber(), current.GetName(), message, labelString(previous), labelString(current))
+	}
+}
+
+func (c *comparer) compareEnums(parent []int32, tag int32,
+	previous, current []*descriptorpb.EnumDescriptorProto) {
+	indexes := map[string]int{}
+	for i, enum := range current {
+		indexes[enum.GetName()] = i
+	}
+	for _, enum := range previous {
+		i, ok := indexes[enum.GetName()]
+		if !ok {
+			c.add(RuleEnumNoDelete, parent, "enum %q was deleted", enum.GetName())
+			continue
+		}
+		c.compareEnum(descriptor.JoinPath(parent, tag, int32(i)), enum, current[i])
+	}
+}
+
+func (c *comparer) compareEnum(path []int32, previous, current *descriptorpb.EnumDescriptorProto) {
+	byNumber := map[int32]int{}
+	byName := map[string]int{}
+	for i, value := range current.GetValue() {
+		// the first value wins when aliases are allowed
+		if _, exists := byNumber[value.GetNumber()]; !exists {
+			byNumber[value.GetNumber()] = i
+		}
+		byName[value.GetName()] = i
+	}
+	for _, value := range previous.GetValue() {
+		i, ok := byNumber[value.GetNumber()]
+		if !ok {
+			if j, ok := byName[value.GetName()]; ok {
+				c.add(RuleEnumValueSameNumber, descriptor.JoinPath(path, descriptor.EnumValueTag, int32(j)),
+					"enum value %q on enum %q changed number from %d to %d",
+					value.GetName(), current.GetName(), value.GetNumber(), current.GetValue()[j].GetNumber())
+				continue
+			}
+			c.add(RuleEnumValueNoDelete, path,
+				"enum value %d (%q) on enum %q was deleted", value.GetNumber(), value.GetName(), current.GetName())
+			continue
+		}
+		if _, ok := byName[value.GetName()]; !ok {
+			c.add(RuleEnumValueSameName, descriptor.JoinPath(path, descriptor.EnumValueTag, int32(i)),
+				"enum value %d on enum %q changed name from %q to %q",
+				value.GetNumber(), current.GetName(), value.GetName(), current.GetValue()[i].GetName())
+		}
+	}
+}
+
+func (c *comparer) compareServices(previous, current []*descriptorpb.ServiceDescriptorProto) {
+	indexes := map[string]int{}
+	for i, service := range current {
+		indexes[service.GetName()] = i
+	}
+	for _, service := range previous {
+		i, ok := indexes[service.GetName()]
+		if !ok {
+			c.add(RuleServiceNoDelete, nil, "service %q was deleted", service.GetName())
+			continue
+		}
+		path := []int32{descriptor.FileServiceTag, int32(i)}
+		c.compareMethods(path, current[i].GetName(), service.GetMethod(), current[i].GetMethod())
+	}
+}
+
+func (c *comparer) compareMethods(path []int32, service string,
+	previous, current []*descriptorpb.MethodDescriptorProto) {
+	indexes := map[string]int{}
+	for i, method := range current {
+		indexes[method.GetName()] = i
+	}
+	for _, method := range previous {
+		i, ok := indexes[method.GetName()]
+		if !ok {
+			c.add(RuleRPCNoDelete, path, "rpc %q on service %q was deleted", method.GetName(), service)
+			continue
+		}
+		cur := current[i]
+		methodPath := descriptor.JoinPath(path, descriptor.ServiceMethodTag, int32(i))
+		if method.GetInputType() != cur.GetInputType() {
+			c.add(RuleRPCSameRequestType, descriptor.JoinPath(methodPath, descriptor.MethodInputTypeTag),
+				"rpc %q on service %q changed request type from %q to %q",
+				cur.GetName(), service, trimTypeName(method.GetInputType()), trimTypeName(cur.GetInputType()))
+		}
+		if method.GetOutputType() != cur.GetOutputType() {
+			c.add(RuleRPCSameResponseType, descriptor.JoinPath(methodPath, descriptor.MethodOutputTypeTag),
+				"rpc %q on service %q changed response type from %q to %q",
+				cur.GetName(), service, trimTypeName(method.GetOutputType()), trimTypeName(cur.GetOutputType()))
+		}
+		if method.GetClientStreaming() != cur.GetClientStreaming() {
+			c.add(RuleRPCSameClientStreaming, methodPath,
+				"rpc %q on service %q changed client streaming from %t to %t",
+				cur.GetName(), service, method.GetClientStreaming(), cur.GetClientStreaming())
+		}
+		if method.GetServerStreaming() != cur.GetServerStreaming() {
+			c.add(RuleRPCSameServerStreaming, methodPath,
+				"rpc %q on service %q changed server streaming from %t to %t",
+				cur.GetName(), service, method.GetServerStreaming(), cur.GetServerStreaming())
+		}
+	}
+}
+
+func isNumberReserved(message *descriptorpb.DescriptorProto, number int32) bool {
+	for _, reserved := range message.GetReservedRange() {
+		// the end of reserved range is exclusive
+		if number >= reserved.GetStart() && number < reserved.GetEnd() {
+			return true
+		}
+	}
+	return false
+}
+
+func fieldTypeString(field *descriptorpb.FieldDescriptorProto) string {
+	if name := field.GetTypeName(); name != "" {
+		return trimTypeName(name)
+	}
+	return strings.ToLower(strings.TrimPrefix(field.GetType().String(), "TYPE_"))
+}
+
+func labelString(field *descriptorpb.FieldDescriptorProto) string {
+	return strings.ToLower(strings.TrimPrefix(field.GetLabel().String(), "LABEL_"))
+}
+
+func trimTypeName(name string) string {
+	return strings.TrimPrefix(name, ".")
+}
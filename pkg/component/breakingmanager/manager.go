@@ -0,0 +1,141 @@
+// Copyright 2021 storyicon@foxmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package breakingmanager
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+	"google.golang.org/protobuf/types/descriptorpb"
+
+	"github.com/storyicon/powerproto/pkg/configs"
+	"github.com/storyicon/powerproto/pkg/util"
+	"github.com/storyicon/powerproto/pkg/util/descriptor"
+	"github.com/storyicon/powerproto/pkg/util/diagnostic"
+	"github.com/storyicon/powerproto/pkg/util/logger"
+)
+
+// File defines a compiled proto file
+type File struct {
+	// Path is the local path of the proto file in the current tree.
+	// For the files of baseline, it is the path where it should be in the current tree
+	Path       string
+	Descriptor *descriptorpb.FileDescriptorProto
+}
+
+// BreakingManager is used to detect breaking changes
+type BreakingManager interface {
+	// Check is used to check the breaking changes from previous files to current files
+	Check(ctx context.Context, config configs.ConfigItem, previous []*File, current []*File) ([]*diagnostic.Diagnostic, error)
+}
+
+// NewBreakingManager is used to create BreakingManager
+func NewBreakingManager(log logger.Logger) (BreakingManager, error) {
+	return NewBasicBreakingManager(log)
+}
+
+// BasicBreakingManager is the basic implement of BreakingManager
+type BasicBreakingManager struct {
+	logger.Logger
+}
+
+var _ BreakingManager = &BasicBreakingManager{}
+
+// NewBasicBreakingManager is used to create a basic BreakingManager
+func NewBasicBreakingManager(log logger.Logger) (*BasicBreakingManager, error) {
+	return &BasicBreakingManager{
+		Logger: log.NewLogger("breakingmanager"),
+	}, nil
+}
+
+// Check is used to check the breaking changes from previous files to current files
+func (b *BasicBreakingManager) Check(ctx context.Context,
+	config configs.ConfigItem,
+	previous []*File, current []*File) ([]*diagnostic.Diagnostic, error) {
+	enabled, err := GetEnabledRules(config.Config().Breaking)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid breaking config in %s", config.Path())
+	}
+	files := map[string]*File{}
+	for _, file := range current {
+		files[file.Descriptor.GetName()] = file
+	}
+	var diagnostics []*diagnostic.Diagnostic
+	for _, prev := range previous {
+		cur, ok := files[prev.Descriptor.GetName()]
+		if !ok {
+			if _, ok := enabled[RuleFileNoDelete]; ok {
+				diagnostics = append(diagnostics, &diagnostic.Diagnostic{
+					Path:    prev.Path,
+					Line:    1,
+					Column:  1,
+					Rule:    RuleFileNoDelete,
+					Message: "file " + prev.Descriptor.GetName() + " was deleted",
+				})
+			}
+			continue
+		}
+		for _, item := range compareFiles(prev.Descriptor, cur.Descriptor) {
+			if _, ok := enabled[item.rule]; !ok {
+				continue
+			}
+			line, column := descriptor.GetPosition(cur.Descriptor, item.path)
+			diagnostics = append(diagnostics, &diagnostic.Diagnostic{
+				Path:    cur.Path,
+				Line:    line,
+				Column:  column,
+				Rule:    item.rule,
+				Message: item.message,
+			})
+		}
+	}
+	diagnostic.Sort(diagnostics)
+	return diagnostics, nil
+}
+
+// GetEnabledRules is used to get the set of rules enabled by config
+func GetEnabledRules(cfg *configs.BreakingConfig) (map[string]struct{}, error) {
+	categories := Categories
+	var except []string
+	if cfg != nil {
+		if len(cfg.Categories) != 0 {
+			categories = cfg.Categories
+		}
+		except = cfg.Except
+	}
+	for _, category := range categories {
+		if !util.Contains(Categories, category) {
+			return nil, errors.Errorf("unknown category: %s, should be one of %s", category, Categories)
+		}
+	}
+	for _, name := range except {
+		if _, ok := GetRule(name); !ok {
+			return nil, errors.Errorf("unknown rule: %s", name)
+		}
+	}
+	enabled := map[string]struct{}{}
+	for _, rule := range Rules {
+		if util.Contains(except, rule.Name) {
+			continue
+		}
+		for _, category := range rule.Categories {
+			if util.Contains(categories, category) {
+				enabled[rule.Name] = struct{}{}
+				break
+			}
+		}
+	}
+	return enabled, nil
+}
@@ -0,0 +1,169 @@
+// Copyright 2021 storyicon@foxmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package breakingmanager
+
+// defines the rule categories
+const (
+	// CategoryWire contains the rules that break the binary encoding
+	// or the rpc paths, so old clients can not talk to new servers
+	CategoryWire = "WIRE"
+	// CategorySource contains the rules that break the generated code
+	CategorySource = "SOURCE"
+)
+
+// defines the rules of breaking change detection
+const (
+	RuleFileNoDelete                      = "FILE_NO_DELETE"
+	RuleFileSamePackage                   = "FILE_SAME_PACKAGE"
+	RuleMessageNoDelete                   = "MESSAGE_NO_DELETE"
+	RuleFieldNoDelete                     = "FIELD_NO_DELETE"
+	RuleFieldNoDeleteUnlessNumberReserved = "FIELD_NO_DELETE_UNLESS_NUMBER_RESERVED"
+	RuleFieldSameNumber                   = "FIELD_SAME_NUMBER"
+	RuleFieldSameName                     = "FIELD_SAME_NAME"
+	RuleFieldSameType                     = "FIELD_SAME_TYPE"
+	RuleFieldSameLabel                    = "FIELD_SAME_LABEL"
+	RuleEnumNoDelete                      = "ENUM_NO_DELETE"
+	RuleEnumValueNoDelete                 = "ENUM_VALUE_NO_DELETE"
+	RuleEnumValueSameNumber               = "ENUM_VALUE_SAME_NUMBER"
+	RuleEnumValueSameName                 = "ENUM_VALUE_SAME_NAME"
+	RuleServiceNoDelete                   = "SERVICE_NO_DELETE"
+	RuleRPCNoDelete                       = "RPC_NO_DELETE"
+	RuleRPCSameRequestType                = "RPC_SAME_REQUEST_TYPE"
+	RuleRPCSameResponseType               = "RPC_SAME_RESPONSE_TYPE"
+	RuleRPCSameClientStreaming            = "RPC_SAME_CLIENT_STREAMING"
+	RuleRPCSameServerStreaming            = "RPC_SAME_SERVER_STREAMING"
+)
+
+// Categories defines all the categories
+var Categories = []string{
+	CategoryWire,
+	CategorySource,
+}
+
+// Rule defines the rule of breaking change detection
+type Rule struct {
+	Name        string
+	Categories  []string
+	Description string
+}
+
+// Rules defines all the rules
+var Rules = []*Rule{
+	{
+		Name:        RuleFileNoDelete,
+		Categories:  []string{CategorySource},
+		Description: "proto files can not be deleted",
+	},
+	{
+		Name:        RuleFileSamePackage,
+		Categories:  []string{CategoryWire, CategorySource},
+		Description: "the package of proto file can not be changed",
+	},
+	{
+		Name:        RuleMessageNoDelete,
+		Categories:  []string{CategorySource},
+		Description: "messages can not be deleted",
+	},
+	{
+		Name:        RuleFieldNoDelete,
+		Categories:  []string{CategorySource},
+		Description: "fields can not be deleted",
+	},
+	{
+		Name:        RuleFieldNoDeleteUnlessNumberReserved,
+		Categories:  []string{CategoryWire},
+		Description: "fields can not be deleted unless the number is reserved",
+	},
+	{
+		Name:        RuleFieldSameNumber,
+		Categories:  []string{CategoryWire},
+		Description: "the number of field can not be changed",
+	},
+	{
+		Name:        RuleFieldSameName,
+		Categories:  []string{CategorySource},
+		Description: "the name of field can not be changed",
+	},
+	{
+		Name:        RuleFieldSameType,
+		Categories:  []string{CategoryWire, CategorySource},
+		Description: "the type of field can not be changed",
+	},
+	{
+		Name:        RuleFieldSameLabel,
+		Categories:  []string{CategoryWire, CategorySource},
+		Description: "the label (optional, required, repeated) of field can not be changed",
+	},
+	{
+		Name:        RuleEnumNoDelete,
+		Categories:  []string{CategorySource},
+		Description: "enums can not be deleted",
+	},
+	{
+		Name:        RuleEnumValueNoDelete,
+		Categories:  []string{CategorySource},
+		Description: "enum values can not be deleted",
+	},
+	{
+		Name:        RuleEnumValueSameNumber,
+		Categories:  []string{CategoryWire},
+		Description: "the number of enum value can not be changed",
+	},
+	{
+		Name:        RuleEnumValueSameName,
+		Categories:  []string{CategorySource},
+		Description: "the name of enum value can not be changed",
+	},
+	{
+		Name:        RuleServiceNoDelete,
+		Categories:  []string{CategoryWire, CategorySource},
+		Description: "services can not be deleted",
+	},
+	{
+		Name:        RuleRPCNoDelete,
+		Categories:  []string{CategoryWire, CategorySource},
+		Description: "rpcs can not be deleted",
+	},
+	{
+		Name:        RuleRPCSameRequestType,
+		Categories:  []string{CategoryWire, CategorySource},
+		Description: "the request type of rpc can not be changed",
+	},
+	{
+		Name:        RuleRPCSameResponseType,
+		Categories:  []string{CategoryWire, CategorySource},
+		Description: "the response type of rpc can not be changed",
+	},
+	{
+		Name:        RuleRPCSameClientStreaming,
+		Categories:  []string{CategoryWire, CategorySource},
+		Description: "the client streaming of rpc can not be changed",
+	},
+	{
+		Name:        RuleRPCSameServerStreaming,
+		Categories:  []string{CategoryWire, CategorySource},
+		Description: "the server streaming of rpc can not be changed",
+	},
+}
+
+// GetRule is used to get rule by name
+func GetRule(name string) (*Rule, bool) {
+	for _, rule := range Rules {
+		if rule.Name == name {
+			return rule, true
+		}
+	}
+	return nil, false
+}
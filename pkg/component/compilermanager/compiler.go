@@ -17,9 +17,14 @@ package compilermanager
 import (
 	"context"
 	"fmt"
+	"io/ioutil"
+	"os"
 	"path/filepath"
+	"strings"
 
 	"github.com/pkg/errors"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/descriptorpb"
 
 	"github.com/storyicon/powerproto/pkg/component/pluginmanager"
 	"github.com/storyicon/powerproto/pkg/configs"
@@ -33,6 +38,9 @@ import (
 type Compiler interface {
 	// Compile is used to compile proto file
 	Compile(ctx context.Context, protoFilePath string) error
+	// BuildDescriptorSet is used to build the descriptor set of proto file,
+	// the imported files and source code info are included
+	BuildDescriptorSet(ctx context.Context, protoFilePath string) (*descriptorpb.FileDescriptorSet, error)
 	// GetConfig is used to return config that the compiler used
 	GetConfig(ctx context.Context) configs.ConfigItem
 }
@@ -88,18 +96,91 @@ func (b *BasicCompiler) Compile(ctx context.Context, protoFilePath string) error
 	if err != nil {
 		return &ErrCompile{
 			ErrCommandExec: err.(*command.ErrCommandExec),
+			ProtoFile:      protoFilePath,
 		}
 	}
 	return nil
 }
 
+// BuildDescriptorSet is used to build the descriptor set of proto file,
+// the imported files and source code info are included
+func (b *BasicCompiler) BuildDescriptorSet(ctx context.Context, protoFilePath string) (*descriptorpb.FileDescriptorSet, error) {
+	dir := b.calcDir()
+	protocPath, err := b.calcProtocPath(ctx)
+	if err != nil {
+		return nil, err
+	}
+	variables, err := b.calcVariables(ctx, protoFilePath)
+	if err != nil {
+		return nil, err
+	}
+	workspace, err := os.MkdirTemp("", "")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(workspace)
+
+	output := filepath.Join(workspace, "descriptor.pb")
+	arguments := b.calcImportPaths(variables)
+	arguments = append(arguments,
+		"--include_imports",
+		"--include_source_info",
+		"--descriptor_set_out="+output,
+		protoFilePath,
+	)
+	_, err = command.Execute(consts.WithIgnoreDryRun(ctx),
+		b.Logger, dir, protocPath, arguments, nil)
+	if err != nil {
+		return nil, &ErrCompile{
+			ErrCommandExec: err.(*command.ErrCommandExec),
+			ProtoFile:      protoFilePath,
+		}
+	}
+	data, err := ioutil.ReadFile(output)
+	if err != nil {
+		return nil, err
+	}
+	var set descriptorpb.FileDescriptorSet
+	if err := proto.Unmarshal(data, &set); err != nil {
+		return nil, errors.Wrapf(err, "failed to decode descriptor set of %s", protoFilePath)
+	}
+	return &set, nil
+}
+
 // GetConfig is used to return config that the compiler used
 func (b *BasicCompiler) GetConfig(ctx context.Context) configs.ConfigItem {
 	return b.config
 }
 
 func (b *BasicCompiler) calcProtocPath(ctx context.Context) (string, error) {
-	return  b.pluginManager.GetPathForProtoc(ctx, b.config.Config().Protoc)
+	protoc, err := b.getLocalProtoc(ctx)
+	if err != nil {
+		return "", err
+	}
+	if protoc != nil {
+		return protoc.Binary, nil
+	}
+	return b.pluginManager.GetPathForProtoc(ctx, b.config.Config().Protoc)
+}
+
+// getLocalProtoc is used to get the protoc not installed by PowerProto,
+// nil is returned if protoc is installed by PowerProto
+func (b *BasicCompiler) getLocalProtoc(ctx context.Context) (*pluginmanager.LocalProtoc, error) {
+	source, err := pluginmanager.ParseProtocSource(b.config.Config().Protoc)
+	if err != nil {
+		return nil, err
+	}
+	if source.Kind == pluginmanager.ProtocSourceRelease {
+		return nil, nil
+	}
+	var binary, include string
+	if source.Kind == pluginmanager.ProtocSourcePath {
+		binary = configs.ResolvePath(b.config, source.Path)
+	}
+	if dir := b.config.Config().ProtocInclude; dir != "" {
+		include = configs.ResolvePath(b.config, dir)
+	}
+	return b.pluginManager.GetLocalProtoc(ctx, binary, source.Version, include)
 }
 
 func (b *BasicCompiler) calcDir() string {
@@ -125,11 +206,7 @@ func (b *BasicCompiler) calcArguments(ctx context.Context, protoFilePath string)
 
 	// build plugin options
 	for name, pkg := range cfg.Config().Plugins {
-		path, version, ok := util.SplitGoPackageVersion(pkg)
-		if !ok {
-			return nil, errors.Errorf("failed to parse: %s", pkg)
-		}
-		local, err := b.pluginManager.GetPathForPlugin(ctx, path, version)
+		local, err := b.calcPluginPath(ctx, pkg)
 		if err != nil {
 			return nil, errors.Wrap(err, "failed to get plugin path")
 		}
@@ -144,6 +221,16 @@ func (b *BasicCompiler) calcArguments(ctx context.Context, protoFilePath string)
 	}
 
 	// build import paths
+	arguments = append(arguments, b.calcImportPaths(variables)...)
+
+	arguments = util.DeduplicateSliceStably(arguments)
+
+	return arguments, nil
+}
+
+func (b *BasicCompiler) calcImportPaths(variables map[string]string) []string {
+	cfg := b.config
+	var arguments []string
 	dir := filepath.Dir(cfg.Path())
 	for _, path := range cfg.Config().ImportPaths {
 		path = util.RenderPathWithEnv(path, variables)
@@ -152,30 +239,116 @@ func (b *BasicCompiler) calcArguments(ctx context.Context, protoFilePath string)
 		}
 		arguments = append(arguments, "--proto_path="+path)
 	}
+	return util.DeduplicateSliceStably(arguments)
+}
 
-	arguments = util.DeduplicateSliceStably(arguments)
+// calcPluginPath is used to get the path of plugin executable file,
+// the local plugin and the plugin replaced by local directory are built from sources
+func (b *BasicCompiler) calcPluginPath(ctx context.Context, pkg string) (string, error) {
+	source, err := pluginmanager.ParsePluginSource(pkg)
+	if err != nil {
+		return "", err
+	}
+	switch source.Kind {
+	case pluginmanager.PluginSourcePath:
+		return configs.ResolvePath(b.config, source.Path), nil
+	case pluginmanager.PluginSourceLocal:
+		dir, rel, err := pluginmanager.FindGoModule(configs.ResolvePath(b.config, source.Path))
+		if err != nil {
+			return "", err
+		}
+		return b.pluginManager.InstallLocalPlugin(ctx, dir, rel)
+	}
+	if dir, rel, ok := configs.GetReplaceDir(b.config, source.Path); ok {
+		return b.pluginManager.InstallLocalPlugin(ctx, dir, rel)
+	}
+	return b.pluginManager.GetPathForPlugin(ctx, source.Path, source.Version)
+}
 
-	return arguments, nil
+// calcRepositoryPath is used to get the local directory of repository referenced by variable.
+// The directory points to the root of proto files when the root of repository is configured,
+// otherwise the git repository is in the <host>/<path> of it
+func (b *BasicCompiler) calcRepositoryPath(ctx context.Context, name string, pkg string) (string, error) {
+	cfg := b.config
+	source, err := pluginmanager.ParseRepositorySource(pkg)
+	if err != nil {
+		return "", err
+	}
+	var root string
+	if repoConfig := cfg.Config().GetRepositoryConfig(name); repoConfig != nil && repoConfig.Root != "" {
+		root = filepath.ToSlash(filepath.Clean(repoConfig.Root))
+		if filepath.IsAbs(repoConfig.Root) || root == ".." || strings.HasPrefix(root, "../") {
+			return "", errors.Errorf("invalid root of repository %s: %s", name, repoConfig.Root)
+		}
+	}
+	// the local directory is used directly
+	if dir, rel, ok := configs.GetReplaceDir(cfg, source.URI); ok && rel == "." {
+		// the local directory can not provide the <host>/<path> layout of the cached git repository,
+		// so the import paths written for the cache would not be resolved in it
+		if root == "" && source.Kind == pluginmanager.RepositorySourceGit {
+			return "", errors.Errorf("repository %s is replaced by %s, its root should be configured in repositoryConfigs, "+
+				"e.g. root: '.', so that $%s points to the same directory in cache and in the local directory", name, dir, name)
+		}
+		return filepath.Join(dir, filepath.FromSlash(root)), nil
+	}
+	include := cfg.Config().GetRepositoryInclude(name)
+	switch source.Kind {
+	case pluginmanager.RepositorySourceArchive:
+		repoPath, err := b.pluginManager.ArchiveRepoPath(ctx, source.URI, source.Version, include)
+		if err != nil {
+			return "", err
+		}
+		return filepath.Join(repoPath, filepath.FromSlash(root)), nil
+	case pluginmanager.RepositorySourceGoModule:
+		module, err := b.pluginManager.GetGoModule(ctx, source.URI, source.Version)
+		if err != nil {
+			return "", err
+		}
+		return filepath.Join(module.Dir, filepath.FromSlash(root)), nil
+	}
+	path, version := source.URI, source.Version
+	if _, ok := pluginmanager.ParseGitRef(version); ok {
+		commitId, err := b.pluginManager.GetGitRepoLatestVersion(ctx, path, version)
+		if err != nil {
+			return "", err
+		}
+		version = commitId
+	}
+	repoPath, err := b.pluginManager.GitRepoPath(ctx, path, version, include)
+	if err != nil {
+		return "", err
+	}
+	if root == "" {
+		return repoPath, nil
+	}
+	repoName, err := pluginmanager.GetGitRepoName(path)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(repoPath, filepath.FromSlash(repoName), filepath.FromSlash(root)), nil
 }
 
 func (b *BasicCompiler) calcVariables(ctx context.Context, protoFilePath string) (map[string]string, error) {
 	cfg := b.config
 	variables := map[string]string{}
 	for name, pkg := range cfg.Config().Repositories {
-		_, version, ok := util.SplitGoPackageVersion(pkg)
-		if !ok {
-			return nil, errors.Errorf("failed to parse: %s", pkg)
-		}
-		repoPath, err := b.pluginManager.GitRepoPath(ctx, version)
+		repoPath, err := b.calcRepositoryPath(ctx, name, pkg)
 		if err != nil {
 			return nil, err
 		}
 		variables[name] = repoPath
 	}
-	includePath, err := b.pluginManager.IncludePath(ctx)
+	includePath, err := b.pluginManager.IncludePath(ctx, cfg.Config().Protoc)
 	if err != nil {
 		return nil, err
 	}
+	protoc, err := b.getLocalProtoc(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if protoc != nil && protoc.IncludeDir != "" {
+		includePath = protoc.IncludeDir
+	}
 	variables[consts.KeyNamePowerProtocInclude] = includePath
 	variables[consts.KeyNameSourceRelative] = filepath.Dir(protoFilePath)
 	return variables, nil
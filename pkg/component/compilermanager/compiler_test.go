@@ -0,0 +1,113 @@
+// Copyright 2021 storyicon@foxmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package compilermanager
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/storyicon/powerproto/pkg/component/pluginmanager"
+	"github.com/storyicon/powerproto/pkg/configs"
+	"github.com/storyicon/powerproto/pkg/util/logger"
+)
+
+var _ = Describe("Compiler", func() {
+	const uri = "https://github.com/googleapis/googleapis"
+	const commitId = "27156597fdf4fb77004434d4409154a230dc9a32"
+	var storageDir string
+	var compiler *BasicCompiler
+	newCompiler := func(config *configs.Config) {
+		config.Repositories = map[string]string{
+			"GOOGLE_APIS": uri + "@" + commitId,
+		}
+		cfg := pluginmanager.NewConfig()
+		cfg.StorageDir = storageDir
+		pluginManager, err := pluginmanager.NewBasicPluginManager(cfg, logger.NewDefault("pluginmanager"))
+		Expect(err).To(BeNil())
+		item := configs.GetConfigItems([]*configs.Config{config}, "/project/powerproto.yaml")[0]
+		compiler, err = NewBasicCompiler(context.TODO(), logger.NewDefault("compiler"), pluginManager, item)
+		Expect(err).To(BeNil())
+	}
+	BeforeEach(func() {
+		var err error
+		storageDir, err = ioutil.TempDir("", "powerproto-compiler")
+		Expect(err).To(BeNil())
+	})
+	AfterEach(func() {
+		os.RemoveAll(storageDir)
+	})
+
+	It("should point to the directory containing the repository by default", func() {
+		newCompiler(&configs.Config{})
+		repoPath, err := compiler.calcRepositoryPath(context.TODO(), "GOOGLE_APIS", uri+"@"+commitId)
+		Expect(err).To(BeNil())
+		Expect(repoPath).To(Equal(filepath.Join(storageDir, "gits", "github.com", "googleapis", "googleapis@"+commitId)))
+	})
+	It("should not change the layout when only include is configured", func() {
+		include := []string{"**/*.proto"}
+		newCompiler(&configs.Config{
+			RepositoryConfigs: map[string]*configs.RepositoryConfig{
+				"GOOGLE_APIS": {Include: include},
+			},
+		})
+		repoPath, err := compiler.calcRepositoryPath(context.TODO(), "GOOGLE_APIS", uri+"@"+commitId)
+		Expect(err).To(BeNil())
+		expected, err := pluginmanager.PathForGitRepos(storageDir, uri, commitId, include)
+		Expect(err).To(BeNil())
+		Expect(repoPath).To(Equal(expected))
+	})
+	It("should point to the root when it is configured", func() {
+		newCompiler(&configs.Config{
+			RepositoryConfigs: map[string]*configs.RepositoryConfig{
+				"GOOGLE_APIS": {Root: "."},
+			},
+		})
+		repoPath, err := compiler.calcRepositoryPath(context.TODO(), "GOOGLE_APIS", uri+"@"+commitId)
+		Expect(err).To(BeNil())
+		expected, err := pluginmanager.PathForGitReposCode(storageDir, uri, commitId, nil)
+		Expect(err).To(BeNil())
+		Expect(repoPath).To(Equal(expected))
+	})
+	It("should point to the root in the local directory replacing the repository", func() {
+		newCompiler(&configs.Config{
+			RepositoryConfigs: map[string]*configs.RepositoryConfig{
+				"GOOGLE_APIS": {Root: "google"},
+			},
+			Replace: map[string]string{
+				uri: "../googleapis",
+			},
+		})
+		repoPath, err := compiler.calcRepositoryPath(context.TODO(), "GOOGLE_APIS", uri+"@"+commitId)
+		Expect(err).To(BeNil())
+		Expect(repoPath).To(Equal(filepath.Join("/googleapis", "google")))
+	})
+	It("should reject the local directory replacing the repository without root", func() {
+		newCompiler(&configs.Config{
+			RepositoryConfigs: map[string]*configs.RepositoryConfig{
+				"GOOGLE_APIS": {Include: []string{"**/*.proto"}},
+			},
+			Replace: map[string]string{
+				uri: "../googleapis",
+			},
+		})
+		_, err := compiler.calcRepositoryPath(context.TODO(), "GOOGLE_APIS", uri+"@"+commitId)
+		Expect(err).To(Not(BeNil()))
+	})
+})
@@ -0,0 +1,85 @@
+// Copyright 2021 storyicon@foxmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package compilermanager_test
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/storyicon/powerproto/pkg/component/compilermanager"
+	"github.com/storyicon/powerproto/pkg/component/pluginmanager"
+	"github.com/storyicon/powerproto/pkg/configs"
+	"github.com/storyicon/powerproto/pkg/consts"
+	"github.com/storyicon/powerproto/pkg/util/command"
+	"github.com/storyicon/powerproto/pkg/util/logger"
+)
+
+var _ = Describe("Compilermanager", func() {
+	It("should able to parse missing imports", func() {
+		err := &compilermanager.ErrCompile{
+			ErrCommandExec: &command.ErrCommandExec{
+				Stderr: "google/api/annotations.proto: File not found.\n" +
+					"apis/greeter.proto:5:1: Import \"google/api/annotations.proto\" was not found or had errors.\n" +
+					"gogoproto/gogo.proto: File not found.\n",
+			},
+		}
+		Expect(err.MissingImports()).To(Equal([]string{
+			"google/api/annotations.proto",
+			"gogoproto/gogo.proto",
+		}))
+	})
+	It("should able to suggest imports", func() {
+		storageDir, err := ioutil.TempDir("", "")
+		Expect(err).To(BeNil())
+		defer os.RemoveAll(storageDir)
+		write := func(path string) {
+			path = filepath.Join(storageDir, path)
+			Expect(os.MkdirAll(filepath.Dir(path), 0755)).To(BeNil())
+			Expect(ioutil.WriteFile(path, []byte("syntax = \"proto3\";"), 0644)).To(BeNil())
+		}
+		write("include/google/protobuf/empty.proto")
+		write("gits/github.com/example/protos@0123456/github.com/example/protos/proto/example/v1/example.proto")
+		write("gits/github.com/example/protos@0123456/github.com/example/protos/.powerproto-complete")
+
+		cfg := pluginmanager.NewConfig()
+		cfg.StorageDir = storageDir
+		pluginManager, err := pluginmanager.NewBasicPluginManager(cfg, logger.NewDefault("pluginmanager"))
+		Expect(err).To(BeNil())
+		config := configs.GetConfigItems([]*configs.Config{{}}, "/powerproto.yaml")[0]
+		suggestions, err := compilermanager.SuggestImports(context.TODO(), pluginManager, config, []string{
+			"google/protobuf/empty.proto",
+			"example/v1/example.proto",
+			"google/api/annotations.proto",
+			"unknown/unknown.proto",
+		})
+		Expect(err).To(BeNil())
+		Expect(suggestions).To(HaveLen(3))
+		Expect(suggestions[0].ImportPaths).To(Equal([]string{consts.KeyPowerProtoInclude}))
+		Expect(suggestions[1].Repositories).To(Equal(map[string]string{
+			"PROTOS": "https://github.com/example/protos@0123456",
+		}))
+		Expect(suggestions[1].ImportPaths).To(Equal([]string{"$PROTOS/github.com/example/protos/proto"}))
+		googleAPIs := configs.GetRepositoryGoogleAPIs()
+		Expect(suggestions[2].Repositories).To(Equal(map[string]string{
+			googleAPIs.Name: googleAPIs.Pkg,
+		}))
+		Expect(suggestions[2].ImportPaths).To(Equal(googleAPIs.ImportPaths))
+	})
+})
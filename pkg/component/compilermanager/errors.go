@@ -15,10 +15,26 @@
 package compilermanager
 
 import (
+	"regexp"
+
+	"github.com/storyicon/powerproto/pkg/util"
 	"github.com/storyicon/powerproto/pkg/util/command"
 )
 
 // ErrCompile defines the compile error
 type ErrCompile struct {
 	*command.ErrCommandExec
+	// ProtoFile is the proto file being compiled
+	ProtoFile string
+}
+
+var regexpFileNotFound = regexp.MustCompile(`(?m)^(\S+\.proto): File not found\.?\s*$`)
+
+// MissingImports is used to get the imported files that can not be found by protoc
+func (err *ErrCompile) MissingImports() []string {
+	var imports []string
+	for _, match := range regexpFileNotFound.FindAllStringSubmatch(err.Stderr, -1) {
+		imports = append(imports, match[1])
+	}
+	return util.DeduplicateSliceStably(imports)
 }
@@ -0,0 +1,203 @@
+// Copyright 2021 storyicon@foxmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package compilermanager
+
+import (
+	"context"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/storyicon/powerproto/pkg/component/pluginmanager"
+	"github.com/storyicon/powerproto/pkg/configs"
+	"github.com/storyicon/powerproto/pkg/consts"
+	"github.com/storyicon/powerproto/pkg/util"
+)
+
+// ImportSuggestion defines the config entries that can resolve a missing import
+type ImportSuggestion struct {
+	// Import is the import path that can not be found
+	Import string
+	// Source describes where the imported file is found
+	Source string
+	// Repositories are the entries to be added to the repositories of config
+	Repositories map[string]string
+	// ImportPaths are the entries to be added to the importPaths of config
+	ImportPaths []string
+}
+
+// SuggestImports is used to search the include directory of protoc, the installed
+// repositories and the well known repositories for the missing imports
+func SuggestImports(ctx context.Context,
+	pluginManager pluginmanager.PluginManager,
+	config configs.ConfigItem,
+	imports []string,
+) ([]*ImportSuggestion, error) {
+	suggestions := map[string]*ImportSuggestion{}
+	includePath, err := pluginManager.IncludePath(ctx, config.Config().Protoc)
+	if err != nil {
+		return nil, err
+	}
+	for _, item := range imports {
+		exists, err := util.IsFileExists(filepath.Join(includePath, item))
+		if err != nil {
+			return nil, err
+		}
+		if exists {
+			suggestions[item] = &ImportSuggestion{
+				Import:      item,
+				Source:      "the include directory of protoc",
+				ImportPaths: []string{consts.KeyPowerProtoInclude},
+			}
+		}
+	}
+
+	repos, err := listInstalledGitRepos(ctx, pluginManager, config)
+	if err != nil {
+		return nil, err
+	}
+	for _, repo := range repos {
+		if len(suggestions) == len(imports) {
+			break
+		}
+		dir := repo.Dir
+		_ = filepath.Walk(dir, func(file string, info os.FileInfo, err error) error {
+			if err != nil || info.IsDir() || filepath.Ext(file) != ".proto" {
+				return nil
+			}
+			rel, err := filepath.Rel(dir, file)
+			if err != nil {
+				return nil
+			}
+			rel = filepath.ToSlash(rel)
+			for _, item := range imports {
+				if _, ok := suggestions[item]; ok {
+					continue
+				}
+				if rel != item && !strings.HasSuffix(rel, "/"+item) {
+					continue
+				}
+				if suggestion := suggestGitRepo(config, repo, rel, item); suggestion != nil {
+					suggestions[item] = suggestion
+				}
+			}
+			return nil
+		})
+	}
+
+	for _, item := range imports {
+		if _, ok := suggestions[item]; ok {
+			continue
+		}
+		repo, ok := configs.GetWellKnownRepositoryByImport(item)
+		if !ok {
+			continue
+		}
+		suggestions[item] = &ImportSuggestion{
+			Import:       item,
+			Source:       "the well known repository " + repo.Pkg,
+			Repositories: map[string]string{repo.Name: repo.Pkg},
+			ImportPaths:  repo.ImportPaths,
+		}
+	}
+
+	var result []*ImportSuggestion
+	for _, item := range imports {
+		if suggestion, ok := suggestions[item]; ok {
+			result = append(result, suggestion)
+		}
+	}
+	return result, nil
+}
+
+// listInstalledGitRepos is used to list the installed git repos,
+// the ones used by config are placed first
+func listInstalledGitRepos(ctx context.Context,
+	pluginManager pluginmanager.PluginManager,
+	config configs.ConfigItem) ([]*pluginmanager.CacheEntry, error) {
+	installed, err := pluginManager.ListInstalledGitRepos(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var used, others []*pluginmanager.CacheEntry
+	for _, repo := range installed {
+		if _, ok := getRepositoryNameByCommit(config, repo.Version); ok {
+			used = append(used, repo)
+		} else {
+			others = append(others, repo)
+		}
+	}
+	return append(used, others...), nil
+}
+
+func getRepositoryNameByCommit(config configs.ConfigItem, commitId string) (string, bool) {
+	for name, pkg := range config.Config().Repositories {
+		_, version, ok := util.SplitGoPackageVersion(pkg)
+		if ok && version == commitId {
+			return name, true
+		}
+	}
+	return "", false
+}
+
+// suggestGitRepo is used to suggest the entries of config for the file found in
+// installed git repo, rel is the path of file relative to the directory of repo,
+// which starts with the name of repo, e.g. github.com/googleapis/googleapis
+func suggestGitRepo(config configs.ConfigItem, repo *pluginmanager.CacheEntry, rel string, item string) *ImportSuggestion {
+	uri := "https://" + repo.Name
+	pkg := util.JoinGoPackageVersion(uri, repo.Version)
+	suggestion := &ImportSuggestion{
+		Import: item,
+		Source: "the installed repository " + pkg,
+	}
+	name, ok := getRepositoryNameByCommit(config, repo.Version)
+	if !ok {
+		name = getRepositoryName(uri)
+		suggestion.Repositories = map[string]string{name: pkg}
+	}
+	root := strings.TrimSuffix(strings.TrimSuffix(rel, item), "/")
+	// the variable points to the root of proto files when the root of repository is configured
+	if repoConfig := config.Config().GetRepositoryConfig(name); ok && repoConfig != nil && repoConfig.Root != "" {
+		prefix := path.Join(repo.Name, repoConfig.Root)
+		if root != prefix && !strings.HasPrefix(root, prefix+"/") {
+			return nil
+		}
+		root = strings.TrimPrefix(strings.TrimPrefix(root, prefix), "/")
+	}
+	importPath := "$" + name
+	if root != "" {
+		importPath += "/" + root
+	}
+	suggestion.ImportPaths = []string{importPath}
+	return suggestion
+}
+
+// getRepositoryName is used to get the name of repository in config by uri,
+// the name of well known repository is preferred
+func getRepositoryName(uri string) string {
+	for _, repo := range configs.GetWellKnownRepositories() {
+		path, _, ok := util.SplitGoPackageVersion(repo.Pkg)
+		if ok && path == uri {
+			return repo.Name
+		}
+	}
+	return strings.ToUpper(strings.Map(func(r rune) rune {
+		if (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') {
+			return r
+		}
+		return '_'
+	}, path.Base(uri)))
+}
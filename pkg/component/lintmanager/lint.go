@@ -0,0 +1,362 @@
+// Copyright 2021 storyicon@foxmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package lintmanager
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"golang.org/x/mod/module"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+
+	"github.com/storyicon/powerproto/pkg/util/descriptor"
+)
+
+var (
+	regexpPascalCase     = regexp.MustCompile(`^[A-Z][a-zA-Z0-9]*$`)
+	regexpLowerSnakeCase = regexp.MustCompile(`^[a-z][a-z0-9]*(_[a-z0-9]+)*$`)
+	regexpUpperSnakeCase = regexp.MustCompile(`^[A-Z][A-Z0-9]*(_[A-Z0-9]+)*$`)
+	regexpGoIdentifier   = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+)
+
+// finding is a problem found in the file
+type finding struct {
+	rule    string
+	path    []int32
+	message string
+}
+
+// linter is used to lint a proto file
+type linter struct {
+	file     *descriptorpb.FileDescriptorProto
+	files    map[string]*descriptorpb.FileDescriptorProto
+	findings []*finding
+}
+
+func (l *linter) add(rule string, path []int32, format string, args ...interface{}) {
+	l.findings = append(l.findings, &finding{
+		rule:    rule,
+		path:    path,
+		message: fmt.Sprintf(format, args...),
+	})
+}
+
+// lintFile is used to lint the file, files contains all the files in its descriptor set
+func lintFile(file *descriptorpb.FileDescriptorProto, files []*descriptorpb.FileDescriptorProto) []*finding {
+	l := &linter{
+		file:  file,
+		files: make(map[string]*descriptorpb.FileDescriptorProto, len(files)),
+	}
+	for _, item := range files {
+		l.files[item.GetName()] = item
+	}
+	l.lintPackage()
+	l.lintGoPackage()
+	for i, message := range file.GetMessageType() {
+		l.lintMessage([]int32{descriptor.FileMessageTypeTag, int32(i)}, message)
+	}
+	for i, enum := range file.GetEnumType() {
+		l.lintEnum([]int32{descriptor.FileEnumTypeTag, int32(i)}, enum)
+	}
+	for i, service := range file.GetService() {
+		l.lintService([]int32{descriptor.FileServiceTag, int32(i)}, service)
+	}
+	l.lintImports()
+	return l.findings
+}
+
+func (l *linter) lintPackage() {
+	pkg := l.file.GetPackage()
+	if pkg == "" {
+		l.add(RulePackageDefined, nil, "package is not declared")
+		return
+	}
+	dir := path.Dir(l.file.GetName())
+	expected := strings.ReplaceAll(pkg, ".", "/")
+	if dir != expected && !strings.HasSuffix(dir, "/"+expected) {
+		l.add(RulePackageDirectoryMatch, []int32{descriptor.FilePackageTag},
+			"files of package %q should be in a directory ending with %q, but in %q", pkg, expected, dir)
+	}
+}
+
+func (l *linter) lintGoPackage() {
+	options := l.file.GetOptions()
+	if options == nil || options.GoPackage == nil {
+		l.add(RuleGoPackageDefined, nil, "option go_package is not declared")
+		return
+	}
+	path := []int32{descriptor.FileOptionsTag, descriptor.FileOptionsGoPackageTag}
+	value := options.GetGoPackage()
+	importPath, name := value, ""
+	if i := strings.Index(value, ";"); i != -1 {
+		importPath, name = value[:i], value[i+1:]
+		if !regexpGoIdentifier.MatchString(name) {
+			l.add(RuleGoPackageFormat, path, "option go_package %q has an invalid package name %q", value, name)
+		}
+	}
+	if err := module.CheckImportPath(importPath); err != nil {
+		l.add(RuleGoPackageFormat, path, "option go_package %q has an invalid import path: %s", value, err)
+	}
+}
+
+func (l *linter) lintMessage(path []int32, message *descriptorpb.DescriptorProto) {
+	if message.GetOptions().GetMapEntry() {
+		return
+	}
+	if !regexpPascalCase.MatchString(message.GetName()) {
+		l.add(RuleMessagePascalCase, path, "message name %q should be PascalCase", message.GetName())
+	}
+	for i, field := range message.GetField() {
+		if field.GetType() == descriptorpb.FieldDescriptorProto_TYPE_GROUP {
+			continue
+		}
+		if !regexpLowerSnakeCase.MatchString(field.GetName()) {
+			l.add(RuleFieldLowerSnakeCase, descriptor.JoinPath(path, descriptor.MessageFieldTag, int32(i)),
+				"field name %q should be lower_snake_case", field.GetName())
+		}
+	}
+	for i, nested := range message.GetNestedType() {
+		l.lintMessage(descriptor.JoinPath(path, descriptor.MessageNestedTypeTag, int32(i)), nested)
+	}
+	for i, enum := range message.GetEnumType() {
+		l.lintEnum(descriptor.JoinPath(path, descriptor.MessageEnumTypeTag, int32(i)), enum)
+	}
+}
+
+func (l *linter) lintEnum(path []int32, enum *descriptorpb.EnumDescriptorProto) {
+	if !regexpPascalCase.MatchString(enum.GetName()) {
+		l.add(RuleEnumPascalCase, path, "enum name %q should be PascalCase", enum.GetName())
+	}
+	for i, value := range enum.GetValue() {
+		valuePath := descriptor.JoinPath(path, descriptor.EnumValueTag, int32(i))
+		if !regexpUpperSnakeCase.MatchString(value.GetName()) {
+			l.add(RuleEnumValueUpperSnakeCase, valuePath,
+				"enum value name %q should be UPPER_SNAKE_CASE", value.GetName())
+		}
+		if i != 0 {
+			continue
+		}
+		if value.GetNumber() != 0 {
+			l.add(RuleEnumFirstValueZero, valuePath,
+				"the first value of enum %q should be zero, but %d", enum.GetName(), value.GetNumber())
+			continue
+		}
+		expected := ToUpperSnakeCase(enum.GetName()) + "_UNSPECIFIED"
+		if value.GetName() != expected {
+			l.add(RuleEnumZeroValueSuffix, valuePath,
+				"the zero value of enum %q should be named %q, but %q", enum.GetName(), expected, value.GetName())
+		}
+	}
+}
+
+func (l *linter) lintService(path []int32, service *descriptorpb.ServiceDescriptorProto) {
+	if !regexpPascalCase.MatchString(service.GetName()) {
+		l.add(RuleServicePascalCase, path, "service name %q should be PascalCase", service.GetName())
+	}
+	for i, method := range service.GetMethod() {
+		if !regexpPascalCase.MatchString(method.GetName()) {
+			l.add(RuleRPCPascalCase, descriptor.JoinPath(path, descriptor.ServiceMethodTag, int32(i)),
+				"rpc name %q should be PascalCase", method.GetName())
+		}
+	}
+}
+
+// getExtensionKey is used to get the key of extension, i.e. extendee and field number
+func getExtensionKey(extendee string, number int32) string {
+	return fmt.Sprintf("%s#%d", extendee, number)
+}
+
+func (l *linter) lintImports() {
+	usedTypes := map[string]struct{}{}
+	usedExtensions := map[string]struct{}{}
+	l.collectUsages(usedTypes, usedExtensions)
+	for i, dependency := range l.file.GetDependency() {
+		types := map[string]struct{}{}
+		extensions := map[string]struct{}{}
+		l.collectDefinitions(dependency, map[string]struct{}{}, types, extensions)
+		if isAnyUsed(types, usedTypes) || isAnyUsed(extensions, usedExtensions) {
+			continue
+		}
+		l.add(RuleImportNoUnused, []int32{descriptor.FileDependencyTag, int32(i)},
+			"import %q is unused", dependency)
+	}
+}
+
+func isAnyUsed(defined map[string]struct{}, used map[string]struct{}) bool {
+	for key := range defined {
+		if _, ok := used[key]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// collectDefinitions is used to collect the types and extensions defined by the file,
+// including the files imported publicly by it
+func (l *linter) collectDefinitions(name string,
+	visited map[string]struct{},
+	types map[string]struct{},
+	extensions map[string]struct{}) {
+	if _, ok := visited[name]; ok {
+		return
+	}
+	visited[name] = struct{}{}
+	file, ok := l.files[name]
+	if !ok {
+		return
+	}
+	prefix := "."
+	if pkg := file.GetPackage(); pkg != "" {
+		prefix = "." + pkg + "."
+	}
+	var collectMessages func(prefix string, messages []*descriptorpb.DescriptorProto)
+	collectEnums := func(prefix string, enums []*descriptorpb.EnumDescriptorProto) {
+		for _, enum := range enums {
+			types[prefix+enum.GetName()] = struct{}{}
+		}
+	}
+	collectExtensions := func(fields []*descriptorpb.FieldDescriptorProto) {
+		for _, field := range fields {
+			extensions[getExtensionKey(field.GetExtendee(), field.GetNumber())] = struct{}{}
+		}
+	}
+	collectMessages = func(prefix string, messages []*descriptorpb.DescriptorProto) {
+		for _, message := range messages {
+			name := prefix + message.GetName()
+			types[name] = struct{}{}
+			collectMessages(name+".", message.GetNestedType())
+			collectEnums(name+".", message.GetEnumType())
+			collectExtensions(message.GetExtension())
+		}
+	}
+	collectMessages(prefix, file.GetMessageType())
+	collectEnums(prefix, file.GetEnumType())
+	collectExtensions(file.GetExtension())
+	for _, service := range file.GetService() {
+		types[prefix+service.GetName()] = struct{}{}
+	}
+	for _, index := range file.GetPublicDependency() {
+		if int(index) < len(file.GetDependency()) {
+			l.collectDefinitions(file.GetDependency()[index], visited, types, extensions)
+		}
+	}
+}
+
+// collectUsages is used to collect the types and extensions referenced by the file
+func (l *linter) collectUsages(types map[string]struct{}, extensions map[string]struct{}) {
+	collectOptions := func(extendee string, options proto.Message) {
+		for _, number := range getExtensionNumbers(options) {
+			extensions[getExtensionKey(extendee, number)] = struct{}{}
+		}
+	}
+	collectFields := func(fields []*descriptorpb.FieldDescriptorProto) {
+		for _, field := range fields {
+			if name := field.GetTypeName(); name != "" {
+				types[name] = struct{}{}
+			}
+			if extendee := field.GetExtendee(); extendee != "" {
+				types[extendee] = struct{}{}
+			}
+			collectOptions(".google.protobuf.FieldOptions", field.GetOptions())
+		}
+	}
+	collectEnums := func(enums []*descriptorpb.EnumDescriptorProto) {
+		for _, enum := range enums {
+			collectOptions(".google.protobuf.EnumOptions", enum.GetOptions())
+			for _, value := range enum.GetValue() {
+				collectOptions(".google.protobuf.EnumValueOptions", value.GetOptions())
+			}
+		}
+	}
+	var collectMessages func(messages []*descriptorpb.DescriptorProto)
+	collectMessages = func(messages []*descriptorpb.DescriptorProto) {
+		for _, message := range messages {
+			collectOptions(".google.protobuf.MessageOptions", message.GetOptions())
+			collectFields(message.GetField())
+			collectFields(message.GetExtension())
+			for _, oneof := range message.GetOneofDecl() {
+				collectOptions(".google.protobuf.OneofOptions", oneof.GetOptions())
+			}
+			collectMessages(message.GetNestedType())
+			collectEnums(message.GetEnumType())
+		}
+	}
+	collectOptions(".google.protobuf.FileOptions", l.file.GetOptions())
+	collectMessages(l.file.GetMessageType())
+	collectEnums(l.file.GetEnumType())
+	collectFields(l.file.GetExtension())
+	for _, service := range l.file.GetService() {
+		collectOptions(".google.protobuf.ServiceOptions", service.GetOptions())
+		for _, method := range service.GetMethod() {
+			types[method.GetInputType()] = struct{}{}
+			types[method.GetOutputType()] = struct{}{}
+			collectOptions(".google.protobuf.MethodOptions", method.GetOptions())
+		}
+	}
+}
+
+// getExtensionNumbers is used to get the field numbers of the extensions set on options.
+// Custom options are kept as unknown fields unless their go types are linked
+func getExtensionNumbers(options proto.Message) []int32 {
+	if options == nil {
+		return nil
+	}
+	message := options.ProtoReflect()
+	if !message.IsValid() {
+		return nil
+	}
+	var numbers []int32
+	message.Range(func(field protoreflect.FieldDescriptor, value protoreflect.Value) bool {
+		if field.IsExtension() {
+			numbers = append(numbers, int32(field.Number()))
+		}
+		return true
+	})
+	unknown := message.GetUnknown()
+	for len(unknown) > 0 {
+		number, _, n := protowire.ConsumeField(unknown)
+		if n < 0 {
+			break
+		}
+		numbers = append(numbers, int32(number))
+		unknown = unknown[n:]
+	}
+	return numbers
+}
+
+// ToUpperSnakeCase is used to convert PascalCase to UPPER_SNAKE_CASE, e.g.
+//
+//	HTTPMethod => HTTP_METHOD
+func ToUpperSnakeCase(s string) string {
+	runes := []rune(s)
+	var builder strings.Builder
+	for i, r := range runes {
+		if i > 0 && unicode.IsUpper(r) {
+			prev := runes[i-1]
+			nextIsLower := i+1 < len(runes) && unicode.IsLower(runes[i+1])
+			if unicode.IsLower(prev) || unicode.IsDigit(prev) || (unicode.IsUpper(prev) && nextIsLower) {
+				builder.WriteRune('_')
+			}
+		}
+		builder.WriteRune(unicode.ToUpper(r))
+	}
+	return builder.String()
+}
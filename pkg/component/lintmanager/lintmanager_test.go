@@ -0,0 +1,162 @@
+// Copyright 2021 storyicon@foxmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package lintmanager_test
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/descriptorpb"
+
+	"github.com/storyicon/powerproto/pkg/component/lintmanager"
+	"github.com/storyicon/powerproto/pkg/configs"
+	"github.com/storyicon/powerproto/pkg/util/diagnostic"
+	"github.com/storyicon/powerproto/pkg/util/logger"
+)
+
+func getRules(diagnostics []*diagnostic.Diagnostic) []string {
+	var rules []string
+	for _, item := range diagnostics {
+		rules = append(rules, item.Rule)
+	}
+	return rules
+}
+
+var _ = Describe("LintManager", func() {
+	manager, err := lintmanager.NewLintManager(logger.NewDefault("lintmanager"))
+	newConfig := func(lint *configs.LintConfig) configs.ConfigItem {
+		return configs.GetConfigItems([]*configs.Config{{Lint: lint}}, "/powerproto.yaml")[0]
+	}
+	timestamp := &descriptorpb.FileDescriptorProto{
+		Name:    proto.String("google/protobuf/timestamp.proto"),
+		Package: proto.String("google.protobuf"),
+		MessageType: []*descriptorpb.DescriptorProto{
+			{Name: proto.String("Timestamp")},
+		},
+	}
+	empty := &descriptorpb.FileDescriptorProto{
+		Name:    proto.String("google/protobuf/empty.proto"),
+		Package: proto.String("google.protobuf"),
+		MessageType: []*descriptorpb.DescriptorProto{
+			{Name: proto.String("Empty")},
+		},
+	}
+	file := &descriptorpb.FileDescriptorProto{
+		Name:       proto.String("apis/greeter.proto"),
+		Package:    proto.String("greeter.v1"),
+		Dependency: []string{"google/protobuf/timestamp.proto", "google/protobuf/empty.proto"},
+		Options: &descriptorpb.FileOptions{
+			GoPackage: proto.String("github.com/example/greeter;greeter v1"),
+		},
+		MessageType: []*descriptorpb.DescriptorProto{
+			{
+				Name: proto.String("hello_request"),
+				Field: []*descriptorpb.FieldDescriptorProto{
+					{
+						Name:     proto.String("CreateTime"),
+						Number:   proto.Int32(1),
+						Type:     descriptorpb.FieldDescriptorProto_TYPE_MESSAGE.Enum(),
+						TypeName: proto.String(".google.protobuf.Timestamp"),
+					},
+				},
+			},
+		},
+		EnumType: []*descriptorpb.EnumDescriptorProto{
+			{
+				Name: proto.String("HTTPMethod"),
+				Value: []*descriptorpb.EnumValueDescriptorProto{
+					{Name: proto.String("HTTP_METHOD_UNKNOWN"), Number: proto.Int32(0)},
+					{Name: proto.String("get"), Number: proto.Int32(1)},
+				},
+			},
+		},
+		Service: []*descriptorpb.ServiceDescriptorProto{
+			{
+				Name: proto.String("Greeter"),
+				Method: []*descriptorpb.MethodDescriptorProto{
+					{
+						Name:       proto.String("say_hello"),
+						InputType:  proto.String(".greeter.v1.hello_request"),
+						OutputType: proto.String(".greeter.v1.hello_request"),
+					},
+				},
+			},
+		},
+		SourceCodeInfo: &descriptorpb.SourceCodeInfo{
+			Location: []*descriptorpb.SourceCodeInfo_Location{
+				{
+					Path:            []int32{4, 0},
+					Span:            []int32{9, 0, 12, 1},
+					LeadingComments: proto.String(" powerproto:lint:ignore FIELD_LOWER_SNAKE_CASE\n"),
+				},
+				{
+					Path: []int32{6, 0, 2, 0},
+					Span: []int32{20, 2, 40},
+				},
+			},
+		},
+	}
+	set := &descriptorpb.FileDescriptorSet{
+		File: []*descriptorpb.FileDescriptorProto{timestamp, empty, file},
+	}
+
+	It("should able to init", func() {
+		Expect(err).To(BeNil())
+		Expect(manager).To(Not(BeNil()))
+	})
+	It("should able to lint", func() {
+		diagnostics, err := manager.Lint(context.TODO(), newConfig(nil), "/apis/greeter.proto", set)
+		Expect(err).To(BeNil())
+		Expect(getRules(diagnostics)).To(ConsistOf(
+			lintmanager.RulePackageDirectoryMatch,
+			lintmanager.RuleGoPackageFormat,
+			lintmanager.RuleMessagePascalCase,
+			lintmanager.RuleEnumValueUpperSnakeCase,
+			lintmanager.RuleEnumZeroValueSuffix,
+			lintmanager.RuleRPCPascalCase,
+			lintmanager.RuleImportNoUnused,
+		))
+		for _, item := range diagnostics {
+			switch item.Rule {
+			case lintmanager.RuleRPCPascalCase:
+				Expect(item.Line).To(Equal(21))
+				Expect(item.Column).To(Equal(3))
+			case lintmanager.RuleImportNoUnused:
+				Expect(item.Message).To(ContainSubstring("google/protobuf/empty.proto"))
+			}
+		}
+	})
+	It("should able to select rules", func() {
+		diagnostics, err := manager.Lint(context.TODO(), newConfig(&configs.LintConfig{
+			Use:    []string{lintmanager.RuleMessagePascalCase, lintmanager.RuleRPCPascalCase},
+			Except: []string{lintmanager.RuleRPCPascalCase},
+		}), "/apis/greeter.proto", set)
+		Expect(err).To(BeNil())
+		Expect(getRules(diagnostics)).To(ConsistOf(lintmanager.RuleMessagePascalCase))
+	})
+	It("should reject unknown rules", func() {
+		_, err := manager.Lint(context.TODO(), newConfig(&configs.LintConfig{
+			Except: []string{"UNKNOWN_RULE"},
+		}), "/apis/greeter.proto", set)
+		Expect(err).To(Not(BeNil()))
+	})
+	It("should able to convert to upper snake case", func() {
+		Expect(lintmanager.ToUpperSnakeCase("HTTPMethod")).To(Equal("HTTP_METHOD"))
+		Expect(lintmanager.ToUpperSnakeCase("PhoneType")).To(Equal("PHONE_TYPE"))
+		Expect(lintmanager.ToUpperSnakeCase("V2Status")).To(Equal("V2_STATUS"))
+	})
+})
@@ -0,0 +1,147 @@
+// Copyright 2021 storyicon@foxmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package lintmanager
+
+import (
+	"context"
+	"strings"
+
+	"github.com/pkg/errors"
+	"google.golang.org/protobuf/types/descriptorpb"
+
+	"github.com/storyicon/powerproto/pkg/configs"
+	"github.com/storyicon/powerproto/pkg/util"
+	"github.com/storyicon/powerproto/pkg/util/descriptor"
+	"github.com/storyicon/powerproto/pkg/util/diagnostic"
+	"github.com/storyicon/powerproto/pkg/util/logger"
+)
+
+// LintManager is used to lint proto files
+type LintManager interface {
+	// Lint is used to lint the proto file in path with its descriptor set
+	Lint(ctx context.Context, config configs.ConfigItem, path string, set *descriptorpb.FileDescriptorSet) ([]*diagnostic.Diagnostic, error)
+}
+
+// NewLintManager is used to create LintManager
+func NewLintManager(log logger.Logger) (LintManager, error) {
+	return NewBasicLintManager(log)
+}
+
+// BasicLintManager is the basic implement of LintManager
+type BasicLintManager struct {
+	logger.Logger
+}
+
+var _ LintManager = &BasicLintManager{}
+
+// NewBasicLintManager is used to create a basic LintManager
+func NewBasicLintManager(log logger.Logger) (*BasicLintManager, error) {
+	return &BasicLintManager{
+		Logger: log.NewLogger("lintmanager"),
+	}, nil
+}
+
+// Lint is used to lint the proto file in path with its descriptor set
+func (b *BasicLintManager) Lint(ctx context.Context,
+	config configs.ConfigItem,
+	path string, set *descriptorpb.FileDescriptorSet) ([]*diagnostic.Diagnostic, error) {
+	enabled, err := GetEnabledRules(config.Config().Lint)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid lint config in %s", config.Path())
+	}
+	file := descriptor.GetCompiledFile(set)
+	if file == nil {
+		return nil, errors.Errorf("empty descriptor set: %s", path)
+	}
+	var diagnostics []*diagnostic.Diagnostic
+	for _, item := range lintFile(file, set.GetFile()) {
+		if _, ok := enabled[item.rule]; !ok {
+			continue
+		}
+		if isIgnored(file, item.path, item.rule) {
+			continue
+		}
+		line, column := descriptor.GetPosition(file, item.path)
+		diagnostics = append(diagnostics, &diagnostic.Diagnostic{
+			Path:    path,
+			Line:    line,
+			Column:  column,
+			Rule:    item.rule,
+			Message: item.message,
+		})
+	}
+	diagnostic.Sort(diagnostics)
+	return diagnostics, nil
+}
+
+// GetEnabledRules is used to get the set of rules enabled by config
+func GetEnabledRules(cfg *configs.LintConfig) (map[string]struct{}, error) {
+	var use, except []string
+	if cfg != nil {
+		use, except = cfg.Use, cfg.Except
+	}
+	for _, name := range append(append([]string{}, use...), except...) {
+		if _, ok := GetRule(name); !ok {
+			return nil, errors.Errorf("unknown rule: %s", name)
+		}
+	}
+	enabled := map[string]struct{}{}
+	for _, rule := range Rules {
+		if len(use) != 0 && !util.Contains(use, rule.Name) {
+			continue
+		}
+		if util.Contains(except, rule.Name) {
+			continue
+		}
+		enabled[rule.Name] = struct{}{}
+	}
+	return enabled, nil
+}
+
+// isIgnored is used to check whether the rule is suppressed by the comments
+// of the element in path, its ancestors, or the syntax and package statements
+func isIgnored(file *descriptorpb.FileDescriptorProto, path []int32, rule string) bool {
+	paths := [][]int32{
+		{descriptor.FileSyntaxTag},
+		{descriptor.FilePackageTag},
+	}
+	for i := len(path); i > 0; i-- {
+		paths = append(paths, path[:i])
+	}
+	for _, p := range paths {
+		for _, comment := range descriptor.GetComments(file, p) {
+			if isIgnoredByComment(comment, rule) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func isIgnoredByComment(comment string, rule string) bool {
+	for _, line := range strings.Split(comment, "\n") {
+		line = strings.TrimSpace(line)
+		if !strings.HasPrefix(line, IgnoreDirective) {
+			continue
+		}
+		fields := strings.FieldsFunc(strings.TrimPrefix(line, IgnoreDirective), func(r rune) bool {
+			return r == ' ' || r == ',' || r == '\t'
+		})
+		if util.Contains(fields, rule) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,112 @@
+// Copyright 2021 storyicon@foxmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package lintmanager
+
+// defines the rules of lint
+const (
+	RulePackageDefined          = "PACKAGE_DEFINED"
+	RulePackageDirectoryMatch   = "PACKAGE_DIRECTORY_MATCH"
+	RuleGoPackageDefined        = "GO_PACKAGE_DEFINED"
+	RuleGoPackageFormat         = "GO_PACKAGE_FORMAT"
+	RuleMessagePascalCase       = "MESSAGE_PASCAL_CASE"
+	RuleFieldLowerSnakeCase     = "FIELD_LOWER_SNAKE_CASE"
+	RuleEnumPascalCase          = "ENUM_PASCAL_CASE"
+	RuleEnumValueUpperSnakeCase = "ENUM_VALUE_UPPER_SNAKE_CASE"
+	RuleEnumFirstValueZero      = "ENUM_FIRST_VALUE_ZERO"
+	RuleEnumZeroValueSuffix     = "ENUM_ZERO_VALUE_SUFFIX"
+	RuleServicePascalCase       = "SERVICE_PASCAL_CASE"
+	RuleRPCPascalCase           = "RPC_PASCAL_CASE"
+	RuleImportNoUnused          = "IMPORT_NO_UNUSED"
+)
+
+// IgnoreDirective is used to suppress rules in comments, e.g.
+//
+//	// powerproto:lint:ignore FIELD_LOWER_SNAKE_CASE
+//
+// It takes effect on the commented element and its children.
+// When it is attached to the syntax or package statement, it takes effect on the whole file
+const IgnoreDirective = "powerproto:lint:ignore"
+
+// Rule defines the rule of lint
+type Rule struct {
+	Name        string
+	Description string
+}
+
+// Rules defines all the rules
+var Rules = []*Rule{
+	{
+		Name:        RulePackageDefined,
+		Description: "proto files must declare a package",
+	},
+	{
+		Name:        RulePackageDirectoryMatch,
+		Description: "the directory of proto file must end with the package, e.g. foo/bar/v1 for package foo.bar.v1",
+	},
+	{
+		Name:        RuleGoPackageDefined,
+		Description: "proto files must declare the go_package option",
+	},
+	{
+		Name:        RuleGoPackageFormat,
+		Description: "the go_package option must be a valid import path, optionally followed by ';name'",
+	},
+	{
+		Name:        RuleMessagePascalCase,
+		Description: "message names must be PascalCase",
+	},
+	{
+		Name:        RuleFieldLowerSnakeCase,
+		Description: "field names must be lower_snake_case",
+	},
+	{
+		Name:        RuleEnumPascalCase,
+		Description: "enum names must be PascalCase",
+	},
+	{
+		Name:        RuleEnumValueUpperSnakeCase,
+		Description: "enum value names must be UPPER_SNAKE_CASE",
+	},
+	{
+		Name:        RuleEnumFirstValueZero,
+		Description: "the first value of enum must be zero",
+	},
+	{
+		Name:        RuleEnumZeroValueSuffix,
+		Description: "the zero value of enum must be named ENUM_NAME_UNSPECIFIED",
+	},
+	{
+		Name:        RuleServicePascalCase,
+		Description: "service names must be PascalCase",
+	},
+	{
+		Name:        RuleRPCPascalCase,
+		Description: "rpc names must be PascalCase",
+	},
+	{
+		Name:        RuleImportNoUnused,
+		Description: "imported files must be used",
+	},
+}
+
+// GetRule is used to get rule by name
+func GetRule(name string) (*Rule, bool) {
+	for _, rule := range Rules {
+		if rule.Name == name {
+			return rule, true
+		}
+	}
+	return nil, false
+}
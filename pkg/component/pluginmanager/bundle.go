@@ -0,0 +1,347 @@
+// Copyright 2021 storyicon@foxmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pluginmanager
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	jsoniter "github.com/json-iterator/go"
+	"github.com/pkg/errors"
+
+	"github.com/storyicon/powerproto/pkg/util"
+)
+
+// BundleManifestName is the name of manifest file in bundle,
+// it is always the first file of bundle
+const BundleManifestName = "manifest.json"
+
+// BundleManifestVersion is the version of manifest format
+const BundleManifestVersion = 1
+
+// BundleManifest defines the content of cache bundle
+type BundleManifest struct {
+	Version   int            `json:"version"`
+	CreatedAt time.Time      `json:"createdAt"`
+	Entries   []*BundleEntry `json:"entries"`
+	Files     []*BundleFile  `json:"files"`
+}
+
+// BundleEntry defines a cache entry in bundle
+type BundleEntry struct {
+	Kind    string `json:"kind"`
+	Name    string `json:"name"`
+	Version string `json:"version"`
+	// Dir is the slash separated path of entry relative to the storage dir
+	Dir string `json:"dir"`
+}
+
+// BundleFile defines a file in bundle
+type BundleFile struct {
+	// Path is the slash separated path of file relative to the storage dir
+	Path   string      `json:"path"`
+	Size   int64       `json:"size"`
+	Mode   os.FileMode `json:"mode"`
+	Sha256 string      `json:"sha256"`
+}
+
+// ExportBundle is used to pack the cache entries into a gzipped tar bundle with manifest,
+// the legacy shared include files are packed if any protoc in entries has no include files of its own
+func ExportBundle(storageDir string, entries []*CacheEntry, writer io.Writer) (*BundleManifest, error) {
+	manifest := &BundleManifest{
+		Version:   BundleManifestVersion,
+		CreatedAt: time.Now(),
+	}
+	includeDir := PathForInclude(storageDir)
+	exists, err := util.IsDirExists(includeDir)
+	if err != nil {
+		return nil, err
+	}
+	// the legacy shared include dir is only required by the protoc without its own include files
+	legacy := false
+	for _, entry := range entries {
+		if entry.Kind != CacheKindProtoc {
+			continue
+		}
+		included, err := util.IsDirExists(PathForProtocInclude(storageDir, entry.Version))
+		if err != nil {
+			return nil, err
+		}
+		legacy = legacy || !included
+	}
+	dirs := make([]string, 0, len(entries)+1)
+	if exists && legacy {
+		manifest.Entries = append(manifest.Entries, &BundleEntry{
+			Kind: CacheKindInclude,
+			Name: "include",
+			Dir:  "include",
+		})
+		dirs = append(dirs, includeDir)
+	}
+	for _, entry := range entries {
+		rel, err := filepath.Rel(storageDir, entry.Dir)
+		if err != nil {
+			return nil, err
+		}
+		manifest.Entries = append(manifest.Entries, &BundleEntry{
+			Kind:    entry.Kind,
+			Name:    entry.Name,
+			Version: entry.Version,
+			Dir:     filepath.ToSlash(rel),
+		})
+		dirs = append(dirs, entry.Dir)
+	}
+	var files []string
+	for _, dir := range dirs {
+		err := filepath.Walk(dir, func(path string, info fs.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if !info.Mode().IsRegular() {
+				return nil
+			}
+			sum, err := hashFile(path)
+			if err != nil {
+				return err
+			}
+			rel, err := filepath.Rel(storageDir, path)
+			if err != nil {
+				return err
+			}
+			manifest.Files = append(manifest.Files, &BundleFile{
+				Path:   filepath.ToSlash(rel),
+				Size:   info.Size(),
+				Mode:   info.Mode().Perm(),
+				Sha256: sum,
+			})
+			files = append(files, path)
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	gw := gzip.NewWriter(writer)
+	tw := tar.NewWriter(gw)
+	data, err := jsoniter.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := tw.WriteHeader(&tar.Header{
+		Name:     BundleManifestName,
+		Mode:     0644,
+		Size:     int64(len(data)),
+		ModTime:  manifest.CreatedAt,
+		Typeflag: tar.TypeReg,
+	}); err != nil {
+		return nil, err
+	}
+	if _, err := tw.Write(data); err != nil {
+		return nil, err
+	}
+	for i, file := range manifest.Files {
+		if err := writeTarFile(tw, files[i], file); err != nil {
+			return nil, err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return nil, err
+	}
+	if err := gw.Close(); err != nil {
+		return nil, err
+	}
+	return manifest, nil
+}
+
+func writeTarFile(tw *tar.Writer, local string, file *BundleFile) error {
+	source, err := os.Open(local)
+	if err != nil {
+		return err
+	}
+	defer source.Close()
+	if err := tw.WriteHeader(&tar.Header{
+		Name:     file.Path,
+		Mode:     int64(file.Mode),
+		Size:     file.Size,
+		Typeflag: tar.TypeReg,
+	}); err != nil {
+		return err
+	}
+	// the size is checked by tar writer, the file must not be changed during packing
+	_, err = io.Copy(tw, source)
+	return err
+}
+
+// ImportBundle is used to verify the bundle against its manifest and install the entries in it.
+// The entries that are already installed are kept as they are, and the include files are merged
+func ImportBundle(ctx context.Context, storageDir string, reader io.Reader) (*BundleManifest, error) {
+	gr, err := gzip.NewReader(reader)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid bundle")
+	}
+	defer gr.Close()
+	tr := tar.NewReader(gr)
+	header, err := tr.Next()
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid bundle")
+	}
+	if header.Name != BundleManifestName {
+		return nil, errors.Errorf("invalid bundle: %s is expected to be the first file", BundleManifestName)
+	}
+	var manifest BundleManifest
+	if err := jsoniter.NewDecoder(tr).Decode(&manifest); err != nil {
+		return nil, errors.Wrap(err, "invalid manifest")
+	}
+	if manifest.Version != BundleManifestVersion {
+		return nil, errors.Errorf("unsupported manifest version: %d", manifest.Version)
+	}
+	expected := make(map[string]*BundleFile, len(manifest.Files))
+	for _, file := range manifest.Files {
+		if !isSafeBundlePath(file.Path) {
+			return nil, errors.Errorf("invalid path in manifest: %s", file.Path)
+		}
+		expected[file.Path] = file
+	}
+	for _, entry := range manifest.Entries {
+		if !isSafeBundlePath(entry.Dir) {
+			return nil, errors.Errorf("invalid path in manifest: %s", entry.Dir)
+		}
+		if entry.Kind == CacheKindRepository && !isSafeBundlePath(entry.Name) {
+			return nil, errors.Errorf("invalid repository in manifest: %s", entry.Name)
+		}
+	}
+
+	// the files are extracted to the staging dir and verified before installing
+	staging, err := newStagingDir(storageDir, "import-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(staging)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, errors.Wrap(err, "invalid bundle")
+		}
+		file, ok := expected[header.Name]
+		if !ok {
+			return nil, errors.Errorf("%s is not declared in manifest", header.Name)
+		}
+		delete(expected, header.Name)
+		if err := extractBundleFile(tr, filepath.Join(staging, filepath.FromSlash(file.Path)), file); err != nil {
+			return nil, err
+		}
+	}
+	if len(expected) != 0 {
+		missing := make([]string, 0, len(expected))
+		for name := range expected {
+			missing = append(missing, name)
+		}
+		sort.Strings(missing)
+		return nil, errors.Errorf("the following files are declared in manifest but missing in bundle: %s",
+			strings.Join(missing, ", "))
+	}
+
+	for _, entry := range manifest.Entries {
+		source := filepath.Join(staging, filepath.FromSlash(entry.Dir))
+		destination := filepath.Join(storageDir, filepath.FromSlash(entry.Dir))
+		if entry.Kind == CacheKindInclude {
+			if err := mergeInclude(ctx, storageDir, source); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		// the repository is installed into the code directory in the entry
+		if entry.Kind == CacheKindRepository {
+			source = filepath.Join(source, filepath.FromSlash(entry.Name))
+			destination = filepath.Join(destination, filepath.FromSlash(entry.Name))
+		}
+		if err := importBundleEntry(ctx, storageDir, source, destination); err != nil {
+			return nil, errors.Wrapf(err, "failed to import %s@%s", entry.Name, entry.Version)
+		}
+	}
+	return &manifest, nil
+}
+
+func importBundleEntry(ctx context.Context, storageDir string, source string, destination string) error {
+	exists, err := util.IsDirExists(source)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return errors.New("no file is found in bundle")
+	}
+	lock, err := lockArtifact(ctx, storageDir, destination)
+	if err != nil {
+		return err
+	}
+	defer lock.Release()
+	completed, err := isInstallCompleted(destination)
+	if err != nil {
+		return err
+	}
+	if completed {
+		return nil
+	}
+	return commitInstall(source, destination)
+}
+
+func extractBundleFile(reader io.Reader, destination string, file *BundleFile) error {
+	if err := os.MkdirAll(filepath.Dir(destination), fs.ModePerm); err != nil {
+		return err
+	}
+	target, err := os.OpenFile(destination, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, file.Mode|0600)
+	if err != nil {
+		return err
+	}
+	defer target.Close()
+	hash := sha256.New()
+	size, err := io.Copy(io.MultiWriter(target, hash), reader)
+	if err != nil {
+		return err
+	}
+	sum := hex.EncodeToString(hash.Sum(nil))
+	if size != file.Size || sum != file.Sha256 {
+		return &ErrChecksumMismatch{
+			Path:     file.Path,
+			Expected: file.Sha256,
+			Actual:   sum,
+		}
+	}
+	return nil
+}
+
+// isSafeBundlePath is used to check whether the path stays in the storage dir after joined
+func isSafeBundlePath(name string) bool {
+	if name == "" || path.IsAbs(name) || strings.Contains(name, "\\") {
+		return false
+	}
+	cleaned := path.Clean(name)
+	return cleaned == name && cleaned != ".." && !strings.HasPrefix(cleaned, "../")
+}
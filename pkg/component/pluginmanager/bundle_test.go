@@ -0,0 +1,122 @@
+// Copyright 2021 storyicon@foxmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pluginmanager_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	jsoniter "github.com/json-iterator/go"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/storyicon/powerproto/pkg/component/pluginmanager"
+)
+
+func newBundle(manifest *pluginmanager.BundleManifest, files map[string]string) *bytes.Buffer {
+	buf := &bytes.Buffer{}
+	gw := gzip.NewWriter(buf)
+	tw := tar.NewWriter(gw)
+	data, err := jsoniter.Marshal(manifest)
+	Expect(err).To(BeNil())
+	Expect(tw.WriteHeader(&tar.Header{Name: pluginmanager.BundleManifestName, Mode: 0644, Size: int64(len(data))})).To(BeNil())
+	_, err = tw.Write(data)
+	Expect(err).To(BeNil())
+	for name, content := range files {
+		Expect(tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(content))})).To(BeNil())
+		_, err = tw.Write([]byte(content))
+		Expect(err).To(BeNil())
+	}
+	Expect(tw.Close()).To(BeNil())
+	Expect(gw.Close()).To(BeNil())
+	return buf
+}
+
+var _ = Describe("Bundle", func() {
+	var source, target string
+	BeforeEach(func() {
+		var err error
+		source, err = ioutil.TempDir("", "powerproto-bundle")
+		Expect(err).To(BeNil())
+		target, err = ioutil.TempDir("", "powerproto-bundle")
+		Expect(err).To(BeNil())
+	})
+	AfterEach(func() {
+		os.RemoveAll(source)
+		os.RemoveAll(target)
+	})
+
+	It("should able to export and import bundle", func() {
+		touchInstalled(pluginmanager.PathForProtoc(source, "3.17.3"))
+		touchInstalled(pluginmanager.PathForProtoc(source, "3.9.0"))
+		touchFile(filepath.Join(pluginmanager.PathForInclude(source), "google", "protobuf", "empty.proto"))
+		entries, err := pluginmanager.ListCacheEntries(source)
+		Expect(err).To(BeNil())
+		Expect(entries).To(HaveLen(2))
+
+		buf := &bytes.Buffer{}
+		manifest, err := pluginmanager.ExportBundle(source, entries[1:], buf)
+		Expect(err).To(BeNil())
+		Expect(manifest.Entries).To(HaveLen(2))
+		Expect(manifest.Files).To(HaveLen(3))
+
+		_, err = pluginmanager.ImportBundle(context.TODO(), target, buf)
+		Expect(err).To(BeNil())
+		entries, err = pluginmanager.ListCacheEntries(target)
+		Expect(err).To(BeNil())
+		Expect(entries).To(HaveLen(1))
+		Expect(entries[0].String()).To(Equal("protoc@v3.17.3"))
+		info, err := os.Stat(filepath.Join(pluginmanager.PathForInclude(target), "google", "protobuf", "empty.proto"))
+		Expect(err).To(BeNil())
+		Expect(info.IsDir()).To(BeFalse())
+	})
+	It("should reject the bundle not matching the manifest", func() {
+		manifest := &pluginmanager.BundleManifest{
+			Version: pluginmanager.BundleManifestVersion,
+			Entries: []*pluginmanager.BundleEntry{
+				{Kind: pluginmanager.CacheKindProtoc, Name: "protoc", Version: "v3.17.3", Dir: "protoc/3.17.3"},
+			},
+			Files: []*pluginmanager.BundleFile{
+				{Path: "protoc/3.17.3/protoc", Size: 5, Mode: 0755, Sha256: "0000"},
+			},
+		}
+		_, err := pluginmanager.ImportBundle(context.TODO(), target, newBundle(manifest, map[string]string{
+			"protoc/3.17.3/protoc": "hello",
+		}))
+		Expect(err).To(BeAssignableToTypeOf(&pluginmanager.ErrChecksumMismatch{}))
+
+		_, err = pluginmanager.ImportBundle(context.TODO(), target, newBundle(manifest, nil))
+		Expect(err).NotTo(BeNil())
+
+		manifest.Files = nil
+		_, err = pluginmanager.ImportBundle(context.TODO(), target, newBundle(manifest, map[string]string{
+			"protoc/3.17.3/protoc": "hello",
+		}))
+		Expect(err).NotTo(BeNil())
+
+		manifest.Entries[0].Dir = "../outside"
+		_, err = pluginmanager.ImportBundle(context.TODO(), target, newBundle(manifest, nil))
+		Expect(err).NotTo(BeNil())
+
+		entries, err := pluginmanager.ListCacheEntries(target)
+		Expect(err).To(BeNil())
+		Expect(entries).To(BeEmpty())
+	})
+})
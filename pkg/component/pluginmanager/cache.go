@@ -0,0 +1,550 @@
+// Copyright 2021 storyicon@foxmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pluginmanager
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"golang.org/x/mod/module"
+
+	"github.com/storyicon/powerproto/pkg/util"
+)
+
+func readDirNames(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	names := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		if entry.IsDir() {
+			names = append(names, entry.Name())
+		}
+	}
+	return names, nil
+}
+
+// ListInstalledProtocVersions is used to list the versions of installed protoc in semantic order
+func ListInstalledProtocVersions(storageDir string) ([]string, error) {
+	names, err := readDirNames(PathForProtocDir(storageDir, ""))
+	if err != nil {
+		return nil, err
+	}
+	var versions []string
+	for _, name := range names {
+		exists, _, err := IsProtocInstalled(context.TODO(), storageDir, name)
+		if err != nil {
+			return nil, err
+		}
+		if exists {
+			versions = append(versions, "v"+name)
+		}
+	}
+	malformed, wellFormed := util.SortSemanticVersion(versions)
+	return append(malformed, wellFormed...), nil
+}
+
+// ListInstalledPluginVersions is used to list the versions of installed plugin in semantic order
+func ListInstalledPluginVersions(storageDir string, path string) ([]string, error) {
+	enc, err := module.EscapePath(path)
+	if err != nil {
+		return nil, err
+	}
+	dir := filepath.Join(PathForPlugins(storageDir), filepath.FromSlash(enc))
+	names, err := readDirNames(filepath.Dir(dir))
+	if err != nil {
+		return nil, err
+	}
+	prefix := filepath.Base(dir) + "@"
+	var versions []string
+	for _, name := range names {
+		if !strings.HasPrefix(name, prefix) {
+			continue
+		}
+		version, err := module.UnescapeVersion(strings.TrimPrefix(name, prefix))
+		if err != nil {
+			continue
+		}
+		exists, _, err := IsPluginInstalled(context.TODO(), storageDir, path, version)
+		if err != nil {
+			return nil, err
+		}
+		if exists {
+			versions = append(versions, version)
+		}
+	}
+	malformed, wellFormed := util.SortSemanticVersion(versions)
+	return append(malformed, wellFormed...), nil
+}
+
+// GetLatestInstalledGitRepo is used to get the commit id of the most recently installed
+// version of git repo, empty string will be returned if it is not installed
+func GetLatestInstalledGitRepo(storageDir string, uri string) (string, error) {
+	name, err := GetGitRepoName(uri)
+	if err != nil {
+		return "", err
+	}
+	entries, err := listInstalledGitRepos(storageDir)
+	if err != nil {
+		return "", err
+	}
+	var latest string
+	var latestTime time.Time
+	for _, entry := range entries {
+		if entry.Name != name || entry.Incomplete {
+			continue
+		}
+		info, err := os.Stat(entry.Dir)
+		if err != nil {
+			return "", err
+		}
+		if latest == "" || info.ModTime().After(latestTime) {
+			latest, latestTime = entry.Version, info.ModTime()
+		}
+	}
+	return latest, nil
+}
+
+// defines the kinds of cache entry
+const (
+	CacheKindProtoc     = "protoc"
+	CacheKindPlugin     = "plugin"
+	CacheKindRepository = "repository"
+	CacheKindArchive    = "archive"
+	CacheKindInclude    = "include"
+)
+
+// CacheEntry defines an installed protoc, plugin or repository in the storage dir
+type CacheEntry struct {
+	Kind string
+	// Name is the path of plugin, the path of repository without scheme, or "protoc"
+	Name string
+	// Version is the version of protoc and plugin, the commit id of repository,
+	// or the sha256 checksum of archive
+	Version string
+	// Suffix is the suffix of the repository and archive filtered by include patterns, e.g. +1a2b3c4d
+	Suffix string
+	// Dir is the directory holding the entry
+	Dir string
+	// Binary is the executable file of protoc and plugin, it is empty for repository
+	Binary string
+	// Incomplete means the installation in Dir is interrupted or can not be verified,
+	// it is never used and can only be pruned
+	Incomplete bool
+	Size       int64
+	LastUsed   time.Time
+}
+
+// String implements the fmt.Stringer interface
+func (c *CacheEntry) String() string {
+	return c.Name + "@" + c.Version + c.Suffix
+}
+
+// ListCacheEntries is used to list the installed protoc, plugins and repositories
+func ListCacheEntries(storageDir string) ([]*CacheEntry, error) {
+	var entries []*CacheEntry
+	protocVersions, err := ListInstalledProtocVersions(storageDir)
+	if err != nil {
+		return nil, err
+	}
+	for _, version := range protocVersions {
+		entries = append(entries, &CacheEntry{
+			Kind:    CacheKindProtoc,
+			Name:    "protoc",
+			Version: version,
+			Dir:     PathForProtocDir(storageDir, version),
+			Binary:  PathForProtoc(storageDir, version),
+		})
+	}
+	incompleteProtocs, err := listIncompleteProtocs(storageDir, protocVersions)
+	if err != nil {
+		return nil, err
+	}
+	entries = append(entries, incompleteProtocs...)
+	plugins, err := listInstalledPlugins(storageDir)
+	if err != nil {
+		return nil, err
+	}
+	entries = append(entries, plugins...)
+	repositories, err := listInstalledGitRepos(storageDir)
+	if err != nil {
+		return nil, err
+	}
+	entries = append(entries, repositories...)
+	legacyRepositories, err := listLegacyGitRepos(storageDir)
+	if err != nil {
+		return nil, err
+	}
+	entries = append(entries, legacyRepositories...)
+	archives, err := listInstalledArchiveRepos(storageDir)
+	if err != nil {
+		return nil, err
+	}
+	entries = append(entries, archives...)
+	for _, entry := range entries {
+		info, err := os.Stat(entry.Dir)
+		if err != nil {
+			return nil, err
+		}
+		entry.LastUsed = info.ModTime()
+		entry.Size, err = util.GetDirSize(entry.Dir)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return entries, nil
+}
+
+// listIncompleteProtocs is used to list the protoc dirs whose versions are not in the installed versions
+func listIncompleteProtocs(storageDir string, installed []string) ([]*CacheEntry, error) {
+	names, err := readDirNames(PathForProtocDir(storageDir, ""))
+	if err != nil {
+		return nil, err
+	}
+	var entries []*CacheEntry
+	for _, name := range names {
+		version := "v" + name
+		if util.Contains(installed, version) {
+			continue
+		}
+		entries = append(entries, &CacheEntry{
+			Kind:       CacheKindProtoc,
+			Name:       "protoc",
+			Version:    version,
+			Dir:        PathForProtocDir(storageDir, version),
+			Incomplete: true,
+		})
+	}
+	return entries, nil
+}
+
+func listInstalledPlugins(storageDir string) ([]*CacheEntry, error) {
+	root := PathForPlugins(storageDir)
+	versions := map[string][]string{}
+	err := filepath.Walk(root, func(dir string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && dir == root {
+				return nil
+			}
+			return err
+		}
+		// the plugins built from local sources are keyed by the hash of sources, which can not be
+		// referenced by config files, so they are not listed in case the ones in use are pruned
+		if info.IsDir() && dir == filepath.Join(root, "local") {
+			return filepath.SkipDir
+		}
+		if !info.IsDir() || !strings.Contains(info.Name(), "@") {
+			return nil
+		}
+		rel, err := filepath.Rel(root, dir)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		index := strings.LastIndex(rel, "@")
+		path, err := module.UnescapePath(rel[:index])
+		if err != nil {
+			return filepath.SkipDir
+		}
+		version, err := module.UnescapeVersion(rel[index+1:])
+		if err != nil {
+			return filepath.SkipDir
+		}
+		versions[path] = append(versions[path], version)
+		return filepath.SkipDir
+	})
+	if err != nil {
+		return nil, err
+	}
+	paths := make([]string, 0, len(versions))
+	for path := range versions {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	var entries []*CacheEntry
+	for _, path := range paths {
+		malformed, wellFormed := util.SortSemanticVersion(versions[path])
+		for _, version := range append(malformed, wellFormed...) {
+			exists, local, err := IsPluginInstalled(context.TODO(), storageDir, path, version)
+			if err != nil {
+				return nil, err
+			}
+			if !exists {
+				dir, err := PathForPluginDir(storageDir, path, version)
+				if err != nil {
+					return nil, err
+				}
+				entries = append(entries, &CacheEntry{
+					Kind:       CacheKindPlugin,
+					Name:       path,
+					Version:    version,
+					Dir:        dir,
+					Incomplete: true,
+				})
+				continue
+			}
+			entries = append(entries, &CacheEntry{
+				Kind:    CacheKindPlugin,
+				Name:    path,
+				Version: version,
+				Dir:     filepath.Dir(local),
+				Binary:  local,
+			})
+		}
+	}
+	return entries, nil
+}
+
+func listInstalledGitRepos(storageDir string) ([]*CacheEntry, error) {
+	root := PathForGitReposRoot(storageDir)
+	var entries []*CacheEntry
+	err := filepath.Walk(root, func(dir string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && dir == root {
+				return nil
+			}
+			return err
+		}
+		if !info.IsDir() || dir == root {
+			return nil
+		}
+		// the legacy repos are listed by listLegacyGitRepos
+		if filepath.Dir(dir) == root && isLegacyGitRepoDir(info.Name()) {
+			return filepath.SkipDir
+		}
+		if !strings.Contains(info.Name(), "@") {
+			return nil
+		}
+		rel, err := filepath.Rel(root, dir)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		index := strings.LastIndex(rel, "@")
+		name, version := rel[:index], rel[index+1:]
+		var suffix string
+		if i := strings.Index(version, "+"); i != -1 {
+			version, suffix = version[:i], version[i:]
+		}
+		// the repo installed before the completion marker is introduced is adopted
+		codePath := filepath.Join(dir, filepath.FromSlash(name))
+		completed, err := adoptLegacyInstall(context.TODO(), storageDir, codePath, func() (bool, error) {
+			return isDirNotEmpty(codePath)
+		})
+		if err != nil {
+			return err
+		}
+		entries = append(entries, &CacheEntry{
+			Kind:       CacheKindRepository,
+			Name:       name,
+			Version:    version,
+			Suffix:     suffix,
+			Dir:        dir,
+			Incomplete: !completed,
+		})
+		return filepath.SkipDir
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].Name < entries[j].Name
+	})
+	return entries, nil
+}
+
+func listInstalledArchiveRepos(storageDir string) ([]*CacheEntry, error) {
+	root := PathForArchiveReposRoot(storageDir)
+	var entries []*CacheEntry
+	err := filepath.Walk(root, func(dir string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && dir == root {
+				return nil
+			}
+			return err
+		}
+		if !info.IsDir() || !strings.Contains(info.Name(), "@") {
+			return nil
+		}
+		rel, err := filepath.Rel(root, dir)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		index := strings.LastIndex(rel, "@")
+		name, checksum := rel[:index], rel[index+1:]
+		var suffix string
+		if i := strings.Index(checksum, "+"); i != -1 {
+			checksum, suffix = checksum[:i], checksum[i:]
+		}
+		completed, err := isInstallCompleted(dir)
+		if err != nil {
+			return err
+		}
+		if completed {
+			entries = append(entries, &CacheEntry{
+				Kind:    CacheKindArchive,
+				Name:    name,
+				Version: checksum,
+				Suffix:  suffix,
+				Dir:     dir,
+			})
+		}
+		return filepath.SkipDir
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].Name < entries[j].Name
+	})
+	return entries, nil
+}
+
+// isLegacyGitRepoDir reports whether the directory under the root of git repos
+// is a repo stored in the legacy layout gits/<commit>/<name>
+func isLegacyGitRepoDir(name string) bool {
+	if len(name) < 7 {
+		return false
+	}
+	for _, c := range name {
+		if !('0' <= c && c <= '9' || 'a' <= c && c <= 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+// listLegacyGitRepos is used to list the repos stored in the legacy layout gits/<commit>/<name>,
+// which are no longer used but can be pruned
+func listLegacyGitRepos(storageDir string) ([]*CacheEntry, error) {
+	commits, err := readDirNames(PathForGitReposRoot(storageDir))
+	if err != nil {
+		return nil, err
+	}
+	var entries []*CacheEntry
+	for _, commitId := range commits {
+		if !isLegacyGitRepoDir(commitId) {
+			continue
+		}
+		dir := filepath.Join(PathForGitReposRoot(storageDir), commitId)
+		name, err := inferRepositoryName(dir)
+		if err != nil {
+			return nil, err
+		}
+		// the legacy repos are installed before the completion marker is introduced
+		if name == "" {
+			continue
+		}
+		entries = append(entries, &CacheEntry{
+			Kind:    CacheKindRepository,
+			Name:    name,
+			Version: commitId,
+			Dir:     dir,
+		})
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].Name < entries[j].Name
+	})
+	return entries, nil
+}
+
+// inferRepositoryName is used to infer the repository path from the code directory,
+// the directories are walked down until the one with multiple children, e.g. github.com/googleapis/googleapis
+func inferRepositoryName(dir string) (string, error) {
+	var items []string
+	for {
+		children, err := os.ReadDir(dir)
+		if err != nil {
+			return "", err
+		}
+		if len(children) != 1 || !children[0].IsDir() {
+			break
+		}
+		items = append(items, children[0].Name())
+		dir = filepath.Join(dir, children[0].Name())
+	}
+	return strings.Join(items, "/"), nil
+}
+
+// MarkCacheUsed is used to update the last used time of cache entry in dir
+func MarkCacheUsed(dir string) error {
+	now := time.Now()
+	return os.Chtimes(dir, now, now)
+}
+
+// RemoveCacheEntry is used to remove the cache entry from storage dir
+func RemoveCacheEntry(entry *CacheEntry) error {
+	return os.RemoveAll(entry.Dir)
+}
+
+func hashFile(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// RecordChecksum is used to record the sha256 checksum of binary, which can be verified by VerifyChecksum
+func RecordChecksum(binary string) error {
+	sum, err := hashFile(binary)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(PathForChecksum(binary), []byte(sum+"\n"), 0644)
+}
+
+// VerifyChecksum is used to verify the binary against its recorded checksum,
+// recorded is false if no checksum is recorded for it
+func VerifyChecksum(binary string) (recorded bool, err error) {
+	data, err := ioutil.ReadFile(PathForChecksum(binary))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	expected := strings.TrimSpace(string(data))
+	actual, err := hashFile(binary)
+	if err != nil {
+		return true, err
+	}
+	if actual != expected {
+		return true, &ErrChecksumMismatch{
+			Path:     binary,
+			Expected: expected,
+			Actual:   actual,
+		}
+	}
+	return true, nil
+}
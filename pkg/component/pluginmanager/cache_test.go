@@ -0,0 +1,155 @@
+// Copyright 2021 storyicon@foxmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pluginmanager_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/storyicon/powerproto/pkg/component/pluginmanager"
+)
+
+var _ = Describe("Cache", func() {
+	const pluginPath = "github.com/envoyproxy/protoc-gen-validate"
+	const repo = "https://github.com/googleapis/googleapis"
+	const commitId = "75e9812478607db997376ccea247dd6928f70f45"
+	var storageDir string
+	BeforeEach(func() {
+		var err error
+		storageDir, err = ioutil.TempDir("", "powerproto-cache")
+		Expect(err).To(BeNil())
+	})
+	AfterEach(func() {
+		os.RemoveAll(storageDir)
+	})
+
+	It("should able to list cache entries", func() {
+		touchInstalled(pluginmanager.PathForProtoc(storageDir, "3.17.3"))
+		local, err := pluginmanager.PathForPlugin(storageDir, pluginPath, "v0.6.1")
+		Expect(err).To(BeNil())
+		touchInstalled(local)
+		// the plugins built from local sources are not listed
+		touchInstalled(pluginmanager.PathForLocalPlugin(storageDir, "protoc-gen-foo", "0123456789abcdef"))
+		codePath, err := pluginmanager.PathForGitReposCode(storageDir, repo, commitId, nil)
+		Expect(err).To(BeNil())
+		touchInstalled(filepath.Join(codePath, "README.md"))
+		touchFile(filepath.Join(codePath, "google", "api", "http.proto"))
+
+		entries, err := pluginmanager.ListCacheEntries(storageDir)
+		Expect(err).To(BeNil())
+		Expect(entries).To(HaveLen(3))
+		Expect(entries[0].Kind).To(Equal(pluginmanager.CacheKindProtoc))
+		Expect(entries[0].String()).To(Equal("protoc@v3.17.3"))
+		Expect(entries[1].Kind).To(Equal(pluginmanager.CacheKindPlugin))
+		Expect(entries[1].String()).To(Equal(pluginPath + "@v0.6.1"))
+		Expect(entries[1].Binary).To(Equal(local))
+		Expect(entries[2].Kind).To(Equal(pluginmanager.CacheKindRepository))
+		Expect(entries[2].String()).To(Equal("github.com/googleapis/googleapis@" + commitId))
+		dir, err := pluginmanager.PathForGitRepos(storageDir, repo, commitId, nil)
+		Expect(err).To(BeNil())
+		Expect(entries[2].Dir).To(Equal(dir))
+
+		Expect(pluginmanager.RemoveCacheEntry(entries[1])).To(BeNil())
+		entries, err = pluginmanager.ListCacheEntries(storageDir)
+		Expect(err).To(BeNil())
+		Expect(entries).To(HaveLen(2))
+	})
+	It("should adopt the installations made before the completion marker", func() {
+		protoc := pluginmanager.PathForProtoc(storageDir, "3.17.3")
+		touchFile(protoc)
+		Expect(os.MkdirAll(pluginmanager.PathForProtocDir(storageDir, "3.9.0"), 0755)).To(BeNil())
+		local, err := pluginmanager.PathForPlugin(storageDir, pluginPath, "v0.6.1")
+		Expect(err).To(BeNil())
+		touchFile(local)
+		codePath, err := pluginmanager.PathForGitReposCode(storageDir, repo, commitId, nil)
+		Expect(err).To(BeNil())
+		touchFile(filepath.Join(codePath, "google", "api", "http.proto"))
+
+		entries, err := pluginmanager.ListCacheEntries(storageDir)
+		Expect(err).To(BeNil())
+		Expect(entries).To(HaveLen(4))
+		Expect(entries[0].String()).To(Equal("protoc@v3.17.3"))
+		Expect(entries[0].Incomplete).To(BeFalse())
+		Expect(entries[1].String()).To(Equal("protoc@v3.9.0"))
+		Expect(entries[1].Incomplete).To(BeTrue())
+		Expect(entries[2].String()).To(Equal(pluginPath + "@v0.6.1"))
+		Expect(entries[2].Incomplete).To(BeFalse())
+		Expect(entries[3].String()).To(Equal("github.com/googleapis/googleapis@" + commitId))
+		Expect(entries[3].Incomplete).To(BeFalse())
+		for _, dir := range []string{filepath.Dir(protoc), filepath.Dir(local), codePath} {
+			Expect(pluginmanager.PathForCompletionMarker(dir)).To(BeAnExistingFile())
+		}
+
+		versions, err := pluginmanager.ListInstalledProtocVersions(storageDir)
+		Expect(err).To(BeNil())
+		Expect(versions).To(Equal([]string{"v3.17.3"}))
+		latest, err := pluginmanager.GetLatestInstalledGitRepo(storageDir, repo)
+		Expect(err).To(BeNil())
+		Expect(latest).To(Equal(commitId))
+	})
+	It("should list the empty repository dirs as incomplete", func() {
+		codePath, err := pluginmanager.PathForGitReposCode(storageDir, repo, commitId, nil)
+		Expect(err).To(BeNil())
+		Expect(os.MkdirAll(codePath, 0755)).To(BeNil())
+
+		entries, err := pluginmanager.ListCacheEntries(storageDir)
+		Expect(err).To(BeNil())
+		Expect(entries).To(HaveLen(1))
+		Expect(entries[0].Incomplete).To(BeTrue())
+		latest, err := pluginmanager.GetLatestInstalledGitRepo(storageDir, repo)
+		Expect(err).To(BeNil())
+		Expect(latest).To(BeEmpty())
+	})
+	It("should list the repositories in legacy layout", func() {
+		// the repositories in legacy layout have no completion marker
+		codePath := filepath.Join(storageDir, "gits", commitId, "github.com", "googleapis", "googleapis")
+		touchFile(filepath.Join(codePath, "README.md"))
+		touchFile(filepath.Join(codePath, "google", "api", "http.proto"))
+
+		entries, err := pluginmanager.ListCacheEntries(storageDir)
+		Expect(err).To(BeNil())
+		Expect(entries).To(HaveLen(1))
+		Expect(entries[0].String()).To(Equal("github.com/googleapis/googleapis@" + commitId))
+		Expect(entries[0].Dir).To(Equal(filepath.Join(storageDir, "gits", commitId)))
+
+		// the legacy repositories are not used
+		latest, err := pluginmanager.GetLatestInstalledGitRepo(storageDir, repo)
+		Expect(err).To(BeNil())
+		Expect(latest).To(BeEmpty())
+
+		Expect(pluginmanager.RemoveCacheEntry(entries[0])).To(BeNil())
+		Expect(filepath.Join(storageDir, "gits", commitId)).NotTo(BeADirectory())
+	})
+	It("should able to verify checksum", func() {
+		local := pluginmanager.PathForProtoc(storageDir, "3.17.3")
+		touchFile(local)
+		recorded, err := pluginmanager.VerifyChecksum(local)
+		Expect(err).To(BeNil())
+		Expect(recorded).To(BeFalse())
+
+		Expect(pluginmanager.RecordChecksum(local)).To(BeNil())
+		recorded, err = pluginmanager.VerifyChecksum(local)
+		Expect(err).To(BeNil())
+		Expect(recorded).To(BeTrue())
+
+		Expect(ioutil.WriteFile(local, []byte("modified"), 0755)).To(BeNil())
+		_, err = pluginmanager.VerifyChecksum(local)
+		Expect(err).To(BeAssignableToTypeOf(&pluginmanager.ErrChecksumMismatch{}))
+	})
+})
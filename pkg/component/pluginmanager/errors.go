@@ -30,6 +30,16 @@ type ErrGoList struct {
 	*command.ErrCommandExec
 }
 
+// ErrGoModDownload defines the go mod download error
+type ErrGoModDownload struct {
+	*command.ErrCommandExec
+}
+
+// ErrGitFetch defines the git fetch error
+type ErrGitFetch struct {
+	*command.ErrCommandExec
+}
+
 // ErrHTTPDownload defines the download error
 type ErrHTTPDownload struct {
 	Url  string
@@ -41,3 +51,25 @@ type ErrHTTPDownload struct {
 func (err *ErrHTTPDownload) Error() string {
 	return fmt.Sprintf("failed to download %s, code: %d, err: %s", err.Url, err.Code, err.Err)
 }
+
+// ErrOffline defines the error of network access in offline mode
+type ErrOffline struct {
+	Action string
+}
+
+// Error implements the error interface
+func (err *ErrOffline) Error() string {
+	return fmt.Sprintf("network access is forbidden in offline mode: %s", err.Action)
+}
+
+// ErrChecksumMismatch defines the error that the checksum of binary does not match the recorded one
+type ErrChecksumMismatch struct {
+	Path     string
+	Expected string
+	Actual   string
+}
+
+// Error implements the error interface
+func (err *ErrChecksumMismatch) Error() string {
+	return fmt.Sprintf("checksum mismatch of %s, expected: %s, actual: %s", err.Path, err.Expected, err.Actual)
+}
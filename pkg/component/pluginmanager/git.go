@@ -17,15 +17,20 @@ package pluginmanager
 import (
 	"context"
 	"fmt"
-	"net/http"
+	"io/fs"
+	"net/url"
 	"os"
 	"path"
 	"path/filepath"
 	"strings"
 
+	"github.com/bmatcuk/doublestar"
 	"github.com/mholt/archiver"
-	"github.com/storyicon/powerproto/pkg/util"
+	"github.com/pkg/errors"
 
+	"github.com/storyicon/powerproto/pkg/configs"
+	"github.com/storyicon/powerproto/pkg/consts"
+	"github.com/storyicon/powerproto/pkg/util"
 	"github.com/storyicon/powerproto/pkg/util/command"
 	"github.com/storyicon/powerproto/pkg/util/logger"
 )
@@ -35,27 +40,64 @@ type ErrGitList struct {
 	*command.ErrCommandExec
 }
 
+// ParseGitRef is used to parse the version of repository into the git ref to track,
+// e.g. latest is HEAD, branch:master is refs/heads/master and tag:v1.2.0 is refs/tags/v1.2.0.
+// ok is false if the version is a commit id
+func ParseGitRef(version string) (ref string, ok bool) {
+	switch {
+	case version == "latest":
+		return "HEAD", true
+	case strings.HasPrefix(version, configs.RepositoryRefBranchPrefix):
+		return "refs/heads/" + strings.TrimPrefix(version, configs.RepositoryRefBranchPrefix), true
+	case strings.HasPrefix(version, configs.RepositoryRefTagPrefix):
+		return "refs/tags/" + strings.TrimPrefix(version, configs.RepositoryRefTagPrefix), true
+	}
+	return "", false
+}
+
 // GetGitLatestCommitId is used to get the latest commit id
 func GetGitLatestCommitId(ctx context.Context, log logger.Logger, repo string) (string, error) {
+	return GetGitCommitId(ctx, log, repo, "HEAD")
+}
+
+// GetGitCommitId is used to get the commit id that the ref points to,
+// the annotated tags are peeled to the commits
+func GetGitCommitId(ctx context.Context, log logger.Logger, repo string, ref string) (string, error) {
+	if consts.IsOffline(ctx) {
+		return "", &ErrOffline{Action: "git ls-remote " + repo}
+	}
 	data, err := command.Execute(ctx, log, "", "git", []string{
-		"ls-remote", repo, "HEAD",
+		"ls-remote", repo, ref, ref + "^{}",
 	}, nil)
 	if err != nil {
 		return "", &ErrGitList{
 			ErrCommandExec: err.(*command.ErrCommandExec),
 		}
 	}
-	f := strings.Fields(string(data))
-	if len(f) != 2 {
-		return "", &ErrGitList{
-			ErrCommandExec: err.(*command.ErrCommandExec),
+	var commitId string
+	for _, line := range strings.Split(string(data), "\n") {
+		f := strings.Fields(line)
+		if len(f) != 2 {
+			continue
+		}
+		if f[1] == ref+"^{}" {
+			return f[0], nil
 		}
+		if f[1] == ref {
+			commitId = f[0]
+		}
+	}
+	if commitId == "" {
+		return "", errors.Errorf("ref %s is not found in %s", ref, repo)
 	}
-	return f[0], nil
+	return commitId, nil
 }
 
 // ListGitTags is used to list the git tags of specified repository
 func ListGitTags(ctx context.Context, log logger.Logger, repo string) ([]string, error) {
+	if consts.IsOffline(ctx) {
+		return nil, &ErrOffline{Action: "git ls-remote " + repo}
+	}
 	data, err := command.Execute(ctx, log, "", "git", []string{
 		"ls-remote", "--tags", "--refs", repo,
 	}, nil)
@@ -78,61 +120,210 @@ func ListGitTags(ctx context.Context, log logger.Logger, repo string) ([]string,
 	return append(malformed, wellFormed...), nil
 }
 
-// GithubArchive is github archive
-type GithubArchive struct {
+// DefaultArchiveHosts defines the archive url templates of well-known git hosts,
+// $URI, $REPO_NAME and $COMMIT can be used in them
+var DefaultArchiveHosts = map[string]string{
+	"github.com":    "$URI/archive/$COMMIT.zip",
+	"gitlab.com":    "$URI/-/archive/$COMMIT/$REPO_NAME-$COMMIT.zip",
+	"bitbucket.org": "$URI/get/$COMMIT.zip",
+	"gitea.com":     "$URI/archive/$COMMIT.zip",
+	"codeberg.org":  "$URI/archive/$COMMIT.zip",
+}
+
+// Archive is the extracted source code archive of repository
+type Archive struct {
 	uri       string
 	commit    string
 	workspace string
+	dir       string
 }
 
-// GetGithubArchive is used to download github archive
-func GetGithubArchive(ctx context.Context, uri string, commitId string) (*GithubArchive, error) {
-	filename := fmt.Sprintf("%s.zip", commitId)
-	addr := fmt.Sprintf("%s/archive/%s", uri, filename)
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, addr, nil)
+// DownloadGitArchive is used to download and extract the source code archive of git repository at commit.
+// The mirrors are the url templates tried in order, $URI, $HOST, $REPO_PATH, $REPO_NAME,
+// $COMMIT, $FILENAME and $ARCHIVE_URL can be used in them. $ARCHIVE_URL is rendered from
+// the template of the host in hosts, and the mirrors using it are skipped for unknown hosts
+func DownloadGitArchive(ctx context.Context, mirrors []string, hosts map[string]string,
+	uri string, commitId string) (*Archive, error) {
+	parsed, err := url.Parse(uri)
 	if err != nil {
-		return nil, &ErrHTTPDownload{
-			Url: addr,
-			Err: err,
+		return nil, err
+	}
+	filename := fmt.Sprintf("%s.zip", commitId)
+	variables := map[string]string{
+		"URI":       strings.TrimSuffix(strings.TrimSuffix(uri, "/"), ".git"),
+		"HOST":      parsed.Host,
+		"REPO_PATH": strings.TrimSuffix(strings.Trim(parsed.Path, "/"), ".git"),
+		"REPO_NAME": strings.TrimSuffix(path.Base(parsed.Path), ".git"),
+		"COMMIT":    commitId,
+		"FILENAME":  filename,
+	}
+	if template, ok := hosts[parsed.Host]; ok {
+		variables["ARCHIVE_URL"] = util.RenderWithEnv(template, variables)
+	}
+	var available []string
+	for _, mirror := range mirrors {
+		if variables["ARCHIVE_URL"] == "" && strings.Contains(mirror, "$ARCHIVE_URL") {
+			continue
 		}
+		available = append(available, mirror)
+	}
+	if len(available) == 0 {
+		return nil, errors.Errorf("no archive url is known for host %s", parsed.Host)
 	}
 	workspace, err := os.MkdirTemp("", "")
 	if err != nil {
 		return nil, err
 	}
-	resp, err := http.DefaultClient.Do(req)
-	if err != nil {
-		return nil, &ErrHTTPDownload{
-			Url: addr,
-			Err: err,
-		}
-	}
 	zipFilePath := filepath.Join(workspace, filename)
-	if err := downloadFile(resp, zipFilePath); err != nil {
-		return nil, &ErrHTTPDownload{
-			Url:  addr,
-			Err:  err,
-			Code: resp.StatusCode,
-		}
+	if err := downloadFromMirrors(ctx, available, variables, zipFilePath); err != nil {
+		os.RemoveAll(workspace)
+		return nil, err
 	}
+	dir := filepath.Join(workspace, "code")
 	zip := archiver.NewZip()
-	if err := zip.Unarchive(zipFilePath, workspace); err != nil {
+	if err := zip.Unarchive(zipFilePath, dir); err != nil {
+		os.RemoveAll(workspace)
+		return nil, err
+	}
+	// the archive contains a single top-level directory,
+	// but its name differs among git hosts
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		os.RemoveAll(workspace)
 		return nil, err
 	}
-	return &GithubArchive{
+	if len(entries) == 1 && entries[0].IsDir() {
+		dir = filepath.Join(dir, entries[0].Name())
+	}
+	return &Archive{
 		uri:       uri,
 		commit:    commitId,
 		workspace: workspace,
+		dir:       dir,
 	}, nil
 }
 
 // GetLocalDir is used to get local dir of archive
-func (c *GithubArchive) GetLocalDir() string {
-	dir := path.Base(c.uri) + "-" + c.commit
-	return filepath.Join(c.workspace, dir)
+func (c *Archive) GetLocalDir() string {
+	return c.dir
 }
 
 // Clear is used to clear the workspace
-func (c *GithubArchive) Clear() error {
+func (c *Archive) Clear() error {
 	return os.RemoveAll(c.workspace)
 }
+
+// GitCheckout is the source code of git repository checked out at specified commit
+type GitCheckout struct {
+	workspace string
+}
+
+// FetchGitCommit is used to shallow fetch the specified commit of git repository
+// and check it out, it works with any git server. If the server refuses to fetch
+// a commit that is not the tip of refs, the whole history is fetched instead
+func FetchGitCommit(ctx context.Context, log logger.Logger, uri string, commitId string) (*GitCheckout, error) {
+	if consts.IsOffline(ctx) {
+		return nil, &ErrOffline{Action: "git fetch " + uri}
+	}
+	workspace, err := os.MkdirTemp("", "")
+	if err != nil {
+		return nil, err
+	}
+	checkout := &GitCheckout{
+		workspace: workspace,
+	}
+	git := func(args ...string) error {
+		_, err := command.Execute(ctx, log, checkout.GetLocalDir(), "git", args, nil)
+		if err != nil {
+			return &ErrGitFetch{
+				ErrCommandExec: err.(*command.ErrCommandExec),
+			}
+		}
+		return nil
+	}
+	if err := os.MkdirAll(checkout.GetLocalDir(), fs.ModePerm); err != nil {
+		checkout.Clear()
+		return nil, err
+	}
+	if err := git("init", "--quiet"); err != nil {
+		checkout.Clear()
+		return nil, err
+	}
+	if err := git("fetch", "--quiet", "--depth", "1", uri, commitId); err != nil {
+		log.LogDebug(map[string]interface{}{
+			"uri":    uri,
+			"commit": commitId,
+		}, "failed to fetch the commit shallowly, fetch the whole history: %s", err)
+		if err := git("fetch", "--quiet", uri, "+refs/heads/*:refs/remotes/origin/*", "+refs/tags/*:refs/tags/*"); err != nil {
+			checkout.Clear()
+			return nil, err
+		}
+	}
+	if err := git("-c", "advice.detachedHead=false", "checkout", "--quiet", commitId); err != nil {
+		checkout.Clear()
+		return nil, err
+	}
+	if err := os.RemoveAll(filepath.Join(checkout.GetLocalDir(), ".git")); err != nil {
+		checkout.Clear()
+		return nil, err
+	}
+	return checkout, nil
+}
+
+// GetLocalDir is used to get local dir of checkout
+func (c *GitCheckout) GetLocalDir() string {
+	return filepath.Join(c.workspace, "code")
+}
+
+// Clear is used to clear the workspace
+func (c *GitCheckout) Clear() error {
+	return os.RemoveAll(c.workspace)
+}
+
+// filterFiles is used to remove the files in dir that do not match any of the include patterns,
+// and the directories left empty. Nothing is removed if no pattern is specified
+func filterFiles(dir string, include []string) error {
+	if len(include) == 0 {
+		return nil
+	}
+	var dirs []string
+	err := filepath.Walk(dir, func(path string, info fs.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			dirs = append(dirs, path)
+			return nil
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		for _, pattern := range include {
+			matched, err := doublestar.Match(pattern, filepath.ToSlash(rel))
+			if err != nil {
+				return errors.Wrapf(err, "invalid include pattern %s", pattern)
+			}
+			if matched {
+				return nil
+			}
+		}
+		return os.Remove(path)
+	})
+	if err != nil {
+		return err
+	}
+	// the directories are removed from the deepest
+	for i := len(dirs) - 1; i > 0; i-- {
+		entries, err := os.ReadDir(dirs[i])
+		if err != nil {
+			return err
+		}
+		if len(entries) == 0 {
+			if err := os.Remove(dirs[i]); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,205 @@
+// Copyright 2021 storyicon@foxmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pluginmanager_test
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/storyicon/powerproto/pkg/component/pluginmanager"
+	"github.com/storyicon/powerproto/pkg/util"
+	"github.com/storyicon/powerproto/pkg/util/logger"
+)
+
+func runGit(dir string, args ...string) string {
+	args = append([]string{"-c", "user.name=test", "-c", "user.email=test@example.com"}, args...)
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	data, err := cmd.CombinedOutput()
+	Expect(err).To(BeNil(), string(data))
+	return strings.TrimSpace(string(data))
+}
+
+// newBareRepo creates a bare repository with a commit for each of the files,
+// and returns its file:// uri and the commit ids
+func newBareRepo(root string, files ...string) (string, []string) {
+	bare := filepath.Join(root, "remote.git")
+	work := filepath.Join(root, "work")
+	Expect(os.MkdirAll(work, 0755)).To(BeNil())
+	runGit(root, "init", "--quiet", "--bare", bare)
+	runGit(work, "init", "--quiet")
+	var commits []string
+	for _, file := range files {
+		touchFile(filepath.Join(work, file))
+		runGit(work, "add", "-A")
+		runGit(work, "commit", "--quiet", "-m", file)
+		commits = append(commits, runGit(work, "rev-parse", "HEAD"))
+	}
+	runGit(work, "push", "--quiet", bare, "HEAD:refs/heads/main")
+	runGit(bare, "symbolic-ref", "HEAD", "refs/heads/main")
+	return (&url.URL{Scheme: "file", Path: filepath.ToSlash(bare)}).String(), commits
+}
+
+var _ = Describe("Git", func() {
+	var root string
+	BeforeEach(func() {
+		var err error
+		root, err = ioutil.TempDir("", "powerproto-git")
+		Expect(err).To(BeNil())
+	})
+	AfterEach(func() {
+		os.RemoveAll(root)
+	})
+
+	It("should able to fetch the exact commit", func() {
+		uri, commits := newBareRepo(root, "a/a.proto", "b/b.proto")
+		for i, commit := range commits {
+			checkout, err := pluginmanager.FetchGitCommit(context.TODO(), logger.NewDefault("git"), uri, commit)
+			Expect(err).To(BeNil())
+			exists, err := util.IsFileExists(filepath.Join(checkout.GetLocalDir(), "b", "b.proto"))
+			Expect(err).To(BeNil())
+			Expect(exists).To(Equal(i == 1))
+			exists, err = util.IsDirExists(filepath.Join(checkout.GetLocalDir(), ".git"))
+			Expect(err).To(BeNil())
+			Expect(exists).To(BeFalse())
+			Expect(checkout.Clear()).To(BeNil())
+		}
+	})
+	It("should able to resolve branches and tags", func() {
+		uri, commits := newBareRepo(root, "a/a.proto", "b/b.proto")
+		work := filepath.Join(root, "work")
+		runGit(work, "tag", "v1.0.0", commits[0])
+		runGit(work, "tag", "-a", "-m", "annotated", "v1.1.0", commits[0])
+		runGit(work, "push", "--quiet", filepath.Join(root, "remote.git"),
+			commits[0]+":refs/heads/release", "--tags")
+
+		cfg := pluginmanager.NewConfig()
+		cfg.StorageDir = filepath.Join(root, "storage")
+		manager, err := pluginmanager.NewBasicPluginManager(cfg, logger.NewDefault("git"))
+		Expect(err).To(BeNil())
+		for ref, expected := range map[string]string{
+			"latest":         commits[1],
+			"branch:main":    commits[1],
+			"branch:release": commits[0],
+			"tag:v1.0.0":     commits[0],
+			"tag:v1.1.0":     commits[0],
+		} {
+			commitId, err := manager.GetGitRepoLatestVersion(context.TODO(), uri, ref)
+			Expect(err).To(BeNil())
+			Expect(commitId).To(Equal(expected), ref)
+		}
+		_, err = manager.GetGitRepoLatestVersion(context.TODO(), uri, "tag:v2.0.0")
+		Expect(err).NotTo(BeNil())
+		_, err = manager.GetGitRepoLatestVersion(context.TODO(), uri, commits[0])
+		Expect(err).NotTo(BeNil())
+
+		ref, ok := pluginmanager.ParseGitRef("branch:feature/a")
+		Expect(ok).To(BeTrue())
+		Expect(ref).To(Equal("refs/heads/feature/a"))
+		_, ok = pluginmanager.ParseGitRef(commits[0])
+		Expect(ok).To(BeFalse())
+	})
+	It("should fallback to git fetch for unknown hosts", func() {
+		uri, commits := newBareRepo(root, "a/a.proto")
+		latest, err := pluginmanager.GetGitLatestCommitId(context.TODO(), logger.NewDefault("git"), uri)
+		Expect(err).To(BeNil())
+		Expect(latest).To(Equal(commits[0]))
+
+		cfg := pluginmanager.NewConfig()
+		cfg.StorageDir = filepath.Join(root, "storage")
+		manager, err := pluginmanager.NewBasicPluginManager(cfg, logger.NewDefault("git"))
+		Expect(err).To(BeNil())
+		local, err := manager.InstallGitRepo(context.TODO(), uri, latest, nil)
+		Expect(err).To(BeNil())
+		exists, _, err := manager.IsGitRepoInstalled(context.TODO(), uri, latest, nil)
+		Expect(err).To(BeNil())
+		Expect(exists).To(BeTrue())
+		codePath, err := pluginmanager.PathForGitReposCode(cfg.StorageDir, uri, latest, nil)
+		Expect(err).To(BeNil())
+		Expect(strings.HasPrefix(codePath, local)).To(BeTrue())
+		exists, err = util.IsFileExists(filepath.Join(codePath, "a", "a.proto"))
+		Expect(err).To(BeNil())
+		Expect(exists).To(BeTrue())
+	})
+	It("should keep only the files matching include patterns", func() {
+		uri, commits := newBareRepo(root, "proto/a/a.proto", "docs/README.md")
+		cfg := pluginmanager.NewConfig()
+		cfg.StorageDir = filepath.Join(root, "storage")
+		manager, err := pluginmanager.NewBasicPluginManager(cfg, logger.NewDefault("git"))
+		Expect(err).To(BeNil())
+		include := []string{"**/*.proto"}
+		filtered, err := manager.InstallGitRepo(context.TODO(), uri, commits[1], include)
+		Expect(err).To(BeNil())
+		full, err := manager.InstallGitRepo(context.TODO(), uri, commits[1], nil)
+		Expect(err).To(BeNil())
+		Expect(filtered).NotTo(Equal(full))
+
+		codePath, err := pluginmanager.PathForGitReposCode(cfg.StorageDir, uri, commits[1], include)
+		Expect(err).To(BeNil())
+		exists, err := util.IsFileExists(filepath.Join(codePath, "proto", "a", "a.proto"))
+		Expect(err).To(BeNil())
+		Expect(exists).To(BeTrue())
+		exists, err = util.IsDirExists(filepath.Join(codePath, "docs"))
+		Expect(err).To(BeNil())
+		Expect(exists).To(BeFalse())
+
+		entries, err := manager.ListInstalledGitRepos(context.TODO())
+		Expect(err).To(BeNil())
+		Expect(entries).To(HaveLen(2))
+		for _, entry := range entries {
+			Expect(entry.Version).To(Equal(commits[1]))
+		}
+	})
+	It("should download archive with the url template of host", func() {
+		const commitId = "0123456789abcdef"
+		var requested []string
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requested = append(requested, r.URL.Path)
+			w.Write(newZip("group-protos-" + commitId[:7] + "/a/a.proto"))
+		}))
+		defer server.Close()
+		parsed, err := url.Parse(server.URL)
+		Expect(err).To(BeNil())
+		archive, err := pluginmanager.DownloadGitArchive(context.TODO(), []string{
+			pluginmanager.DefaultArchiveMirror,
+		}, map[string]string{
+			parsed.Host: "$URI/-/archive/$COMMIT/$REPO_NAME-$COMMIT.zip",
+		}, server.URL+"/group/protos.git", commitId)
+		Expect(err).To(BeNil())
+		defer archive.Clear()
+		Expect(requested).To(Equal([]string{
+			"/group/protos/-/archive/" + commitId + "/protos-" + commitId + ".zip",
+		}))
+		exists, err := util.IsFileExists(filepath.Join(archive.GetLocalDir(), "a", "a.proto"))
+		Expect(err).To(BeNil())
+		Expect(exists).To(BeTrue())
+
+		_, err = pluginmanager.DownloadGitArchive(context.TODO(), []string{
+			pluginmanager.DefaultArchiveMirror,
+		}, nil, server.URL+"/group/protos", commitId)
+		Expect(err).NotTo(BeNil())
+		Expect(requested).To(HaveLen(1))
+	})
+})
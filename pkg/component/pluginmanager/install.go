@@ -0,0 +1,152 @@
+// Copyright 2021 storyicon@foxmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pluginmanager
+
+import (
+	"context"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/storyicon/powerproto/pkg/util"
+	"github.com/storyicon/powerproto/pkg/util/filelock"
+)
+
+// isInstallCompleted is used to check whether the installation in dir is completed
+func isInstallCompleted(dir string) (bool, error) {
+	return util.IsFileExists(PathForCompletionMarker(dir))
+}
+
+// adoptLegacyInstall is used to mark the installation in dir as completed if it is made
+// before the completion marker is introduced and the verify function accepts it,
+// it returns whether the installation in dir is completed
+func adoptLegacyInstall(ctx context.Context, storageDir string, dir string, verify func() (bool, error)) (bool, error) {
+	completed, err := isInstallCompleted(dir)
+	if err != nil || completed {
+		return completed, err
+	}
+	verified, err := verify()
+	if err != nil || !verified {
+		return false, err
+	}
+	lock, err := lockArtifact(ctx, storageDir, dir)
+	if err != nil {
+		return false, err
+	}
+	defer lock.Release()
+	// it may be replaced by the installation of others while waiting for the lock
+	completed, err = isInstallCompleted(dir)
+	if err != nil || completed {
+		return completed, err
+	}
+	verified, err = verify()
+	if err != nil || !verified {
+		return false, err
+	}
+	if err := ioutil.WriteFile(PathForCompletionMarker(dir), nil, 0644); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// isDirNotEmpty is used to check whether dir exists and has any children
+func isDirNotEmpty(dir string) (bool, error) {
+	children, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	return len(children) != 0, nil
+}
+
+// lockArtifact is used to take the cross-process lock of the artifact in dir,
+// so that the concurrent installations of the same artifact wait for each other
+func lockArtifact(ctx context.Context, storageDir string, dir string) (*filelock.Lock, error) {
+	return filelock.Acquire(ctx, PathForLock(storageDir, dir))
+}
+
+// newStagingDir is used to create a temporary directory on the same filesystem as the storage dir
+func newStagingDir(storageDir string, pattern string) (string, error) {
+	tempDir := PathForTemp(storageDir)
+	if err := os.MkdirAll(tempDir, fs.ModePerm); err != nil {
+		return "", err
+	}
+	staging, err := ioutil.TempDir(tempDir, pattern)
+	if err != nil {
+		return "", err
+	}
+	if err := os.Chmod(staging, fs.ModePerm); err != nil {
+		os.RemoveAll(staging)
+		return "", err
+	}
+	return staging, nil
+}
+
+// commitInstall is used to mark the staged installation as completed and rename it to dir.
+// The incomplete installation left in dir is replaced
+func commitInstall(staging string, dir string) error {
+	if err := ioutil.WriteFile(PathForCompletionMarker(staging), nil, 0644); err != nil {
+		return err
+	}
+	if err := os.RemoveAll(dir); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(dir), fs.ModePerm); err != nil {
+		return err
+	}
+	return os.Rename(staging, dir)
+}
+
+// installAtomically is used to install the artifact into dir atomically.
+// The install function fills the staging dir, which is renamed to dir after it succeeds,
+// so that an interrupted installation never leaves a half-written artifact in dir
+func installAtomically(ctx context.Context, storageDir string, dir string, install func(staging string) error) error {
+	lock, err := lockArtifact(ctx, storageDir, dir)
+	if err != nil {
+		return err
+	}
+	defer lock.Release()
+	// it may be installed by others while waiting for the lock
+	completed, err := isInstallCompleted(dir)
+	if err != nil {
+		return err
+	}
+	if completed {
+		return nil
+	}
+	staging, err := newStagingDir(storageDir, "install-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(staging)
+	if err := install(staging); err != nil {
+		return err
+	}
+	return commitInstall(staging, dir)
+}
+
+// mergeInclude is used to merge the include files into the legacy shared include dir
+func mergeInclude(ctx context.Context, storageDir string, source string) error {
+	includeDir := PathForInclude(storageDir)
+	lock, err := lockArtifact(ctx, storageDir, includeDir)
+	if err != nil {
+		return err
+	}
+	defer lock.Release()
+	return util.CopyDirectory(source, includeDir)
+}
@@ -0,0 +1,152 @@
+// Copyright 2021 storyicon@foxmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pluginmanager_test
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/storyicon/powerproto/pkg/component/pluginmanager"
+	"github.com/storyicon/powerproto/pkg/util"
+	"github.com/storyicon/powerproto/pkg/util/logger"
+)
+
+var _ = Describe("Install", func() {
+	var downloads int32
+	var server *httptest.Server
+	var storageDir string
+	BeforeEach(func() {
+		downloads = 0
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&downloads, 1)
+			w.Write(newZip(
+				filepath.ToSlash(filepath.Join("bin", util.GetBinaryFileName("protoc"))),
+				"include/google/protobuf/empty.proto",
+			))
+		}))
+		var err error
+		storageDir, err = ioutil.TempDir("", "powerproto-install")
+		Expect(err).To(BeNil())
+	})
+	AfterEach(func() {
+		server.Close()
+		os.RemoveAll(storageDir)
+	})
+
+	It("should replace the incomplete installation and install only once concurrently", func() {
+		// an interrupted installation without the binary, the one with the binary
+		// is regarded as installed before the completion marker is introduced
+		local := pluginmanager.PathForProtoc(storageDir, "v3.17.3")
+		touchFile(filepath.Join(pluginmanager.PathForProtocInclude(storageDir, "v3.17.3"), "google", "protobuf", "empty.proto"))
+		exists, _, err := pluginmanager.IsProtocInstalled(context.TODO(), storageDir, "v3.17.3")
+		Expect(err).To(BeNil())
+		Expect(exists).To(BeFalse())
+
+		var wg sync.WaitGroup
+		errs := make([]error, 4)
+		for i := range errs {
+			wg.Add(1)
+			go func(i int) {
+				defer GinkgoRecover()
+				defer wg.Done()
+				cfg := pluginmanager.NewConfig()
+				cfg.StorageDir = storageDir
+				cfg.ProtocMirrors = []string{server.URL + "/$FILENAME"}
+				manager, err := pluginmanager.NewBasicPluginManager(cfg, logger.NewDefault("install"))
+				Expect(err).To(BeNil())
+				_, errs[i] = manager.InstallProtoc(context.TODO(), "v3.17.3")
+			}(i)
+		}
+		wg.Wait()
+		for _, err := range errs {
+			Expect(err).To(BeNil())
+		}
+		Expect(atomic.LoadInt32(&downloads)).To(Equal(int32(1)))
+
+		exists, _, err = pluginmanager.IsProtocInstalled(context.TODO(), storageDir, "v3.17.3")
+		Expect(err).To(BeNil())
+		Expect(exists).To(BeTrue())
+		recorded, err := pluginmanager.VerifyChecksum(local)
+		Expect(err).To(BeNil())
+		Expect(recorded).To(BeTrue())
+		data, err := ioutil.ReadFile(local)
+		Expect(err).To(BeNil())
+		Expect(string(data)).To(Equal(filepath.ToSlash(filepath.Join("bin", util.GetBinaryFileName("protoc")))))
+		staged, err := ioutil.ReadDir(pluginmanager.PathForTemp(storageDir))
+		Expect(err).To(BeNil())
+		Expect(staged).To(BeEmpty())
+	})
+	It("should rebuild the plugin from local directory once the sources are changed", func() {
+		dir := filepath.Join(storageDir, "src")
+		write := func(name string, content string) {
+			Expect(os.MkdirAll(filepath.Dir(filepath.Join(dir, name)), 0755)).To(BeNil())
+			Expect(ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644)).To(BeNil())
+		}
+		write("go.mod", "module example.com/protoc-gen-foo\n\ngo 1.16\n")
+		write("cmd/protoc-gen-foo/main.go", "package main\n\nimport _ \"example.com/protoc-gen-foo/internal\"\n\nfunc main() {}\n")
+		write("internal/internal.go", "package internal\n")
+		write("docs/README.md", "")
+
+		module, pkg, err := pluginmanager.FindGoModule(filepath.Join(dir, "cmd", "protoc-gen-foo"))
+		Expect(err).To(BeNil())
+		Expect(module).To(Equal(dir))
+		Expect(pkg).To(Equal("./cmd/protoc-gen-foo"))
+
+		ctx := context.TODO()
+		log := logger.NewDefault("install")
+		local, err := pluginmanager.InstallPluginFromDir(ctx, log, storageDir, pluginmanager.HostPlatform(), dir, "./cmd/protoc-gen-foo")
+		Expect(err).To(BeNil())
+		Expect(filepath.Base(local)).To(Equal(util.GetBinaryFileName("protoc-gen-foo")))
+		recorded, err := pluginmanager.VerifyChecksum(local)
+		Expect(err).To(BeNil())
+		Expect(recorded).To(BeTrue())
+		again, err := pluginmanager.InstallPluginFromDir(ctx, log, storageDir, pluginmanager.HostPlatform(), dir, "./cmd/protoc-gen-foo")
+		Expect(err).To(BeNil())
+		Expect(again).To(Equal(local))
+		// the files out of the package and its dependencies are not sources
+		write("docs/README.md", "changed")
+		again, err = pluginmanager.InstallPluginFromDir(ctx, log, storageDir, pluginmanager.HostPlatform(), dir, "./cmd/protoc-gen-foo")
+		Expect(err).To(BeNil())
+		Expect(again).To(Equal(local))
+
+		write("internal/internal.go", "package internal\n\nconst Name = \"foo\"\n")
+		rebuilt, err := pluginmanager.InstallPluginFromDir(ctx, log, storageDir, pluginmanager.HostPlatform(), dir, "./cmd/protoc-gen-foo")
+		Expect(err).To(BeNil())
+		Expect(rebuilt).NotTo(Equal(local))
+		exists, err := util.IsFileExists(rebuilt)
+		Expect(err).To(BeNil())
+		Expect(exists).To(BeTrue())
+
+		// the plugin is cross-compiled into the storage dir of other platform
+		platform, err := pluginmanager.ParsePlatform("windows/amd64")
+		Expect(err).To(BeNil())
+		platformDir := pluginmanager.PathForPlatform(storageDir, platform)
+		cross, err := pluginmanager.InstallPluginFromDir(ctx, log, platformDir, platform, dir, "./cmd/protoc-gen-foo")
+		Expect(err).To(BeNil())
+		Expect(filepath.Base(cross)).To(Equal("protoc-gen-foo.exe"))
+		data, err := ioutil.ReadFile(cross)
+		Expect(err).To(BeNil())
+		Expect(string(data[:2])).To(Equal("MZ"))
+	})
+})
@@ -16,12 +16,16 @@ package pluginmanager
 
 import (
 	"context"
-	"errors"
 	"io/fs"
 	"os"
+	"path/filepath"
 	"strings"
 	"sync"
 
+	"github.com/hashicorp/go-multierror"
+	"github.com/pkg/errors"
+
+	"github.com/storyicon/powerproto/pkg/configs"
 	"github.com/storyicon/powerproto/pkg/consts"
 	"github.com/storyicon/powerproto/pkg/util"
 	"github.com/storyicon/powerproto/pkg/util/logger"
@@ -29,8 +33,12 @@ import (
 
 // PluginManager is used to manage plugins
 type PluginManager interface {
-	// GetPluginLatestVersion is used to get the latest version of plugin
-	GetPluginLatestVersion(ctx context.Context, path string) (string, error)
+	// GetPluginLatestVersion is used to get the latest version of plugin,
+	// the prereleases are included only if prerelease is true, and the retracted versions are skipped
+	GetPluginLatestVersion(ctx context.Context, path string, prerelease bool) (string, error)
+	// GetPluginRetraction is used to get the retraction rationales of the plugin at the version,
+	// nil is returned if it is not retracted
+	GetPluginRetraction(ctx context.Context, path string, version string) ([]string, error)
 	// ListPluginVersions is used to list the versions of plugin
 	ListPluginVersions(ctx context.Context, path string) ([]string, error)
 	// IsPluginInstalled is used to check whether the plugin is installed
@@ -39,66 +47,175 @@ type PluginManager interface {
 	InstallPlugin(ctx context.Context, path string, version string) (local string, err error)
 	// GetPathForPlugin is used to get path for plugin executable file
 	GetPathForPlugin(ctx context.Context, path string, version string) (local string, err error)
-
-	// GetGitRepoLatestVersion is used to get the latest version of google apis
-	GetGitRepoLatestVersion(ctx context.Context, uri string) (string, error)
-	// InstallGitRepo is used to install google apis
-	InstallGitRepo(ctx context.Context, uri string, commitId string) (local string, err error)
+	// InstallPluginRelease is used to install the prebuilt plugin from the release asset
+	InstallPluginRelease(ctx context.Context, path string, version string, asset *PluginAsset) (local string, err error)
+	// InstallLocalPlugin is used to build the plugin package in the local go module dir,
+	// it is rebuilt once the sources are changed
+	InstallLocalPlugin(ctx context.Context, dir string, pkg string) (local string, err error)
+
+	// GetGitRepoLatestVersion is used to get the latest commit of the ref of git repo,
+	// the ref can be latest, branch:<name> or tag:<name>
+	GetGitRepoLatestVersion(ctx context.Context, uri string, ref string) (string, error)
+	// ListGitRepoTags is used to list the tags of git repo
+	ListGitRepoTags(ctx context.Context, uri string) ([]string, error)
+	// InstallGitRepo is used to install google apis,
+	// only the files matching the include patterns are kept if they are specified
+	InstallGitRepo(ctx context.Context, uri string, commitId string, include []string) (local string, err error)
 	// IsGitRepoInstalled is used to check whether the protoc is installed
-	IsGitRepoInstalled(ctx context.Context, uri string, commitId string) (bool, string, error)
+	IsGitRepoInstalled(ctx context.Context, uri string, commitId string, include []string) (bool, string, error)
 	// GitRepoPath returns the git repo path
-	GitRepoPath(ctx context.Context, commitId string) (string, error)
-
-	// GetProtocLatestVersion is used to get the latest version of protoc
-	GetProtocLatestVersion(ctx context.Context) (string, error)
+	GitRepoPath(ctx context.Context, uri string, commitId string, include []string) (string, error)
+	// ListInstalledGitRepos is used to list the installed git repos
+	ListInstalledGitRepos(ctx context.Context) ([]*CacheEntry, error)
+
+	// InstallArchiveRepo is used to install the archive repo after its sha256 checksum is verified,
+	// only the files matching the include patterns are kept if they are specified
+	InstallArchiveRepo(ctx context.Context, uri string, checksum string, include []string) (local string, err error)
+	// IsArchiveRepoInstalled is used to check whether the archive repo is installed
+	IsArchiveRepoInstalled(ctx context.Context, uri string, checksum string, include []string) (bool, string, error)
+	// ArchiveRepoPath returns the local directory of archive repo
+	ArchiveRepoPath(ctx context.Context, uri string, checksum string, include []string) (string, error)
+	// GetGoModule is used to download the go module into the local module cache and get its directory
+	GetGoModule(ctx context.Context, path string, version string) (*GoModule, error)
+
+	// GetProtocLatestVersion is used to get the latest version of protoc,
+	// the release candidates are included only if prerelease is true
+	GetProtocLatestVersion(ctx context.Context, prerelease bool) (string, error)
 	// ListProtocVersions is used to list protoc version
 	ListProtocVersions(ctx context.Context) ([]string, error)
 	// IsProtocInstalled is used to check whether the protoc is installed
 	IsProtocInstalled(ctx context.Context, version string) (bool, string, error)
 	// InstallProtoc is used to install protoc of specified version
 	InstallProtoc(ctx context.Context, version string) (local string, err error)
-	// IncludePath returns the default include path
-	IncludePath(ctx context.Context) (string, error)
+	// IncludePath returns the include path of the specified version protoc
+	IncludePath(ctx context.Context, version string) (string, error)
 	// GetPathForProtoc is used to get the path of protoc
 	GetPathForProtoc(ctx context.Context, version string) (string, error)
+	// GetLocalProtoc is used to find the protoc not installed by PowerProto and verify its version,
+	// the binary is looked up in PATH when it is empty
+	GetLocalProtoc(ctx context.Context, binary string, version string, include string) (*LocalProtoc, error)
+
+	// Platform returns the target platform of the installed protoc and plugins
+	Platform() *Platform
 }
 
+// defines the default url templates to download files
+const (
+	DefaultProtocMirror  = "https://github.com/protocolbuffers/protobuf/releases/download/v$VERSION/$FILENAME"
+	DefaultArchiveMirror = "$ARCHIVE_URL"
+)
+
 // Config defines the config of PluginManager
 type Config struct {
 	StorageDir string `json:"storage"`
+	// ProtocMirrors is the ordered url templates to download protoc releases
+	ProtocMirrors []string `json:"protocMirrors"`
+	// ArchiveMirrors is the ordered url templates to download repository archives
+	ArchiveMirrors []string `json:"archiveMirrors"`
+	// ArchiveHosts is the archive url templates keyed by git host,
+	// $ARCHIVE_URL in ArchiveMirrors is rendered from them
+	ArchiveHosts map[string]string `json:"archiveHosts"`
+	// Platform is the target platform of protoc and plugins in os/arch format,
+	// it is the host platform when empty, see ParsePlatform
+	Platform string `json:"platform"`
+}
+
+// GetStorageDir is used to get the storage dir of the target platform
+func (c *Config) GetStorageDir() (string, error) {
+	platform, err := ParsePlatform(c.Platform)
+	if err != nil {
+		return "", err
+	}
+	return PathForPlatform(c.StorageDir, platform), nil
 }
 
 // NewConfig is used to create config
 func NewConfig() *Config {
 	return &Config{
-		StorageDir: consts.GetHomeDir(),
+		StorageDir:     consts.GetHomeDir(),
+		ProtocMirrors:  []string{DefaultProtocMirror},
+		ArchiveMirrors: []string{DefaultArchiveMirror},
+		ArchiveHosts:   DefaultArchiveHosts,
 	}
 }
 
+// LoadConfig is used to create config with the mirrors in user settings
+func LoadConfig() (*Config, error) {
+	return LoadConfigFrom(consts.PathForSettings())
+}
+
+// LoadConfigFrom is used to create config with the mirrors in user settings of specified path
+func LoadConfigFrom(path string) (*Config, error) {
+	cfg := NewConfig()
+	settings, err := configs.LoadSettingsFrom(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to load user settings")
+	}
+	if mirrors := settings.Mirrors.Protoc; len(mirrors) != 0 {
+		cfg.ProtocMirrors = mirrors
+	}
+	if mirrors := settings.Mirrors.Archive; len(mirrors) != 0 {
+		cfg.ArchiveMirrors = mirrors
+	}
+	if hosts := settings.Mirrors.Hosts; len(hosts) != 0 {
+		cfg.ArchiveHosts = make(map[string]string, len(DefaultArchiveHosts)+len(hosts))
+		for host, template := range DefaultArchiveHosts {
+			cfg.ArchiveHosts[host] = template
+		}
+		for host, template := range hosts {
+			cfg.ArchiveHosts[host] = template
+		}
+	}
+	return cfg, nil
+}
+
 // NewPluginManager is used to create PluginManager
 func NewPluginManager(cfg *Config, log logger.Logger) (PluginManager, error) {
-	return NewBasicPluginManager(cfg.StorageDir, log)
+	return NewBasicPluginManager(cfg, log)
 }
 
 // BasicPluginManager is the basic implement of PluginManager
 type BasicPluginManager struct {
 	logger.Logger
-	storageDir   string
-	versions     map[string][]string
-	versionsLock sync.RWMutex
+	storageDir string
+	platform   *Platform
+	// hostPlatform reports whether the platform is detected from the host instead of specified by config
+	hostPlatform   bool
+	protocMirrors  []string
+	archiveMirrors []string
+	archiveHosts   map[string]string
+	versions       map[string][]string
+	goModules      map[string]*GoModule
+	localPlugins   map[string]string
+	localProtocs   map[string]*LocalProtoc
+	versionsLock   sync.RWMutex
 }
 
 // NewBasicPluginManager is used to create basic PluginManager
-func NewBasicPluginManager(storageDir string, log logger.Logger) (*BasicPluginManager, error) {
+func NewBasicPluginManager(cfg *Config, log logger.Logger) (*BasicPluginManager, error) {
+	platform, err := ParsePlatform(cfg.Platform)
+	if err != nil {
+		return nil, err
+	}
 	return &BasicPluginManager{
-		Logger:     log.NewLogger("pluginmanager"),
-		storageDir: storageDir,
-		versions:   map[string][]string{},
+		Logger:         log.NewLogger("pluginmanager"),
+		storageDir:     PathForPlatform(cfg.StorageDir, platform),
+		platform:       platform,
+		hostPlatform:   cfg.Platform == "",
+		protocMirrors:  cfg.ProtocMirrors,
+		archiveMirrors: cfg.ArchiveMirrors,
+		archiveHosts:   cfg.ArchiveHosts,
+		versions:       map[string][]string{},
+		goModules:      map[string]*GoModule{},
+		localPlugins:   map[string]string{},
+		localProtocs:   map[string]*LocalProtoc{},
 	}, nil
 }
 
-// GetPluginLatestVersion is used to get the latest version of plugin
-func (b *BasicPluginManager) GetPluginLatestVersion(ctx context.Context, path string) (string, error) {
+// GetPluginLatestVersion is used to get the latest version of plugin,
+// the prereleases are included only if prerelease is true, and the retracted versions are never listed.
+// The module without any release is resolved to its newest prerelease or pseudo-version like go install does
+func (b *BasicPluginManager) GetPluginLatestVersion(ctx context.Context, path string, prerelease bool) (string, error) {
 	ctx, cancel := consts.GetContextWithPerCommandTimeout(ctx)
 	defer cancel()
 
@@ -107,16 +224,38 @@ func (b *BasicPluginManager) GetPluginLatestVersion(ctx context.Context, path st
 		return "", err
 	}
 	if len(versions) == 0 {
+		if consts.IsOffline(ctx) {
+			return "", errors.Errorf("no cached version of %s in offline mode", path)
+		}
 		return "", errors.New("no version list")
 	}
+	if !prerelease {
+		for i := len(versions) - 1; i >= 0; i-- {
+			if util.IsStableVersion(versions[i]) {
+				return versions[i], nil
+			}
+		}
+	}
 	return versions[len(versions)-1], nil
 }
 
+// GetPluginRetraction is used to get the retraction rationales of the plugin at the version,
+// nil is returned if it is not retracted
+func (b *BasicPluginManager) GetPluginRetraction(ctx context.Context, path string, version string) ([]string, error) {
+	ctx, cancel := consts.GetContextWithPerCommandTimeout(ctx)
+	defer cancel()
+	return GetGoPackageRetraction(ctx, b.Logger, path, version)
+}
+
 // ListPluginVersions is used to list the versions of plugin
+// In offline mode, only the installed versions are listed
 func (b *BasicPluginManager) ListPluginVersions(ctx context.Context, path string) ([]string, error) {
 	ctx, cancel := consts.GetContextWithPerCommandTimeout(ctx)
 	defer cancel()
 
+	if consts.IsOffline(ctx) {
+		return ListInstalledPluginVersions(b.storageDir, path)
+	}
 	b.versionsLock.RLock()
 	versions, ok := b.versions[path]
 	b.versionsLock.RUnlock()
@@ -135,7 +274,11 @@ func (b *BasicPluginManager) ListPluginVersions(ctx context.Context, path string
 
 // IsPluginInstalled is used to check whether the plugin is installed
 func (b *BasicPluginManager) IsPluginInstalled(ctx context.Context, path string, version string) (bool, string, error) {
-	return IsPluginInstalled(ctx, b.storageDir, path, version)
+	exists, local, err := IsPluginInstalled(ctx, b.storageDir, path, version)
+	if exists {
+		b.markCacheUsed(filepath.Dir(local))
+	}
+	return exists, local, err
 }
 
 // GetPathForPlugin is used to get path for plugin executable file
@@ -145,55 +288,259 @@ func (b *BasicPluginManager) GetPathForPlugin(ctx context.Context, path string,
 
 // InstallPlugin is used to install plugin
 func (b *BasicPluginManager) InstallPlugin(ctx context.Context, path string, version string) (local string, err error) {
-	return InstallPluginUsingGo(ctx, b.Logger, b.storageDir, path, version)
+	return InstallPluginUsingGo(ctx, b.Logger, b.storageDir, b.platform, path, version)
+}
+
+// InstallPluginRelease is used to install the prebuilt plugin from the release asset
+func (b *BasicPluginManager) InstallPluginRelease(ctx context.Context, path string, version string, asset *PluginAsset) (string, error) {
+	ctx, cancel := consts.GetContextWithPerCommandTimeout(ctx)
+	defer cancel()
+	return InstallPluginFromRelease(ctx, b.storageDir, path, version, asset)
+}
+
+// InstallLocalPlugin is used to build the plugin package in the local go module dir,
+// the sources are checked only once in the process
+func (b *BasicPluginManager) InstallLocalPlugin(ctx context.Context, dir string, pkg string) (string, error) {
+	key := filepath.Join(dir, pkg)
+	b.versionsLock.RLock()
+	local, ok := b.localPlugins[key]
+	b.versionsLock.RUnlock()
+	if ok {
+		return local, nil
+	}
+	local, err := InstallPluginFromDir(ctx, b.Logger, b.storageDir, b.platform, dir, pkg)
+	if err != nil {
+		return "", err
+	}
+	b.versionsLock.Lock()
+	b.localPlugins[key] = local
+	b.versionsLock.Unlock()
+	return local, nil
 }
 
-// GetGitRepoLatestVersion is used to get the latest version of google apis
-func (b *BasicPluginManager) GetGitRepoLatestVersion(ctx context.Context, url string) (string, error) {
-	return GetGitLatestCommitId(ctx, b.Logger, url)
+// GetGitRepoLatestVersion is used to get the latest commit of the ref of git repo,
+// the ref can be latest, branch:<name> or tag:<name>
+// In offline mode, latest is resolved to the most recently installed version,
+// and the other refs can not be resolved
+func (b *BasicPluginManager) GetGitRepoLatestVersion(ctx context.Context, url string, ref string) (string, error) {
+	gitRef, ok := ParseGitRef(ref)
+	if !ok {
+		return "", errors.Errorf("invalid ref %s of %s, should be latest, %s<name> or %s<name>",
+			ref, url, configs.RepositoryRefBranchPrefix, configs.RepositoryRefTagPrefix)
+	}
+	if consts.IsOffline(ctx) {
+		if ref != "latest" {
+			return "", errors.Errorf("%s of %s can not be resolved in offline mode", ref, url)
+		}
+		commitId, err := GetLatestInstalledGitRepo(b.storageDir, url)
+		if err != nil {
+			return "", err
+		}
+		if commitId == "" {
+			return "", errors.Errorf("no cached version of %s in offline mode", url)
+		}
+		return commitId, nil
+	}
+	key := util.JoinGoPackageVersion(url, ref)
+	b.versionsLock.RLock()
+	versions, ok := b.versions[key]
+	b.versionsLock.RUnlock()
+	if ok {
+		return versions[0], nil
+	}
+	commitId, err := GetGitCommitId(ctx, b.Logger, url, gitRef)
+	if err != nil {
+		return "", err
+	}
+	b.versionsLock.Lock()
+	b.versions[key] = []string{commitId}
+	b.versionsLock.Unlock()
+	return commitId, nil
+}
+
+// ListGitRepoTags is used to list the tags of git repo
+// In offline mode, the tags can not be listed
+func (b *BasicPluginManager) ListGitRepoTags(ctx context.Context, uri string) ([]string, error) {
+	ctx, cancel := consts.GetContextWithPerCommandTimeout(ctx)
+	defer cancel()
+
+	key := util.JoinGoPackageVersion(uri, "tags")
+	b.versionsLock.RLock()
+	tags, ok := b.versions[key]
+	b.versionsLock.RUnlock()
+	if ok {
+		return tags, nil
+	}
+	tags, err := ListGitTags(ctx, b.Logger, uri)
+	if err != nil {
+		return nil, err
+	}
+	b.versionsLock.Lock()
+	b.versions[key] = tags
+	b.versionsLock.Unlock()
+	return tags, nil
 }
 
 // InstallGitRepo is used to install google apis
-func (b *BasicPluginManager) InstallGitRepo(ctx context.Context, uri string, commitId string) (string, error) {
+func (b *BasicPluginManager) InstallGitRepo(ctx context.Context, uri string, commitId string, include []string) (string, error) {
 	ctx, cancel := consts.GetContextWithPerCommandTimeout(ctx)
 	defer cancel()
 
-	exists, local, err := b.IsGitRepoInstalled(ctx, uri, commitId)
+	exists, local, err := b.IsGitRepoInstalled(ctx, uri, commitId, include)
 	if err != nil {
 		return "", err
 	}
 	if exists {
 		return local, nil
 	}
-	release, err := GetGithubArchive(ctx, uri, commitId)
+	codePath, err := PathForGitReposCode(b.storageDir, uri, commitId, include)
+	if err != nil {
+		return "", err
+	}
+	err = installAtomically(ctx, b.storageDir, codePath, func(staging string) error {
+		if err := b.downloadGitRepo(ctx, uri, commitId, staging); err != nil {
+			return err
+		}
+		return filterFiles(staging, include)
+	})
 	if err != nil {
 		return "", err
 	}
-	defer release.Clear()
+	return local, nil
+}
+
+// downloadGitRepo is used to download the source code of git repository to dir,
+// the archive is preferred and git fetch is used as the fallback for unknown hosts
+func (b *BasicPluginManager) downloadGitRepo(ctx context.Context, uri string, commitId string, dir string) error {
+	release, archiveErr := DownloadGitArchive(ctx, b.archiveMirrors, b.archiveHosts, uri, commitId)
+	if archiveErr == nil {
+		defer release.Clear()
+		return util.CopyDirectory(release.GetLocalDir(), dir)
+	}
+	if consts.IsOffline(ctx) {
+		return archiveErr
+	}
+	b.LogDebug(map[string]interface{}{
+		"uri":    uri,
+		"commit": commitId,
+	}, "failed to download archive, fallback to git fetch: %s", archiveErr)
+	checkout, err := FetchGitCommit(ctx, b.Logger, uri, commitId)
+	if err != nil {
+		return multierror.Append(archiveErr, err)
+	}
+	defer checkout.Clear()
+	return util.CopyDirectory(checkout.GetLocalDir(), dir)
+}
 
-	codePath, err := PathForGitReposCode(b.storageDir, uri, commitId)
+// IsGitRepoInstalled is used to check whether the protoc is installed
+func (b *BasicPluginManager) IsGitRepoInstalled(ctx context.Context, uri string, commitId string, include []string) (bool, string, error) {
+	local, err := PathForGitRepos(b.storageDir, uri, commitId, include)
+	if err != nil {
+		return false, "", err
+	}
+	codePath, err := PathForGitReposCode(b.storageDir, uri, commitId, include)
+	if err != nil {
+		return false, "", err
+	}
+	// the repo installed before the completion marker is introduced is adopted
+	exists, err := adoptLegacyInstall(ctx, b.storageDir, codePath, func() (bool, error) {
+		return isDirNotEmpty(codePath)
+	})
+	if exists {
+		b.markCacheUsed(local)
+	}
+	return exists, local, err
+}
+
+// GitRepoPath returns the local directory of git repo, which contains
+// the source code in the sub directory named by the repo, e.g. github.com/googleapis/googleapis
+func (b *BasicPluginManager) GitRepoPath(ctx context.Context, uri string, commitId string, include []string) (string, error) {
+	return PathForGitRepos(b.storageDir, uri, commitId, include)
+}
+
+// ListInstalledGitRepos is used to list the installed git repos
+func (b *BasicPluginManager) ListInstalledGitRepos(ctx context.Context) ([]*CacheEntry, error) {
+	entries, err := listInstalledGitRepos(b.storageDir)
+	if err != nil {
+		return nil, err
+	}
+	installed := make([]*CacheEntry, 0, len(entries))
+	for _, entry := range entries {
+		if !entry.Incomplete {
+			installed = append(installed, entry)
+		}
+	}
+	return installed, nil
+}
+
+// InstallArchiveRepo is used to install the archive repo after its sha256 checksum is verified
+func (b *BasicPluginManager) InstallArchiveRepo(ctx context.Context, uri string, checksum string, include []string) (string, error) {
+	ctx, cancel := consts.GetContextWithPerCommandTimeout(ctx)
+	defer cancel()
+
+	exists, local, err := b.IsArchiveRepoInstalled(ctx, uri, checksum, include)
 	if err != nil {
 		return "", err
 	}
-	if err := util.CopyDirectory(release.GetLocalDir(), codePath); err != nil {
+	if exists {
+		return local, nil
+	}
+	err = installAtomically(ctx, b.storageDir, local, func(staging string) error {
+		archive, err := GetArchiveRepo(ctx, uri, checksum)
+		if err != nil {
+			return err
+		}
+		defer archive.Clear()
+		if err := util.CopyDirectory(archive.GetLocalDir(), staging); err != nil {
+			return err
+		}
+		return filterFiles(staging, include)
+	})
+	if err != nil {
 		return "", err
 	}
 	return local, nil
 }
 
-// IsGitRepoInstalled is used to check whether the protoc is installed
-func (b *BasicPluginManager) IsGitRepoInstalled(ctx context.Context, uri string, commitId string) (bool, string, error) {
-	codePath, err := PathForGitReposCode(b.storageDir, uri, commitId)
+// IsArchiveRepoInstalled is used to check whether the archive repo is installed
+func (b *BasicPluginManager) IsArchiveRepoInstalled(ctx context.Context, uri string, checksum string, include []string) (bool, string, error) {
+	local, err := PathForArchiveRepos(b.storageDir, uri, checksum, include)
 	if err != nil {
 		return false, "", err
 	}
-	exists, err := util.IsDirExists(codePath)
-	return exists, PathForGitRepos(b.storageDir, commitId), err
+	exists, err := isInstallCompleted(local)
+	if exists {
+		b.markCacheUsed(local)
+	}
+	return exists, local, err
 }
 
-// GitRepoPath returns the googleapis path
-func (b *BasicPluginManager) GitRepoPath(ctx context.Context, commitId string) (string, error) {
-	return PathForGitRepos(b.storageDir, commitId), nil
+// ArchiveRepoPath returns the local directory of archive repo
+func (b *BasicPluginManager) ArchiveRepoPath(ctx context.Context, uri string, checksum string, include []string) (string, error) {
+	return PathForArchiveRepos(b.storageDir, uri, checksum, include)
+}
+
+// GetGoModule is used to download the go module into the local module cache and get its directory,
+// the result is cached so that latest is resolved only once
+func (b *BasicPluginManager) GetGoModule(ctx context.Context, path string, version string) (*GoModule, error) {
+	ctx, cancel := consts.GetContextWithPerCommandTimeout(ctx)
+	defer cancel()
+
+	key := util.JoinGoPackageVersion(path, version)
+	b.versionsLock.RLock()
+	module, ok := b.goModules[key]
+	b.versionsLock.RUnlock()
+	if ok {
+		return module, nil
+	}
+	module, err := DownloadGoModule(ctx, b.Logger, path, version)
+	if err != nil {
+		return nil, err
+	}
+	b.versionsLock.Lock()
+	b.goModules[key] = module
+	b.versionsLock.Unlock()
+	return module, nil
 }
 
 // IsProtocInstalled is used to check whether the protoc is installed
@@ -201,11 +548,26 @@ func (b *BasicPluginManager) IsProtocInstalled(ctx context.Context, version stri
 	if strings.HasPrefix(version, "v") {
 		version = strings.TrimPrefix(version, "v")
 	}
-	return IsProtocInstalled(ctx, b.storageDir, version)
+	exists, local, err := IsProtocInstalled(ctx, b.storageDir, version)
+	if exists {
+		b.markCacheUsed(filepath.Dir(local))
+	}
+	return exists, local, err
+}
+
+// markCacheUsed is used to record the last used time of cache entry,
+// the failure is ignored since the storage dir may be read-only
+func (b *BasicPluginManager) markCacheUsed(dir string) {
+	if err := MarkCacheUsed(dir); err != nil {
+		b.LogDebug(map[string]interface{}{
+			"dir": dir,
+		}, "failed to mark cache as used: %s", err)
+	}
 }
 
-// GetProtocLatestVersion is used to get the latest version of protoc
-func (b *BasicPluginManager) GetProtocLatestVersion(ctx context.Context) (string, error) {
+// GetProtocLatestVersion is used to get the latest version of protoc,
+// the release candidates are included only if prerelease is true
+func (b *BasicPluginManager) GetProtocLatestVersion(ctx context.Context, prerelease bool) (string, error) {
 	ctx, cancel := consts.GetContextWithPerCommandTimeout(ctx)
 	defer cancel()
 
@@ -213,23 +575,30 @@ func (b *BasicPluginManager) GetProtocLatestVersion(ctx context.Context) (string
 	if err != nil {
 		return "", err
 	}
-	if len(versions) == 0 {
-		return "", errors.New("no version list")
-	}
-	regularVersions := make([]string, 0, len(versions))
+	releases := make([]string, 0, len(versions))
 	for _, version := range versions {
-		if util.IsRegularVersion(version) {
-			regularVersions = append(regularVersions, version)
+		if IsProtocReleaseVersion(version, prerelease) {
+			releases = append(releases, version)
 		}
 	}
-	return regularVersions[len(regularVersions)-1], nil
+	if len(releases) == 0 {
+		if consts.IsOffline(ctx) {
+			return "", errors.New("no cached version of protoc in offline mode")
+		}
+		return "", errors.New("no version list")
+	}
+	return releases[len(releases)-1], nil
 }
 
 // ListProtocVersions is used to list protoc version
+// In offline mode, only the installed versions are listed
 func (b *BasicPluginManager) ListProtocVersions(ctx context.Context) ([]string, error) {
 	ctx, cancel := consts.GetContextWithPerCommandTimeout(ctx)
 	defer cancel()
 
+	if consts.IsOffline(ctx) {
+		return ListInstalledProtocVersions(b.storageDir)
+	}
 	b.versionsLock.RLock()
 	versions, ok := b.versions["protoc"]
 	b.versionsLock.RUnlock()
@@ -251,42 +620,111 @@ func (b *BasicPluginManager) GetPathForProtoc(ctx context.Context, version strin
 	return PathForProtoc(b.storageDir, version), nil
 }
 
+// GetLocalProtoc is used to find the protoc not installed by PowerProto and verify its version,
+// the result is cached so that protoc is executed only once
+func (b *BasicPluginManager) GetLocalProtoc(ctx context.Context, binary string, version string, include string) (*LocalProtoc, error) {
+	key := strings.Join([]string{binary, version, include}, "\x00")
+	b.versionsLock.RLock()
+	protoc, ok := b.localProtocs[key]
+	b.versionsLock.RUnlock()
+	if ok {
+		return protoc, nil
+	}
+	protoc, err := FindLocalProtoc(ctx, b.Logger, binary, version, include)
+	if err != nil {
+		return nil, err
+	}
+	b.versionsLock.Lock()
+	b.localProtocs[key] = protoc
+	b.versionsLock.Unlock()
+	return protoc, nil
+}
+
 // InstallProtoc is used to install protoc of specified version
 func (b *BasicPluginManager) InstallProtoc(ctx context.Context, version string) (string, error) {
 	ctx, cancel := consts.GetContextWithPerCommandTimeout(ctx)
 	defer cancel()
 
-	local := PathForProtoc(b.storageDir, version)
-	exists, err := util.IsFileExists(local)
+	exists, local, err := IsProtocInstalled(ctx, b.storageDir, version)
 	if err != nil {
 		return "", err
 	}
 	if exists {
+		b.migrateProtocInclude(ctx, version)
 		return local, nil
 	}
-
-	release, err := GetProtocRelease(ctx, version)
+	err = installAtomically(ctx, b.storageDir, PathForProtocDir(b.storageDir, version), func(staging string) error {
+		release, err := GetProtocRelease(ctx, b.protocMirrors, version, b.getProtocReleasePlatform())
+		if err != nil {
+			return err
+		}
+		defer release.Clear()
+		if err := util.CopyDirectory(release.GetIncludePath(), filepath.Join(staging, "include")); err != nil {
+			return err
+		}
+		binary := filepath.Join(staging, filepath.Base(local))
+		if err := util.CopyFile(release.GetProtocPath(), binary); err != nil {
+			return err
+		}
+		// * it is required on unix system
+		if err := os.Chmod(binary, fs.ModePerm); err != nil {
+			return err
+		}
+		return RecordChecksum(binary)
+	})
 	if err != nil {
 		return "", err
 	}
-	defer release.Clear()
-	// merge include files
-	includeDir := PathForInclude(b.storageDir)
-	if err := util.CopyDirectory(release.GetIncludePath(), includeDir); err != nil {
-		return "", err
+	return local, nil
+}
+
+// getProtocReleasePlatform is used to get the platform of protoc release to download. protoc is not released for musl,
+// so the release for glibc is used when musl is detected from the host rather than specified by config,
+// which works on the hosts with the compatibility layer of glibc
+func (b *BasicPluginManager) getProtocReleasePlatform() *Platform {
+	if !b.hostPlatform || b.platform.Libc != LibcMusl {
+		return b.platform
 	}
-	// download protoc file
-	if err := util.CopyFile(release.GetProtocPath(), local); err != nil {
-		return "", err
+	b.LogWarn(map[string]interface{}{
+		"platform": b.platform.String(),
+	}, "protoc did not release on musl, the release for glibc is used instead. "+
+		"If it does not work, please use the protoc of the distribution by 'protoc: system', e.g. apk add protobuf")
+	return &Platform{
+		OS:   b.platform.OS,
+		Arch: b.platform.Arch,
 	}
-	// * it is required on unix system
-	if err := os.Chmod(local, fs.ModePerm); err != nil {
-		return "", err
+}
+
+// migrateProtocInclude is used to install the include files of the protoc installed by the legacy
+// versions of PowerProto, which merged them into the shared include dir. It is skipped in offline mode,
+// and the failure is ignored since the shared include dir is used instead
+func (b *BasicPluginManager) migrateProtocInclude(ctx context.Context, version string) {
+	include := PathForProtocInclude(b.storageDir, version)
+	exists, err := util.IsDirExists(include)
+	if err != nil || exists || consts.IsOffline(ctx) {
+		return
 	}
-	return local, nil
+	err = installAtomically(ctx, b.storageDir, include, func(staging string) error {
+		release, err := GetProtocRelease(ctx, b.protocMirrors, version, b.getProtocReleasePlatform())
+		if err != nil {
+			return err
+		}
+		defer release.Clear()
+		return util.CopyDirectory(release.GetIncludePath(), staging)
+	})
+	if err != nil {
+		b.LogWarn(map[string]interface{}{
+			"version": version,
+		}, "failed to migrate include files of protoc, the shared include dir is used: %s", err)
+	}
+}
+
+// Platform returns the target platform of the installed protoc and plugins
+func (b *BasicPluginManager) Platform() *Platform {
+	return b.platform
 }
 
-// IncludePath returns the default include path
-func (b *BasicPluginManager) IncludePath(ctx context.Context) (string, error) {
-	return PathForInclude(b.storageDir), nil
+// IncludePath returns the include path of the specified version protoc
+func (b *BasicPluginManager) IncludePath(ctx context.Context, version string) (string, error) {
+	return GetProtocIncludePath(b.storageDir, version)
 }
@@ -0,0 +1,138 @@
+// Copyright 2021 storyicon@foxmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pluginmanager_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/storyicon/powerproto/pkg/component/pluginmanager"
+	"github.com/storyicon/powerproto/pkg/consts"
+	"github.com/storyicon/powerproto/pkg/util"
+)
+
+func newZip(files ...string) []byte {
+	buf := &bytes.Buffer{}
+	writer := zip.NewWriter(buf)
+	for _, file := range files {
+		w, err := writer.Create(file)
+		Expect(err).To(BeNil())
+		_, err = w.Write([]byte(file))
+		Expect(err).To(BeNil())
+	}
+	Expect(writer.Close()).To(BeNil())
+	return buf.Bytes()
+}
+
+var _ = Describe("Mirror", func() {
+	const commitId = "0123456789abcdef"
+	var requested []string
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		requested = append(requested, r.URL.Path)
+		http.NotFound(w, r)
+	})
+	mux.HandleFunc("/mirror/github.com/gogo/protobuf/archive/"+commitId+".zip", func(w http.ResponseWriter, r *http.Request) {
+		requested = append(requested, r.URL.Path)
+		w.Write(newZip("protobuf-" + commitId + "/gogoproto/gogo.proto"))
+	})
+	mux.HandleFunc("/protobuf/v3.17.3/", func(w http.ResponseWriter, r *http.Request) {
+		requested = append(requested, r.URL.Path)
+		w.Write(newZip(
+			filepath.ToSlash(filepath.Join("bin", util.GetBinaryFileName("protoc"))),
+			"include/google/protobuf/empty.proto",
+		))
+	})
+	var server *httptest.Server
+	BeforeEach(func() {
+		requested = nil
+		server = httptest.NewServer(mux)
+	})
+	AfterEach(func() {
+		server.Close()
+	})
+
+	It("should able to download archive from mirrors in order", func() {
+		archive, err := pluginmanager.DownloadGitArchive(context.TODO(), []string{
+			server.URL + "/broken/$COMMIT.zip",
+			server.URL + "/mirror/$HOST/$REPO_PATH/archive/$FILENAME",
+		}, nil, "https://github.com/gogo/protobuf", commitId)
+		Expect(err).To(BeNil())
+		defer archive.Clear()
+		Expect(requested).To(Equal([]string{
+			"/broken/" + commitId + ".zip",
+			"/mirror/github.com/gogo/protobuf/archive/" + commitId + ".zip",
+		}))
+		exists, err := util.IsFileExists(filepath.Join(archive.GetLocalDir(), "gogoproto", "gogo.proto"))
+		Expect(err).To(BeNil())
+		Expect(exists).To(BeTrue())
+	})
+	It("should able to download protoc from mirrors", func() {
+		release, err := pluginmanager.GetProtocRelease(context.TODO(), []string{
+			server.URL + "/protobuf/v$VERSION/$FILENAME",
+		}, "v3.17.3", pluginmanager.HostPlatform())
+		Expect(err).To(BeNil())
+		defer release.Clear()
+		exists, err := util.IsFileExists(release.GetProtocPath())
+		Expect(err).To(BeNil())
+		Expect(exists).To(BeTrue())
+	})
+	It("should fail when all mirrors fail", func() {
+		_, err := pluginmanager.DownloadGitArchive(context.TODO(), []string{
+			server.URL + "/broken/1/$FILENAME",
+			server.URL + "/broken/2/$FILENAME",
+		}, nil, "https://github.com/gogo/protobuf", commitId)
+		Expect(err).To(Not(BeNil()))
+		Expect(requested).To(HaveLen(2))
+	})
+	It("should able to override mirrors by env", func() {
+		dir, err := ioutil.TempDir("", "powerproto-settings")
+		Expect(err).To(BeNil())
+		defer os.RemoveAll(dir)
+		settingsPath := filepath.Join(dir, consts.SettingsFileName)
+		Expect(ioutil.WriteFile(settingsPath, []byte(`
+mirrors:
+  protoc:
+    - https://protoc.example.com/$FILENAME
+  archive:
+    - https://archive.example.com/$FILENAME
+`), 0644)).To(BeNil())
+
+		if val, ok := os.LookupEnv(consts.EnvProtocMirrors); ok {
+			os.Unsetenv(consts.EnvProtocMirrors)
+			defer os.Setenv(consts.EnvProtocMirrors, val)
+		}
+		os.Setenv(consts.EnvArchiveMirrors, "https://a.example.com/$FILENAME, https://b.example.com/$FILENAME")
+		defer os.Unsetenv(consts.EnvArchiveMirrors)
+		cfg, err := pluginmanager.LoadConfigFrom(settingsPath)
+		Expect(err).To(BeNil())
+		Expect(cfg.ProtocMirrors).To(Equal([]string{
+			"https://protoc.example.com/$FILENAME",
+		}))
+		Expect(cfg.ArchiveMirrors).To(Equal([]string{
+			"https://a.example.com/$FILENAME",
+			"https://b.example.com/$FILENAME",
+		}))
+	})
+})
@@ -0,0 +1,116 @@
+// Copyright 2021 storyicon@foxmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pluginmanager_test
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/storyicon/powerproto/pkg/component/pluginmanager"
+	"github.com/storyicon/powerproto/pkg/consts"
+	"github.com/storyicon/powerproto/pkg/util/logger"
+)
+
+func touchFile(path string) {
+	Expect(os.MkdirAll(filepath.Dir(path), 0755)).To(BeNil())
+	Expect(ioutil.WriteFile(path, nil, 0755)).To(BeNil())
+}
+
+// touchInstalled creates the file and marks the installation in its directory as completed
+func touchInstalled(path string) {
+	touchFile(path)
+	touchFile(pluginmanager.PathForCompletionMarker(filepath.Dir(path)))
+}
+
+var _ = Describe("Offline", func() {
+	const pluginPath = "google.golang.org/protobuf/cmd/protoc-gen-go"
+	const repo = "https://github.com/googleapis/googleapis"
+	var storageDir string
+	var manager *pluginmanager.BasicPluginManager
+	ctx := consts.WithOffline(context.TODO())
+	BeforeEach(func() {
+		var err error
+		storageDir, err = ioutil.TempDir("", "powerproto-offline")
+		Expect(err).To(BeNil())
+		cfg := pluginmanager.NewConfig()
+		cfg.StorageDir = storageDir
+		manager, err = pluginmanager.NewBasicPluginManager(cfg, logger.NewDefault("offline"))
+		Expect(err).To(BeNil())
+	})
+	AfterEach(func() {
+		os.RemoveAll(storageDir)
+	})
+
+	It("should resolve latest versions from the local cache", func() {
+		for _, version := range []string{"3.9.0", "3.17.3", "3.11.4"} {
+			touchInstalled(pluginmanager.PathForProtoc(storageDir, version))
+		}
+		for _, version := range []string{"v1.25.0", "v1.27.1", "v1.28.0-rc.1"} {
+			local, err := pluginmanager.PathForPlugin(storageDir, pluginPath, version)
+			Expect(err).To(BeNil())
+			touchInstalled(local)
+		}
+		// a directory without executable file is not treated as installed
+		dir, err := pluginmanager.PathForPluginDir(storageDir, pluginPath, "v1.28.0")
+		Expect(err).To(BeNil())
+		Expect(os.MkdirAll(dir, 0755)).To(BeNil())
+
+		codePath, err := pluginmanager.PathForGitReposCode(storageDir, repo, "75e9812478607db997376ccea247dd6928f70f45", nil)
+		Expect(err).To(BeNil())
+		touchFile(pluginmanager.PathForCompletionMarker(codePath))
+
+		version, err := manager.GetProtocLatestVersion(ctx, false)
+		Expect(err).To(BeNil())
+		Expect(version).To(Equal("v3.17.3"))
+
+		version, err = manager.GetPluginLatestVersion(ctx, pluginPath, false)
+		Expect(err).To(BeNil())
+		Expect(version).To(Equal("v1.27.1"))
+
+		version, err = manager.GetPluginLatestVersion(ctx, pluginPath, true)
+		Expect(err).To(BeNil())
+		Expect(version).To(Equal("v1.28.0-rc.1"))
+
+		version, err = manager.GetGitRepoLatestVersion(ctx, repo, "latest")
+		Expect(err).To(BeNil())
+		Expect(version).To(Equal("75e9812478607db997376ccea247dd6928f70f45"))
+	})
+	It("should fail if nothing is cached", func() {
+		_, err := manager.GetProtocLatestVersion(ctx, false)
+		Expect(err).NotTo(BeNil())
+		_, err = manager.GetPluginLatestVersion(ctx, pluginPath, false)
+		Expect(err).NotTo(BeNil())
+		_, err = manager.GetGitRepoLatestVersion(ctx, repo, "latest")
+		Expect(err).NotTo(BeNil())
+	})
+	It("should refuse to access the network", func() {
+		_, err := manager.InstallProtoc(ctx, "v3.17.3")
+		Expect(err).NotTo(BeNil())
+		var errOffline *pluginmanager.ErrOffline
+		_, err = manager.InstallPlugin(ctx, pluginPath, "v1.25.0")
+		Expect(err).To(BeAssignableToTypeOf(errOffline))
+		_, err = manager.InstallGitRepo(ctx, repo, "75e9812478607db997376ccea247dd6928f70f45", nil)
+		Expect(err).NotTo(BeNil())
+		_, err = pluginmanager.ListGitTags(ctx, logger.NewDefault("offline"), repo)
+		Expect(err).To(BeAssignableToTypeOf(errOffline))
+		_, err = manager.GetPluginRetraction(ctx, pluginPath, "v1.25.0")
+		Expect(err).To(BeAssignableToTypeOf(errOffline))
+	})
+})
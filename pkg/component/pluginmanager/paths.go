@@ -15,27 +15,39 @@
 package pluginmanager
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"net/url"
 	"path"
 	"path/filepath"
+	"sort"
 	"strings"
 
 	"golang.org/x/mod/module"
-
-	"github.com/storyicon/powerproto/pkg/util"
 )
 
-// PathForInclude is used to get the local directory of include files
+// PathForInclude is used to get the legacy shared directory of include files,
+// which was merged from all installed protoc releases before include files are stored per version
 func PathForInclude(storageDir string) string {
 	return filepath.Join(storageDir, "include")
 }
 
-// PathForProtoc is used to get the local binary location where the specified version protoc should be stored
-func PathForProtoc(storageDir string, version string) string {
+// PathForProtocInclude is used to get the local directory of include files of the specified version protoc
+func PathForProtocInclude(storageDir string, version string) string {
+	return filepath.Join(PathForProtocDir(storageDir, version), "include")
+}
+
+// PathForProtocDir is used to get the local directory where the specified version protoc should be stored
+func PathForProtocDir(storageDir string, version string) string {
 	if strings.HasPrefix(version, "v") {
 		version = strings.TrimPrefix(version, "v")
 	}
-	return filepath.Join(storageDir, "protoc", version, util.GetBinaryFileName("protoc"))
+	return filepath.Join(storageDir, "protoc", version)
+}
+
+// PathForProtoc is used to get the local binary location where the specified version protoc should be stored
+func PathForProtoc(storageDir string, version string) string {
+	return filepath.Join(PathForProtocDir(storageDir, version), binaryFileName(storageDir, "protoc"))
 }
 
 // GetPluginPath is used to get the plugin path
@@ -51,19 +63,77 @@ func GetPluginPath(path string, version string) (string, error) {
 	return filepath.Join(enc + "@" + encVer), nil
 }
 
-// PathForGitReposCode returns the code path for git repos
-func PathForGitReposCode(storageDir string, uri string, commitId string) (string, error) {
+// GetGitRepoName is used to get the name of git repo from its uri,
+// which is the host and path of uri, e.g. github.com/googleapis/googleapis
+func GetGitRepoName(uri string) (string, error) {
 	parsed, err := url.Parse(uri)
 	if err != nil {
 		return "", err
 	}
-	dir := parsed.Host + parsed.Path
-	return filepath.Join(PathForGitRepos(storageDir, commitId), dir), nil
+	return strings.Trim(path.Join(parsed.Host, parsed.Path), "/"), nil
+}
+
+// PathForGitReposCode returns the code path for git repos
+func PathForGitReposCode(storageDir string, uri string, commitId string, include []string) (string, error) {
+	dir, err := PathForGitRepos(storageDir, uri, commitId, include)
+	if err != nil {
+		return "", err
+	}
+	name, err := GetGitRepoName(uri)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, filepath.FromSlash(name)), nil
+}
+
+// PathForGitRepos is used to get the local directory of git repo of specified commit,
+// it is namespaced by the name of repo, e.g. gits/github.com/googleapis/googleapis@<commit>.
+// The repo filtered by include patterns is stored separately with the hash of patterns as suffix
+func PathForGitRepos(storageDir string, uri string, commitId string, include []string) (string, error) {
+	name, err := GetGitRepoName(uri)
+	if err != nil {
+		return "", err
+	}
+	dir := name + "@" + commitId + GetIncludeSuffix(include)
+	return filepath.Join(PathForGitReposRoot(storageDir), filepath.FromSlash(dir)), nil
+}
+
+// GetIncludeSuffix is used to get the suffix of directory for the repo filtered by include patterns,
+// it is empty if there is no include pattern
+func GetIncludeSuffix(include []string) string {
+	if len(include) == 0 {
+		return ""
+	}
+	patterns := append([]string{}, include...)
+	sort.Strings(patterns)
+	sum := sha256.Sum256([]byte(strings.Join(patterns, "\n")))
+	return "+" + hex.EncodeToString(sum[:4])
+}
+
+// PathForGitReposRoot is used to get the local directory where all git repos are stored
+func PathForGitReposRoot(storageDir string) string {
+	return filepath.Join(storageDir, "gits")
+}
+
+// PathForArchiveRepos is used to get the local directory of archive repo with the sha256 checksum,
+// e.g. archives/example.com/releases/protos.tar.gz@<checksum>, the files are extracted into it directly
+func PathForArchiveRepos(storageDir string, uri string, checksum string, include []string) (string, error) {
+	name, err := GetGitRepoName(uri)
+	if err != nil {
+		return "", err
+	}
+	dir := name + "@" + checksum + GetIncludeSuffix(include)
+	return filepath.Join(PathForArchiveReposRoot(storageDir), filepath.FromSlash(dir)), nil
 }
 
-// PathForGitRepos is used to get the git repo local path
-func PathForGitRepos(storageDir string, commitId string) string {
-	return filepath.Join(storageDir, "gits", commitId)
+// PathForArchiveReposRoot is used to get the local directory where all archive repos are stored
+func PathForArchiveReposRoot(storageDir string) string {
+	return filepath.Join(storageDir, "archives")
+}
+
+// PathForPlugins is used to get the local directory where all plugins are stored
+func PathForPlugins(storageDir string) string {
+	return filepath.Join(storageDir, "plugins")
 }
 
 // PathForPluginDir is used to get the local directory where the specified version plug-in should be stored
@@ -72,7 +142,13 @@ func PathForPluginDir(storageDir string, path string, version string) (string, e
 	if err != nil {
 		return "", err
 	}
-	return filepath.Join(storageDir, "plugins", pluginPath), nil
+	return filepath.Join(PathForPlugins(storageDir), pluginPath), nil
+}
+
+// PathForLocalPlugin is used to get the binary path of plugin built from local sources,
+// e.g. plugins/local/protoc-gen-go-grpc@<hash>/protoc-gen-go-grpc
+func PathForLocalPlugin(storageDir string, name string, hash string) string {
+	return filepath.Join(PathForPlugins(storageDir), "local", name+"@"+hash, binaryFileName(storageDir, name))
 }
 
 // PathForPlugin is used to get the binary path of plugin
@@ -83,7 +159,29 @@ func PathForPlugin(storageDir string, path string, version string) (string, erro
 	if err != nil {
 		return "", err
 	}
-	return filepath.Join(dir, util.GetBinaryFileName(name)), nil
+	return filepath.Join(dir, binaryFileName(storageDir, name)), nil
+}
+
+// PathForChecksum is used to get the path of the file recording the sha256 checksum of binary
+func PathForChecksum(binary string) string {
+	return binary + ".sha256"
+}
+
+// PathForCompletionMarker is used to get the path of the file marking that the installation in dir is completed
+func PathForCompletionMarker(dir string) string {
+	return filepath.Join(dir, ".powerproto-complete")
+}
+
+// PathForTemp is used to get the local directory where the installations are staged,
+// it is in the storage dir so that the staged files can be renamed into place
+func PathForTemp(storageDir string) string {
+	return filepath.Join(storageDir, "tmp")
+}
+
+// PathForLock is used to get the lock file of the artifact in dir
+func PathForLock(storageDir string, dir string) string {
+	sum := sha256.Sum256([]byte(filepath.Clean(dir)))
+	return filepath.Join(storageDir, "locks", hex.EncodeToString(sum[:8])+".lock")
 }
 
 // isVersionElement reports whether s is a well-formed path version element:
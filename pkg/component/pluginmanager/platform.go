@@ -0,0 +1,143 @@
+// Copyright 2021 storyicon@foxmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pluginmanager
+
+import (
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/storyicon/powerproto/pkg/util"
+)
+
+// LibcMusl is the libc of the linux distributions like alpine
+const LibcMusl = "musl"
+
+// Platform defines the target platform of protoc and plugins
+type Platform struct {
+	OS   string
+	Arch string
+	// Libc is empty for the default libc of os, or LibcMusl
+	Libc string
+}
+
+var hostPlatform = &Platform{
+	OS:   runtime.GOOS,
+	Arch: runtime.GOARCH,
+	Libc: inferHostLibc(),
+}
+
+// inferHostLibc is used to detect the musl libc by its dynamic linker
+func inferHostLibc() string {
+	if runtime.GOOS != "linux" {
+		return ""
+	}
+	matches, _ := filepath.Glob("/lib/ld-musl-*.so.1")
+	if len(matches) != 0 {
+		return LibcMusl
+	}
+	return ""
+}
+
+// HostPlatform returns the platform of current machine
+func HostPlatform() *Platform {
+	return hostPlatform
+}
+
+// ParsePlatform is used to parse the platform in os/arch format, e.g. darwin/arm64,
+// the libc can be specified by the third part, e.g. linux/amd64/musl. The host platform is returned for empty string
+func ParsePlatform(s string) (*Platform, error) {
+	if s == "" {
+		return HostPlatform(), nil
+	}
+	items := strings.Split(s, "/")
+	if len(items) < 2 || len(items) > 3 || items[0] == "" || items[1] == "" {
+		return nil, errors.Errorf("invalid platform %s, should be in os/arch format", s)
+	}
+	platform := &Platform{
+		OS:   items[0],
+		Arch: items[1],
+	}
+	if len(items) == 3 {
+		if items[2] != LibcMusl || platform.OS != "linux" {
+			return nil, errors.Errorf("invalid platform %s, only linux/<arch>/%s is supported", s, LibcMusl)
+		}
+		platform.Libc = items[2]
+	}
+	return platform, nil
+}
+
+// String returns the platform in os/arch format
+func (p *Platform) String() string {
+	items := []string{p.OS, p.Arch}
+	if p.Libc != "" {
+		items = append(items, p.Libc)
+	}
+	return strings.Join(items, "/")
+}
+
+// IsHost reports whether the platform is the platform of current machine
+func (p *Platform) IsHost() bool {
+	return *p == *HostPlatform()
+}
+
+// BinaryFileName is used to get the file name of binary on the platform
+func (p *Platform) BinaryFileName(name string) string {
+	if p.OS == "windows" {
+		return name + ".exe"
+	}
+	return name
+}
+
+// GoEnv returns the environment variables to build go programs for the platform,
+// cgo is disabled for the other platforms so that the binaries are statically linked
+func (p *Platform) GoEnv() []string {
+	if p.IsHost() {
+		return nil
+	}
+	return []string{"GOOS=" + p.OS, "GOARCH=" + p.Arch, "CGO_ENABLED=0"}
+}
+
+// PathForPlatform is used to get the storage dir of the platform,
+// it is the storage dir itself for the host platform, and platforms/<os>-<arch> in it for others
+func PathForPlatform(storageDir string, platform *Platform) string {
+	if platform.IsHost() {
+		return storageDir
+	}
+	return filepath.Join(storageDir, "platforms", strings.ReplaceAll(platform.String(), "/", "-"))
+}
+
+// parsePlatformDir is used to get the platform of the storage dir returned by PathForPlatform
+func parsePlatformDir(storageDir string) (*Platform, bool) {
+	if filepath.Base(filepath.Dir(storageDir)) != "platforms" {
+		return nil, false
+	}
+	platform, err := ParsePlatform(strings.ReplaceAll(filepath.Base(storageDir), "-", "/"))
+	if err != nil {
+		return nil, false
+	}
+	return platform, true
+}
+
+// binaryFileName is used to get the file name of binary in the storage dir,
+// the binaries in the storage dir of other platforms are named for the platform
+func binaryFileName(storageDir string, name string) string {
+	if platform, ok := parsePlatformDir(storageDir); ok {
+		return platform.BinaryFileName(name)
+	}
+	return util.GetBinaryFileName(name)
+}
@@ -0,0 +1,100 @@
+// Copyright 2021 storyicon@foxmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pluginmanager_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/storyicon/powerproto/pkg/component/pluginmanager"
+	"github.com/storyicon/powerproto/pkg/util"
+)
+
+var _ = Describe("Platform", func() {
+	It("should parse platforms", func() {
+		platform, err := pluginmanager.ParsePlatform("")
+		Expect(err).To(BeNil())
+		Expect(platform.IsHost()).To(BeTrue())
+		for _, item := range []string{"darwin/arm64", "linux/amd64/musl", "windows/386"} {
+			platform, err := pluginmanager.ParsePlatform(item)
+			Expect(err).To(BeNil())
+			Expect(platform.String()).To(Equal(item))
+		}
+		for _, item := range []string{"linux", "linux/", "darwin/arm64/musl", "linux/amd64/v7", "a/b/c/d"} {
+			_, err := pluginmanager.ParsePlatform(item)
+			Expect(err).NotTo(BeNil(), item)
+		}
+	})
+	It("should store the cache of other platforms separately", func() {
+		storageDir := "/powerproto"
+		Expect(pluginmanager.PathForPlatform(storageDir, pluginmanager.HostPlatform())).To(Equal(storageDir))
+
+		platform, err := pluginmanager.ParsePlatform("windows/amd64")
+		Expect(err).To(BeNil())
+		platformDir := pluginmanager.PathForPlatform(storageDir, platform)
+		Expect(platformDir).To(Equal(filepath.Join(storageDir, "platforms", "windows-amd64")))
+		Expect(pluginmanager.PathForProtoc(platformDir, "v21.12")).To(Equal(filepath.Join(platformDir, "protoc", "21.12", "protoc.exe")))
+		local, err := pluginmanager.PathForPlugin(platformDir, "google.golang.org/protobuf/cmd/protoc-gen-go", "v1.27.1")
+		Expect(err).To(BeNil())
+		Expect(filepath.Base(local)).To(Equal("protoc-gen-go.exe"))
+
+		platform, err = pluginmanager.ParsePlatform("linux/amd64/musl")
+		Expect(err).To(BeNil())
+		if !platform.IsHost() {
+			Expect(pluginmanager.PathForPlatform(storageDir, platform)).To(Equal(filepath.Join(storageDir, "platforms", "linux-amd64-musl")))
+		}
+
+		cfg := pluginmanager.NewConfig()
+		cfg.StorageDir = storageDir
+		cfg.Platform = "darwin/arm64"
+		dir, err := cfg.GetStorageDir()
+		Expect(err).To(BeNil())
+		Expect(dir).To(Equal(filepath.Join(storageDir, "platforms", "darwin-arm64")))
+	})
+	It("should download protoc release for the platform", func() {
+		var requested []string
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requested = append(requested, filepath.Base(r.URL.Path))
+			if filepath.Base(r.URL.Path) != "protoc-3.17.3-osx-x86_64.zip" {
+				http.NotFound(w, r)
+				return
+			}
+			w.Write(newZip("bin/protoc", "include/google/protobuf/empty.proto"))
+		}))
+		defer server.Close()
+		mirrors := []string{server.URL + "/v$VERSION/$FILENAME"}
+
+		// the older versions are only released for x86_64 on darwin
+		platform, err := pluginmanager.ParsePlatform("darwin/arm64")
+		Expect(err).To(BeNil())
+		release, err := pluginmanager.GetProtocRelease(context.TODO(), mirrors, "v3.17.3", platform)
+		Expect(err).To(BeNil())
+		defer release.Clear()
+		Expect(requested).To(Equal([]string{"protoc-3.17.3-osx-aarch_64.zip", "protoc-3.17.3-osx-x86_64.zip"}))
+		exists, err := util.IsFileExists(release.GetProtocPath())
+		Expect(err).To(BeNil())
+		Expect(exists).To(BeTrue())
+
+		platform, err = pluginmanager.ParsePlatform("linux/amd64/musl")
+		Expect(err).To(BeNil())
+		_, err = pluginmanager.GetProtocRelease(context.TODO(), mirrors, "v3.17.3", platform)
+		Expect(err).NotTo(BeNil())
+	})
+})
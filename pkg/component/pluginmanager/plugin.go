@@ -16,13 +16,24 @@ package pluginmanager
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
 	"path/filepath"
+	"runtime"
+	"sort"
 	"strings"
 	"time"
 
 	"github.com/hashicorp/go-multierror"
 	jsoniter "github.com/json-iterator/go"
+	"github.com/pkg/errors"
 
+	"github.com/storyicon/powerproto/pkg/configs"
+	"github.com/storyicon/powerproto/pkg/consts"
 	"github.com/storyicon/powerproto/pkg/util"
 	"github.com/storyicon/powerproto/pkg/util/command"
 	"github.com/storyicon/powerproto/pkg/util/logger"
@@ -40,7 +51,17 @@ func IsPluginInstalled(ctx context.Context,
 	if err != nil {
 		return false, "", err
 	}
-	if exists {
+	if !exists {
+		return false, "", nil
+	}
+	// the plugin installed before the completion marker is introduced is adopted
+	completed, err := adoptLegacyInstall(ctx, storageDir, filepath.Dir(local), func() (bool, error) {
+		return util.IsFileExists(local)
+	})
+	if err != nil {
+		return false, "", err
+	}
+	if completed {
 		return true, local, nil
 	}
 	return false, "", nil
@@ -50,6 +71,7 @@ func IsPluginInstalled(ctx context.Context,
 func InstallPluginUsingGo(ctx context.Context,
 	log logger.Logger,
 	storageDir string,
+	platform *Platform,
 	path string, version string) (string, error) {
 	exists, local, err := IsPluginInstalled(ctx, storageDir, path, version)
 	if err != nil {
@@ -58,25 +80,323 @@ func InstallPluginUsingGo(ctx context.Context,
 	if exists {
 		return local, nil
 	}
+	uri := util.JoinGoPackageVersion(path, version)
+	if consts.IsOffline(ctx) {
+		return "", &ErrOffline{Action: "go install " + uri}
+	}
 
 	local, err = PathForPlugin(storageDir, path, version)
 	if err != nil {
 		return "", err
 	}
-	dir := filepath.Dir(local)
+	install := func(dir string) error {
+		if !platform.IsHost() {
+			return crossInstallUsingGo(ctx, log, platform, uri, dir)
+		}
+		_, err := command.Execute(ctx, log, "", "go", []string{
+			"install", uri,
+		}, []string{"GOBIN=" + dir, "GO111MODULE=on"})
+		if err != nil {
+			return &ErrGoInstall{
+				ErrCommandExec: err.(*command.ErrCommandExec),
+			}
+		}
+		return nil
+	}
+	// the command is only displayed in dryRun mode, there is nothing to stage
+	if consts.IsDryRun(ctx) && !consts.IsIgnoreDryRun(ctx) {
+		if err := install(filepath.Dir(local)); err != nil {
+			return "", err
+		}
+		return local, nil
+	}
+	err = installAtomically(ctx, storageDir, filepath.Dir(local), func(staging string) error {
+		if err := install(staging); err != nil {
+			return err
+		}
+		return RecordChecksum(filepath.Join(staging, filepath.Base(local)))
+	})
+	if err != nil {
+		return "", err
+	}
+	return local, nil
+}
 
-	uri := util.JoinGoPackageVersion(path, version)
-	_, err2 := command.Execute(ctx, log, "", "go", []string{
-		"install", uri,
-	}, []string{"GOBIN=" + dir, "GO111MODULE=on"})
-	if err2 != nil {
-		return "", &ErrGoInstall{
-			ErrCommandExec: err2.(*command.ErrCommandExec),
+// crossInstallUsingGo is used to install the plugin for other platform into dir.
+// go refuses to install cross-compiled binaries into GOBIN, so they are installed
+// into bin/<os>_<arch> of a temporary GOPATH sharing the module cache, and moved into dir
+func crossInstallUsingGo(ctx context.Context, log logger.Logger, platform *Platform, uri string, dir string) error {
+	data, err := command.Execute(consts.WithIgnoreDryRun(ctx), log, "", "go", []string{
+		"env", "GOMODCACHE",
+	}, nil)
+	if err != nil {
+		return err
+	}
+	gopath, err := os.MkdirTemp("", "")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(gopath)
+	env := append([]string{
+		"GO111MODULE=on",
+		"GOBIN=",
+		"GOPATH=" + gopath,
+		"GOMODCACHE=" + strings.TrimSpace(string(data)),
+	}, platform.GoEnv()...)
+	_, err = command.Execute(ctx, log, "", "go", []string{"install", uri}, env)
+	if err != nil {
+		return &ErrGoInstall{
+			ErrCommandExec: err.(*command.ErrCommandExec),
+		}
+	}
+	// the command is only displayed in dryRun mode
+	if consts.IsDryRun(ctx) && !consts.IsIgnoreDryRun(ctx) {
+		return nil
+	}
+	name := platform.BinaryFileName(GetGoPkgExecName(strings.SplitN(uri, "@", 2)[0]))
+	bin := filepath.Join(gopath, "bin")
+	// go only treats the binaries for other os or arch as cross-compiled
+	if platform.OS != runtime.GOOS || platform.Arch != runtime.GOARCH {
+		bin = filepath.Join(bin, platform.OS+"_"+platform.Arch)
+	}
+	return os.Rename(filepath.Join(bin, name), filepath.Join(dir, name))
+}
+
+// PluginAsset defines the release asset of prebuilt plugin for a platform
+type PluginAsset struct {
+	URL string
+	// Binary is the path of binary in the archive, the asset is the binary itself when it is empty
+	Binary string
+	Sha256 string
+}
+
+// GetPluginAsset is used to get the release asset of plugin for the platform, e.g. linux/amd64.
+// $VERSION, $OS and $ARCH in the templates are rendered
+func GetPluginAsset(release *configs.PluginRelease, version string, platform string) (*PluginAsset, error) {
+	template, ok := release.URLs[platform]
+	if !ok {
+		return nil, errors.Errorf("no release url for %s", platform)
+	}
+	checksum, ok := release.Sha256[platform]
+	if !ok || checksum == "" {
+		return nil, errors.Errorf("no sha256 checksum of release for %s", platform)
+	}
+	items := strings.SplitN(platform, "/", 2)
+	if len(items) != 2 {
+		return nil, errors.Errorf("invalid platform %s, should be in os/arch format", platform)
+	}
+	variables := map[string]string{
+		"VERSION": version,
+		"OS":      items[0],
+		"ARCH":    items[1],
+	}
+	return &PluginAsset{
+		URL:    util.RenderWithEnv(template, variables),
+		Binary: util.RenderWithEnv(release.Binary, variables),
+		Sha256: checksum,
+	}, nil
+}
+
+// InstallPluginFromRelease is used to install the prebuilt plugin from the release asset,
+// it is installed into the same location as the plugins installed by go
+func InstallPluginFromRelease(ctx context.Context,
+	storageDir string,
+	path string, version string, asset *PluginAsset) (string, error) {
+	exists, local, err := IsPluginInstalled(ctx, storageDir, path, version)
+	if err != nil {
+		return "", err
+	}
+	if exists {
+		return local, nil
+	}
+	local, err = PathForPlugin(storageDir, path, version)
+	if err != nil {
+		return "", err
+	}
+	err = installAtomically(ctx, storageDir, filepath.Dir(local), func(staging string) error {
+		workspace, err := os.MkdirTemp("", "")
+		if err != nil {
+			return err
+		}
+		defer os.RemoveAll(workspace)
+		var source string
+		if asset.Binary == "" {
+			source, err = downloadVerified(ctx, asset.URL, asset.Sha256, workspace)
+		} else {
+			source, err = downloadArchive(ctx, asset.URL, asset.Sha256, workspace)
+			source = filepath.Join(source, filepath.FromSlash(asset.Binary))
+		}
+		if err != nil {
+			return err
+		}
+		exists, err := util.IsFileExists(source)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			return errors.Errorf("%s is not found in %s", asset.Binary, asset.URL)
+		}
+		binary := filepath.Join(staging, filepath.Base(local))
+		if err := util.CopyFile(source, binary); err != nil {
+			return err
+		}
+		// * it is required on unix system
+		if err := os.Chmod(binary, fs.ModePerm); err != nil {
+			return err
+		}
+		return RecordChecksum(binary)
+	})
+	if err != nil {
+		return "", err
+	}
+	return local, nil
+}
+
+// InstallPluginFromDir is used to build the plugin package in the local go module dir,
+// pkg is the package path relative to dir, e.g. ./cmd/protoc-gen-go-grpc.
+// The binary is cached by the hash of sources and rebuilt once they are changed
+func InstallPluginFromDir(ctx context.Context,
+	log logger.Logger,
+	storageDir string,
+	platform *Platform,
+	dir string, pkg string) (string, error) {
+	sum, err := hashGoSources(ctx, log, platform, dir, pkg)
+	if err != nil {
+		return "", err
+	}
+	name := GetGoPkgExecName(path.Clean(path.Join(filepath.ToSlash(dir), filepath.ToSlash(pkg))))
+	local := PathForLocalPlugin(storageDir, name, hashStrings(pkg, sum))
+	completed, err := isInstallCompleted(filepath.Dir(local))
+	if err != nil {
+		return "", err
+	}
+	if completed {
+		return local, nil
+	}
+	env := getLocalGoEnv(ctx, platform)
+	build := func(binary string) error {
+		_, err := command.Execute(ctx, log, dir, "go", []string{
+			"build", "-o", binary, pkg,
+		}, env)
+		if err != nil {
+			return &ErrGoInstall{
+				ErrCommandExec: err.(*command.ErrCommandExec),
+			}
+		}
+		return nil
+	}
+	// the command is only displayed in dryRun mode, there is nothing to stage
+	if consts.IsDryRun(ctx) && !consts.IsIgnoreDryRun(ctx) {
+		if err := build(local); err != nil {
+			return "", err
+		}
+		return local, nil
+	}
+	err = installAtomically(ctx, storageDir, filepath.Dir(local), func(staging string) error {
+		binary := filepath.Join(staging, filepath.Base(local))
+		if err := build(binary); err != nil {
+			return err
 		}
+		return RecordChecksum(binary)
+	})
+	if err != nil {
+		return "", err
 	}
 	return local, nil
 }
 
+// getLocalGoEnv is used to get the environment variables of go commands executed in the local go module
+// for the platform, the module proxy is disabled in offline mode
+func getLocalGoEnv(ctx context.Context, platform *Platform) []string {
+	env := append([]string{"GO111MODULE=on"}, platform.GoEnv()...)
+	if consts.IsOffline(ctx) {
+		env = append(env, "GOPROXY=off")
+	}
+	return env
+}
+
+// hashGoSources is used to get the hash of sources of the package for the platform in the go module dir,
+// which are the files in the directories of the package and its dependencies in the module,
+// and the go.mod, go.sum of the module. The other dependencies are pinned by go.sum
+func hashGoSources(ctx context.Context, log logger.Logger, platform *Platform, dir string, pkg string) (string, error) {
+	// it only reads the sources, so it is executed even in dry run mode
+	data, err := command.Execute(consts.WithIgnoreDryRun(ctx), log, dir, "go", []string{
+		"list", "-deps", "-f", "{{if not .Standard}}{{.Dir}}{{end}}", pkg,
+	}, getLocalGoEnv(ctx, platform))
+	if err != nil {
+		return "", &ErrGoList{
+			ErrCommandExec: err.(*command.ErrCommandExec),
+		}
+	}
+	files := []string{filepath.Join(dir, "go.mod"), filepath.Join(dir, "go.sum")}
+	for _, item := range strings.Split(string(data), "\n") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		if rel, err := filepath.Rel(dir, item); err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			continue
+		}
+		entries, err := os.ReadDir(item)
+		if err != nil {
+			return "", err
+		}
+		for _, entry := range entries {
+			if entry.Type().IsRegular() {
+				files = append(files, filepath.Join(item, entry.Name()))
+			}
+		}
+	}
+	sort.Strings(files)
+	hash := sha256.New()
+	for _, file := range files {
+		sum, err := hashFile(file)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return "", err
+		}
+		rel, err := filepath.Rel(dir, file)
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(hash, "%s %s\n", filepath.ToSlash(rel), sum)
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// FindGoModule is used to find the go module containing the package dir,
+// it returns the directory of module and the package path relative to it, e.g. ./cmd/protoc-gen-foo
+func FindGoModule(dir string) (string, string, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", "", err
+	}
+	for cur := dir; ; cur = filepath.Dir(cur) {
+		exists, err := util.IsFileExists(filepath.Join(cur, "go.mod"))
+		if err != nil {
+			return "", "", err
+		}
+		if exists {
+			rel, err := filepath.Rel(cur, dir)
+			if err != nil {
+				return "", "", err
+			}
+			return cur, "./" + filepath.ToSlash(rel), nil
+		}
+		if filepath.Dir(cur) == cur {
+			return "", "", errors.Errorf("no go.mod is found for %s", dir)
+		}
+	}
+}
+
+// hashStrings is used to get the short hash of strings
+func hashStrings(items ...string) string {
+	sum := sha256.Sum256([]byte(strings.Join(items, "\n")))
+	return hex.EncodeToString(sum[:8])
+}
+
 // ///////////////// Version Control /////////////////
 
 // Module defines the model of go list data
@@ -92,7 +412,7 @@ type Module struct {
 	Dir       string       // directory holding files for this module, if any
 	GoMod     string       // path to go.mod file used when loading this module, if any
 	GoVersion string       // go version used in module
-	Retracted string       // retraction information, if any (with -retracted or -u)
+	Retracted []string     // retraction information, if any (with -retracted or -u)
 	Error     *ModuleError // error loading module
 }
 
@@ -101,12 +421,16 @@ type ModuleError struct {
 	Err string // the error itself
 }
 
-// ListGoPackageVersions is list go package versions
+// ListGoPackageVersions is list go package versions,
+// the retracted versions are omitted by go list -m -versions
 func ListGoPackageVersions(ctx context.Context, log logger.Logger, path string) ([]string, error) {
 	// query from latest version
 	// If latest is not specified here, the queried version
 	// may be restricted to the current project go.mod/go.sum
 	pkg := util.JoinGoPackageVersion(path, "latest")
+	if consts.IsOffline(ctx) {
+		return nil, &ErrOffline{Action: "go list -m " + pkg}
+	}
 	data, err := command.Execute(ctx, log, "", "go", []string{
 		"list", "-m", "-json", "-versions", pkg,
 	}, []string{
@@ -127,8 +451,41 @@ func ListGoPackageVersions(ctx context.Context, log logger.Logger, path string)
 	return []string{module.Version}, nil
 }
 
+// GetGoPackageRetraction is used to get the retraction rationales of the module of go package at the version,
+// nil is returned if it is not retracted. The module is the longest prefix of package path found by go list -m
+func GetGoPackageRetraction(ctx context.Context, log logger.Logger, pkg string, version string) ([]string, error) {
+	if consts.IsOffline(ctx) {
+		return nil, &ErrOffline{Action: "go list -m -retracted " + pkg}
+	}
+	var errs error
+	items := strings.Split(pkg, "/")
+	for i := len(items); i >= 2; i-- {
+		path := util.JoinGoPackageVersion(strings.Join(items[0:i], "/"), version)
+		data, err := command.Execute(ctx, log, "", "go", []string{
+			"list", "-m", "-json", "-retracted", path,
+		}, []string{
+			"GO111MODULE=on",
+		})
+		if err != nil {
+			errs = multierror.Append(errs, &ErrGoList{
+				ErrCommandExec: err.(*command.ErrCommandExec),
+			})
+			continue
+		}
+		var module Module
+		if err := jsoniter.Unmarshal(data, &module); err != nil {
+			return nil, err
+		}
+		return module.Retracted, nil
+	}
+	return nil, errs
+}
+
 // ListsGoPackageVersionsAmbiguously is used to list go package versions ambiguously
 func ListsGoPackageVersionsAmbiguously(ctx context.Context, log logger.Logger, pkg string) ([]string, error) {
+	if consts.IsOffline(ctx) {
+		return nil, &ErrOffline{Action: "go list -m " + pkg}
+	}
 	type Result struct {
 		err      error
 		pkg      string
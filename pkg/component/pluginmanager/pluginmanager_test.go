@@ -16,7 +16,8 @@ package pluginmanager_test
 
 import (
 	"context"
-	"path/filepath"
+	"io/ioutil"
+	"os"
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
@@ -26,24 +27,36 @@ import (
 )
 
 var _ = Describe("PluginManager", func() {
-	cfg := pluginmanager.NewConfig()
-	cfg.StorageDir, _ = filepath.Abs("./tests")
-
 	const pluginPkg = "google.golang.org/protobuf/cmd/protoc-gen-go"
+	var storageDir string
 	var manager pluginmanager.PluginManager
-	It("should able to init", func() {
-		pluginManager, err := pluginmanager.NewPluginManager(cfg, logger.NewDefault("pluginmanager"))
+	BeforeEach(func() {
+		var err error
+		storageDir, err = ioutil.TempDir("", "powerproto-pluginmanager")
+		Expect(err).To(BeNil())
+		cfg := pluginmanager.NewConfig()
+		cfg.StorageDir = storageDir
+		manager, err = pluginmanager.NewPluginManager(cfg, logger.NewDefault("pluginmanager"))
 		Expect(err).To(BeNil())
-		Expect(pluginManager).To(Not(BeNil()))
-		manager = pluginManager
+		Expect(manager).To(Not(BeNil()))
+	})
+	AfterEach(func() {
+		os.RemoveAll(storageDir)
 	})
 	It("should able to install protoc", func() {
 		versions, err := manager.ListProtocVersions(context.TODO())
 		Expect(err).To(BeNil())
 		Expect(len(versions) > 0).To(BeTrue())
-		latestVersion, err := manager.GetProtocLatestVersion(context.TODO())
+		latestVersion, err := manager.GetProtocLatestVersion(context.TODO(), false)
 		Expect(err).To(BeNil())
-		Expect(latestVersion).To(Equal(versions[len(versions)-1]))
+		// the release candidates are skipped unless prerelease is required
+		var latestRelease string
+		for _, version := range versions {
+			if pluginmanager.IsProtocReleaseVersion(version, false) {
+				latestRelease = version
+			}
+		}
+		Expect(latestVersion).To(Equal(latestRelease))
 
 		local, err := manager.InstallProtoc(context.TODO(), latestVersion)
 		Expect(err).To(BeNil())
@@ -57,9 +70,9 @@ var _ = Describe("PluginManager", func() {
 		Expect(err).To(BeNil())
 		Expect(len(versions) > 0).To(BeTrue())
 
-		latestVersion, err := manager.GetPluginLatestVersion(context.TODO(), pluginPkg)
+		latestVersion, err := manager.GetPluginLatestVersion(context.TODO(), pluginPkg, false)
 		Expect(err).To(BeNil())
-		Expect(latestVersion).To(Equal(versions[len(versions)-1]))
+		Expect(versions).To(ContainElement(latestVersion))
 
 		local, err := manager.InstallPlugin(context.TODO(), pluginPkg, latestVersion)
 		Expect(err).To(BeNil())
@@ -72,15 +85,15 @@ var _ = Describe("PluginManager", func() {
 	})
 	It("should able to install git repos", func() {
 		const uri = "https://github.com/gogo/protobuf"
-		latestVersion, err := manager.GetGitRepoLatestVersion(context.TODO(), uri)
+		latestVersion, err := manager.GetGitRepoLatestVersion(context.TODO(), uri, "latest")
 		Expect(err).To(BeNil())
 		Expect(len(latestVersion) > 0).To(Equal(true))
 
-		local, err := manager.InstallGitRepo(context.TODO(), uri, latestVersion)
+		local, err := manager.InstallGitRepo(context.TODO(), uri, latestVersion, nil)
 		Expect(err).To(BeNil())
 		Expect(len(local) > 0).To(BeTrue())
 
-		exists, local, err := manager.IsGitRepoInstalled(context.TODO(), uri, latestVersion)
+		exists, local, err := manager.IsGitRepoInstalled(context.TODO(), uri, latestVersion, nil)
 		Expect(err).To(BeNil())
 		Expect(exists).To(BeTrue())
 		Expect(len(local) != 0).To(BeTrue())
@@ -21,19 +21,25 @@ import (
 	"io/fs"
 	"net/http"
 	"os"
+	"os/exec"
 	"path/filepath"
-	"runtime"
+	"regexp"
 	"strings"
 
+	"github.com/hashicorp/go-multierror"
 	"github.com/mholt/archiver"
 	"github.com/pkg/errors"
 
+	"github.com/storyicon/powerproto/pkg/consts"
 	"github.com/storyicon/powerproto/pkg/util"
+	"github.com/storyicon/powerproto/pkg/util/command"
+	"github.com/storyicon/powerproto/pkg/util/logger"
 )
 
 // ProtocRelease defines the release of protoc
 type ProtocRelease struct {
 	workspace string
+	platform  *Platform
 }
 
 // GetIncludePath is used to get the include path
@@ -43,7 +49,7 @@ func (p *ProtocRelease) GetIncludePath() string {
 
 // GetProtocPath is used to get the protoc path
 func (p *ProtocRelease) GetProtocPath() string {
-	return filepath.Join(p.workspace, "bin", util.GetBinaryFileName("protoc"))
+	return filepath.Join(p.workspace, "bin", p.platform.BinaryFileName("protoc"))
 }
 
 // Clear is used to clear the workspace
@@ -51,91 +57,280 @@ func (p *ProtocRelease) Clear() error {
 	return os.RemoveAll(p.workspace)
 }
 
-// GetProtocRelease is used to download protoc release
-func GetProtocRelease(ctx context.Context, version string) (*ProtocRelease, error) {
-	if strings.HasPrefix(version, "v") {
-		version = strings.TrimPrefix(version, "v")
+// LocalProtoc defines the protoc that is not installed by PowerProto
+type LocalProtoc struct {
+	Binary string
+	// IncludeDir is the directory of well known types, e.g. google/protobuf/empty.proto,
+	// it is empty if it can not be found
+	IncludeDir string
+	Version    string
+}
+
+// FindLocalProtoc is used to find the protoc in PATH or at the binary path, and verify its version if declared.
+// The include dir is the explicit one, or the include directory next to the bin directory of protoc
+func FindLocalProtoc(ctx context.Context, log logger.Logger, binary string, version string, include string) (*LocalProtoc, error) {
+	if binary == "" {
+		path, err := exec.LookPath(util.GetBinaryFileName("protoc"))
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to find protoc in PATH")
+		}
+		binary = path
 	}
-	workspace, err := os.MkdirTemp("", "")
+	exists, err := util.IsFileExists(binary)
 	if err != nil {
 		return nil, err
 	}
-	suffix, err := inferProtocReleaseSuffix()
+	if !exists {
+		return nil, errors.Errorf("protoc is not found at %s", binary)
+	}
+	// the version is queried even in dry run mode to verify it
+	data, err := command.Execute(consts.WithIgnoreDryRun(ctx), log, "", binary, []string{"--version"}, nil)
 	if err != nil {
 		return nil, err
 	}
-	filename := fmt.Sprintf("protoc-%s-%s.zip", version, suffix)
-	url := fmt.Sprintf("https://github.com/protocolbuffers/protobuf/"+
-		"releases/download/v%s/%s", version, filename)
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	actual := strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(string(data)), "libprotoc"))
+	if version != "" && !isSameProtocVersion(version, actual) {
+		return nil, errors.Errorf("the version of %s is %s, but %s is declared", binary, actual, version)
+	}
+	if include == "" {
+		include = filepath.Join(filepath.Dir(filepath.Dir(binary)), "include")
+	}
+	exists, err = util.IsDirExists(include)
 	if err != nil {
-		return nil, &ErrHTTPDownload{
-			Url: url,
-			Err: err,
-		}
+		return nil, err
 	}
-	resp, err := http.DefaultClient.Do(req)
+	if !exists {
+		include = ""
+	}
+	return &LocalProtoc{
+		Binary:     binary,
+		IncludeDir: include,
+		Version:    actual,
+	}, nil
+}
+
+// isSameProtocVersion is used to compare the declared version and the version printed by protoc,
+// since v21, the release 21.12 prints libprotoc 3.21.12
+func isSameProtocVersion(declared string, actual string) bool {
+	declared = strings.TrimPrefix(declared, "v")
+	return declared == actual || actual == "3."+declared
+}
+
+// GetProtocRelease is used to download protoc release for the platform
+// The mirrors are the url templates tried in order, $VERSION and $FILENAME can be used in them
+func GetProtocRelease(ctx context.Context, mirrors []string, version string, platform *Platform) (*ProtocRelease, error) {
+	if strings.HasPrefix(version, "v") {
+		version = strings.TrimPrefix(version, "v")
+	}
+	suffixes, err := inferProtocReleaseSuffixes(platform)
 	if err != nil {
-		return nil, &ErrHTTPDownload{
-			Url: url,
-			Err: err,
-		}
+		return nil, err
 	}
-	zipFilePath := filepath.Join(workspace, filename)
-	if err := downloadFile(resp, zipFilePath); err != nil {
-		return nil, &ErrHTTPDownload{
-			Url:  url,
-			Err:  err,
-			Code: resp.StatusCode,
+	workspace, err := os.MkdirTemp("", "")
+	if err != nil {
+		return nil, err
+	}
+	var zipFilePath string
+	var errs error
+	// the assets of the older versions may be missing for the suffixes preferred
+	for _, suffix := range suffixes {
+		filename := GetProtocReleaseFileName(version, suffix)
+		zipFilePath = filepath.Join(workspace, filename)
+		err := downloadFromMirrors(ctx, mirrors, map[string]string{
+			"VERSION":  version,
+			"FILENAME": filename,
+		}, zipFilePath)
+		if err == nil {
+			errs = nil
+			break
 		}
+		errs = multierror.Append(errs, err)
+	}
+	if errs != nil {
+		os.RemoveAll(workspace)
+		return nil, errs
 	}
 	zip := archiver.NewZip()
 	if err := zip.Unarchive(zipFilePath, workspace); err != nil {
+		os.RemoveAll(workspace)
 		return nil, err
 	}
 	return &ProtocRelease{
 		workspace: workspace,
+		platform:  platform,
 	}, nil
 }
 
+// regexpProtocVersion matches the release versions of protoc, e.g. v3.17.3, v21.12 and v22.0-rc3,
+// the number of release candidate is captured by the second group
+var regexpProtocVersion = regexp.MustCompile(`^v?([0-9]+\.[0-9]+(?:\.[0-9]+)?)(?:-rc-?([0-9]+))?$`)
+
+// IsProtocReleaseVersion is used to determine whether the tag is a release of protoc,
+// the release candidates are accepted only if prerelease is true
+func IsProtocReleaseVersion(version string, prerelease bool) bool {
+	matches := regexpProtocVersion.FindStringSubmatch(version)
+	if matches == nil {
+		return false
+	}
+	return prerelease || matches[2] == ""
+}
+
+// GetProtocReleaseFileName is used to get the file name of protoc release asset, e.g. protoc-21.12-linux-x86_64.zip.
+// The release candidate tagged v22.0-rc3 is released as protoc-22.0-rc-3-linux-x86_64.zip
+func GetProtocReleaseFileName(version string, suffix string) string {
+	name := strings.TrimPrefix(version, "v")
+	if matches := regexpProtocVersion.FindStringSubmatch(version); matches != nil && matches[2] != "" {
+		name = matches[1] + "-rc-" + matches[2]
+	}
+	return fmt.Sprintf("protoc-%s-%s.zip", name, suffix)
+}
+
+// GetProtocIncludePath is used to get the include path of the specified version protoc.
+// The legacy shared include dir is returned for the protoc installed without its own include files
+func GetProtocIncludePath(storageDir string, version string) (string, error) {
+	include := PathForProtocInclude(storageDir, version)
+	exists, err := util.IsDirExists(include)
+	if err != nil || exists {
+		return include, err
+	}
+	legacy := PathForInclude(storageDir)
+	exists, err = util.IsDirExists(legacy)
+	if err != nil {
+		return "", err
+	}
+	if exists {
+		return legacy, nil
+	}
+	return include, nil
+}
+
+// IsLegacyIncludeUsed reports whether any protoc binary in the storage dir has no include files of its own,
+// in which case the legacy shared include dir is still used. The protoc without completion marker is counted,
+// because it may be installed by earlier releases and not adopted yet
+func IsLegacyIncludeUsed(storageDir string) (bool, error) {
+	names, err := readDirNames(PathForProtocDir(storageDir, ""))
+	if err != nil {
+		return false, err
+	}
+	for _, version := range names {
+		exists, err := util.IsFileExists(PathForProtoc(storageDir, version))
+		if err != nil {
+			return false, err
+		}
+		if !exists {
+			continue
+		}
+		exists, err = util.IsDirExists(PathForProtocInclude(storageDir, version))
+		if err != nil {
+			return false, err
+		}
+		if !exists {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
 // IsProtocInstalled is used to check whether the protoc version is installed
 func IsProtocInstalled(ctx context.Context, storageDir string, version string) (bool, string, error) {
 	local := PathForProtoc(storageDir, version)
 	exists, err := util.IsFileExists(local)
-	if err != nil {
-		return false, "", err
+	if err != nil || !exists {
+		return false, local, err
 	}
-	return exists, local, nil
+	// the protoc installed before the completion marker is introduced is adopted
+	completed, err := adoptLegacyInstall(ctx, storageDir, PathForProtocDir(storageDir, version), func() (bool, error) {
+		return util.IsFileExists(local)
+	})
+	return completed, local, err
 }
 
-func inferProtocReleaseSuffix() (string, error) {
-	goos := strings.ToLower(runtime.GOOS)
-	arch := strings.ToLower(runtime.GOARCH)
+// inferProtocReleaseSuffixes is used to get the suffixes of protoc release assets for the platform in preferred order
+func inferProtocReleaseSuffixes(platform *Platform) ([]string, error) {
+	goos := strings.ToLower(platform.OS)
+	arch := strings.ToLower(platform.Arch)
 	switch goos {
 	case "linux":
+		// the linux releases are linked against glibc
+		if platform.Libc == LibcMusl {
+			return nil, errors.Errorf("protoc did not release on %s, "+
+				"please use the protoc of the distribution by 'protoc: system', e.g. apk add protobuf", platform)
+		}
 		switch arch {
 		case "arm64":
-			return "linux-aarch_64", nil
+			return []string{"linux-aarch_64"}, nil
 		case "ppc64le":
-			return "linux-ppcle_64", nil
+			return []string{"linux-ppcle_64"}, nil
 		case "s390x":
-			return "linux-s390_64", nil
+			return []string{"linux-s390_64"}, nil
 		case "386":
-			return "linux-x86_32", nil
+			return []string{"linux-x86_32"}, nil
 		case "amd64":
-			return "linux-x86_64", nil
+			return []string{"linux-x86_64"}, nil
 		}
 	case "darwin":
-		return "osx-x86_64", nil
+		switch arch {
+		case "arm64":
+			// the older versions are only released for x86_64, which runs under rosetta
+			return []string{"osx-aarch_64", "osx-x86_64"}, nil
+		case "amd64":
+			return []string{"osx-x86_64"}, nil
+		}
 	case "windows":
 		switch arch {
 		case "386":
-			return "win32", nil
+			return []string{"win32"}, nil
 		case "amd64":
-			return "win64", nil
+			return []string{"win64"}, nil
 		}
 	}
-	return "", errors.New("protoc did not release on this platform")
+	return nil, errors.Errorf("protoc did not release on %s", platform)
+}
+
+// downloadFromMirrors is used to download file from the mirrors in order until one succeeds,
+// the url of mirror is rendered from the template with variables
+func downloadFromMirrors(ctx context.Context, mirrors []string, variables map[string]string, destination string) error {
+	if len(mirrors) == 0 {
+		return errors.New("no mirror is configured")
+	}
+	var errs error
+	for _, mirror := range mirrors {
+		url := util.RenderWithEnv(mirror, variables)
+		if err := downloadURL(ctx, url, destination); err != nil {
+			errs = multierror.Append(errs, err)
+			continue
+		}
+		return nil
+	}
+	return errs
+}
+
+func downloadURL(ctx context.Context, url string, destination string) error {
+	if consts.IsOffline(ctx) {
+		return &ErrOffline{Action: "download " + url}
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return &ErrHTTPDownload{
+			Url: url,
+			Err: err,
+		}
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return &ErrHTTPDownload{
+			Url: url,
+			Err: err,
+		}
+	}
+	if err := downloadFile(resp, destination); err != nil {
+		return &ErrHTTPDownload{
+			Url:  url,
+			Err:  err,
+			Code: resp.StatusCode,
+		}
+	}
+	return nil
 }
 
 func downloadFile(resp *http.Response, destination string) error {
@@ -0,0 +1,159 @@
+// Copyright 2021 storyicon@foxmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pluginmanager_test
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/storyicon/powerproto/pkg/component/pluginmanager"
+	"github.com/storyicon/powerproto/pkg/consts"
+	"github.com/storyicon/powerproto/pkg/util/logger"
+)
+
+var _ = Describe("Protoc", func() {
+	It("should resolve latest version from real tag lists", func() {
+		tests := []struct {
+			name       string
+			tags       []string
+			stable     string
+			prerelease string
+		}{
+			{
+				name:       "3.x releases",
+				tags:       []string{"v3.0.0-alpha-3", "v3.0.0-beta-1", "v3.11.4", "v3.17.3", "v3.18.0-rc1", "v3.9.0"},
+				stable:     "v3.17.3",
+				prerelease: "v3.18.0-rc1",
+			},
+			{
+				name:       "two-component releases",
+				tags:       []string{"v3.20.3", "v3.19.0-rc2", "v21.0-rc1", "v21.12", "v21.9", "v22.0-rc3", "v22.0"},
+				stable:     "v22.0",
+				prerelease: "v22.0",
+			},
+			{
+				name:       "pending release candidate",
+				tags:       []string{"v3.20.3", "v24.4", "v25.0-rc2", "v25.1", "v26.0-rc1", "v26.0-rc2"},
+				stable:     "v25.1",
+				prerelease: "v26.0-rc2",
+			},
+			{
+				name:       "only release candidates",
+				tags:       []string{"v21.0-rc1", "v21.0-rc2"},
+				stable:     "",
+				prerelease: "v21.0-rc2",
+			},
+		}
+		ctx := consts.WithOffline(context.TODO())
+		for _, tt := range tests {
+			storageDir, err := ioutil.TempDir("", "powerproto-protoc")
+			Expect(err).To(BeNil())
+			defer os.RemoveAll(storageDir)
+			for _, tag := range tt.tags {
+				touchInstalled(pluginmanager.PathForProtoc(storageDir, tag))
+			}
+			cfg := pluginmanager.NewConfig()
+			cfg.StorageDir = storageDir
+			manager, err := pluginmanager.NewBasicPluginManager(cfg, logger.NewDefault("protoc"))
+			Expect(err).To(BeNil())
+
+			version, err := manager.GetProtocLatestVersion(ctx, false)
+			if tt.stable == "" {
+				Expect(err).NotTo(BeNil(), tt.name)
+			} else {
+				Expect(err).To(BeNil(), tt.name)
+				Expect(version).To(Equal(tt.stable), tt.name)
+			}
+			version, err = manager.GetProtocLatestVersion(ctx, true)
+			Expect(err).To(BeNil(), tt.name)
+			Expect(version).To(Equal(tt.prerelease), tt.name)
+		}
+	})
+	It("should resolve include dir per version", func() {
+		storageDir, err := ioutil.TempDir("", "powerproto-protoc")
+		Expect(err).To(BeNil())
+		defer os.RemoveAll(storageDir)
+		touchInstalled(pluginmanager.PathForProtoc(storageDir, "v3.17.3"))
+		touchInstalled(pluginmanager.PathForProtoc(storageDir, "v21.12"))
+		touchFile(filepath.Join(pluginmanager.PathForProtocInclude(storageDir, "v21.12"), "google", "protobuf", "empty.proto"))
+
+		include, err := pluginmanager.GetProtocIncludePath(storageDir, "v21.12")
+		Expect(err).To(BeNil())
+		Expect(include).To(Equal(pluginmanager.PathForProtocInclude(storageDir, "21.12")))
+		include, err = pluginmanager.GetProtocIncludePath(storageDir, "v3.17.3")
+		Expect(err).To(BeNil())
+		Expect(include).To(Equal(pluginmanager.PathForProtocInclude(storageDir, "v3.17.3")))
+		used, err := pluginmanager.IsLegacyIncludeUsed(storageDir)
+		Expect(err).To(BeNil())
+		Expect(used).To(BeTrue())
+
+		// the protoc installed by legacy versions falls back to the shared include dir
+		touchFile(filepath.Join(pluginmanager.PathForInclude(storageDir), "google", "protobuf", "empty.proto"))
+		include, err = pluginmanager.GetProtocIncludePath(storageDir, "v3.17.3")
+		Expect(err).To(BeNil())
+		Expect(include).To(Equal(pluginmanager.PathForInclude(storageDir)))
+
+		entries, err := pluginmanager.ListCacheEntries(storageDir)
+		Expect(err).To(BeNil())
+		Expect(entries).To(HaveLen(2))
+		manifest, err := pluginmanager.ExportBundle(storageDir, entries[1:], &bytes.Buffer{})
+		Expect(err).To(BeNil())
+		Expect(manifest.Entries).To(HaveLen(1))
+		Expect(manifest.Entries[0].Version).To(Equal("v21.12"))
+
+		Expect(os.RemoveAll(pluginmanager.PathForProtocDir(storageDir, "v3.17.3"))).To(BeNil())
+		used, err = pluginmanager.IsLegacyIncludeUsed(storageDir)
+		Expect(err).To(BeNil())
+		Expect(used).To(BeFalse())
+
+		// the protoc installed by legacy versions has no completion marker
+		touchFile(pluginmanager.PathForProtoc(storageDir, "v3.9.0"))
+		used, err = pluginmanager.IsLegacyIncludeUsed(storageDir)
+		Expect(err).To(BeNil())
+		Expect(used).To(BeTrue())
+	})
+	It("should infer release asset names", func() {
+		tests := []struct {
+			version  string
+			expected string
+		}{
+			{version: "v3.17.3", expected: "protoc-3.17.3-linux-x86_64.zip"},
+			{version: "3.17.3", expected: "protoc-3.17.3-linux-x86_64.zip"},
+			{version: "v3.19.0-rc1", expected: "protoc-3.19.0-rc-1-linux-x86_64.zip"},
+			{version: "v21.12", expected: "protoc-21.12-linux-x86_64.zip"},
+			{version: "v22.0-rc3", expected: "protoc-22.0-rc-3-linux-x86_64.zip"},
+			{version: "25.1", expected: "protoc-25.1-linux-x86_64.zip"},
+		}
+		for _, tt := range tests {
+			Expect(pluginmanager.GetProtocReleaseFileName(tt.version, "linux-x86_64")).To(Equal(tt.expected), tt.version)
+		}
+		for tag, expected := range map[string]bool{
+			"v21.12":                true,
+			"v3.17.3":               true,
+			"v22.0-rc3":             false,
+			"v3.0.0-beta-1":         false,
+			"conformance-build-tag": false,
+		} {
+			Expect(pluginmanager.IsProtocReleaseVersion(tag, false)).To(Equal(expected), tag)
+		}
+		Expect(pluginmanager.IsProtocReleaseVersion("v22.0-rc3", true)).To(BeTrue())
+	})
+})
@@ -0,0 +1,336 @@
+// Copyright 2021 storyicon@foxmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pluginmanager
+
+import (
+	"context"
+	"io/fs"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/mholt/archiver"
+	"github.com/pkg/errors"
+
+	"github.com/storyicon/powerproto/pkg/consts"
+	"github.com/storyicon/powerproto/pkg/util"
+	"github.com/storyicon/powerproto/pkg/util/command"
+	"github.com/storyicon/powerproto/pkg/util/logger"
+
+	jsoniter "github.com/json-iterator/go"
+)
+
+// defines the kinds of repository source
+const (
+	// RepositorySourceGit is the git repository, e.g. https://github.com/googleapis/googleapis@<commit>
+	RepositorySourceGit = "git"
+	// RepositorySourceArchive is the archive with sha256 checksum, e.g. https://example.com/protos.tar.gz#sha256=<checksum>
+	RepositorySourceArchive = "archive"
+	// RepositorySourceGoModule is the go module, e.g. gomod:github.com/envoyproxy/protoc-gen-validate@v1.0.2
+	RepositorySourceGoModule = "gomod"
+)
+
+// defines the markers of repository source
+const (
+	archiveChecksumMarker = "#sha256="
+	goModulePrefix        = "gomod:"
+)
+
+var regexpSha256 = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
+// RepositorySource defines where the proto files of repository come from
+type RepositorySource struct {
+	Kind string
+	// URI is the url of git repository or archive, or the path of go module
+	URI string
+	// Version is the commit id or ref of git repository, the version of go module,
+	// or the sha256 checksum of archive
+	Version string
+}
+
+// ParseRepositorySource is used to parse the value of repositories in config
+func ParseRepositorySource(pkg string) (*RepositorySource, error) {
+	if strings.HasPrefix(pkg, goModulePrefix) {
+		path, version, ok := util.SplitGoPackageVersion(strings.TrimPrefix(pkg, goModulePrefix))
+		if !ok || path == "" || version == "" {
+			return nil, errors.Errorf("invalid format: %s, should in %spath@version format", pkg, goModulePrefix)
+		}
+		return &RepositorySource{
+			Kind:    RepositorySourceGoModule,
+			URI:     path,
+			Version: version,
+		}, nil
+	}
+	if i := strings.LastIndex(pkg, archiveChecksumMarker); i != -1 {
+		checksum := strings.ToLower(pkg[i+len(archiveChecksumMarker):])
+		if !regexpSha256.MatchString(checksum) {
+			return nil, errors.Errorf("invalid sha256 checksum of %s", pkg)
+		}
+		return &RepositorySource{
+			Kind:    RepositorySourceArchive,
+			URI:     pkg[:i],
+			Version: checksum,
+		}, nil
+	}
+	path, version, ok := util.SplitGoPackageVersion(pkg)
+	if !ok {
+		return nil, errors.Errorf("invalid format: %s, should in path@version format", pkg)
+	}
+	return &RepositorySource{
+		Kind:    RepositorySourceGit,
+		URI:     path,
+		Version: version,
+	}, nil
+}
+
+// String returns the source in the format of repositories in config
+func (s *RepositorySource) String() string {
+	switch s.Kind {
+	case RepositorySourceGoModule:
+		return goModulePrefix + util.JoinGoPackageVersion(s.URI, s.Version)
+	case RepositorySourceArchive:
+		return s.URI + archiveChecksumMarker + s.Version
+	}
+	return util.JoinGoPackageVersion(s.URI, s.Version)
+}
+
+// defines the kinds of plugin source
+const (
+	// PluginSourceGo is the go package installed by go install, e.g. google.golang.org/protobuf/cmd/protoc-gen-go@v1.27.1
+	PluginSourceGo = "go"
+	// PluginSourcePath is the prebuilt local binary, e.g. path:./bin/protoc-gen-foo
+	PluginSourcePath = "path"
+	// PluginSourceLocal is the go main package in local module, e.g. local:./tools/protoc-gen-foo
+	PluginSourceLocal = "local"
+	// PluginSourceRelease is the prebuilt binary downloaded from release url,
+	// e.g. release:github.com/grpc/grpc-web/protoc-gen-grpc-web@1.4.2
+	PluginSourceRelease = "release"
+)
+
+// PluginSource defines where the plugin comes from
+type PluginSource struct {
+	Kind string
+	// Path is the go package path, or the local path relative to the config file
+	Path string
+	// Version is the version of go package, it is empty for local plugins
+	Version string
+}
+
+// ParsePluginSource is used to parse the value of plugins in config
+func ParsePluginSource(pkg string) (*PluginSource, error) {
+	for _, kind := range []string{PluginSourcePath, PluginSourceLocal} {
+		if strings.HasPrefix(pkg, kind+":") {
+			path := strings.TrimPrefix(pkg, kind+":")
+			if path == "" {
+				return nil, errors.Errorf("invalid format: %s, the path is empty", pkg)
+			}
+			return &PluginSource{
+				Kind: kind,
+				Path: path,
+			}, nil
+		}
+	}
+	kind := PluginSourceGo
+	if strings.HasPrefix(pkg, PluginSourceRelease+":") {
+		kind = PluginSourceRelease
+	}
+	path, version, ok := util.SplitGoPackageVersion(strings.TrimPrefix(pkg, PluginSourceRelease+":"))
+	if !ok {
+		return nil, errors.Errorf("invalid format: %s, should in path@version format", pkg)
+	}
+	return &PluginSource{
+		Kind:    kind,
+		Path:    path,
+		Version: version,
+	}, nil
+}
+
+// String returns the source in the format of plugins in config
+func (s *PluginSource) String() string {
+	switch s.Kind {
+	case PluginSourceGo:
+		return util.JoinGoPackageVersion(s.Path, s.Version)
+	case PluginSourceRelease:
+		return s.Kind + ":" + util.JoinGoPackageVersion(s.Path, s.Version)
+	}
+	return s.Kind + ":" + s.Path
+}
+
+// defines the kinds of protoc source
+const (
+	// ProtocSourceRelease is the protoc release installed by PowerProto, e.g. 3.17.3
+	ProtocSourceRelease = "release"
+	// ProtocSourceSystem is the protoc found in PATH, e.g. system or system@3.21.12
+	ProtocSourceSystem = "system"
+	// ProtocSourcePath is the protoc at the path, e.g. path:/opt/protoc/bin/protoc@3.21.12
+	ProtocSourcePath = "path"
+)
+
+// ProtocSource defines where the protoc comes from
+type ProtocSource struct {
+	Kind string
+	// Path is the path of protoc binary, it is only used by ProtocSourcePath
+	Path string
+	// Version is the version of protoc, it is optional for the protoc not installed by PowerProto,
+	// and is verified by protoc --version when it is declared
+	Version string
+}
+
+// ParseProtocSource is used to parse the value of protoc in config
+func ParseProtocSource(protoc string) (*ProtocSource, error) {
+	switch {
+	case protoc == ProtocSourceSystem || strings.HasPrefix(protoc, ProtocSourceSystem+"@"):
+		return &ProtocSource{
+			Kind:    ProtocSourceSystem,
+			Version: strings.TrimPrefix(strings.TrimPrefix(protoc, ProtocSourceSystem), "@"),
+		}, nil
+	case strings.HasPrefix(protoc, ProtocSourcePath+":"):
+		source := &ProtocSource{
+			Kind: ProtocSourcePath,
+			Path: strings.TrimPrefix(protoc, ProtocSourcePath+":"),
+		}
+		if i := strings.LastIndex(source.Path, "@"); i != -1 {
+			source.Path, source.Version = source.Path[:i], source.Path[i+1:]
+		}
+		if source.Path == "" {
+			return nil, errors.Errorf("invalid format: %s, the path is empty", protoc)
+		}
+		return source, nil
+	case protoc == "":
+		return nil, errors.New("protoc version is required")
+	}
+	return &ProtocSource{
+		Kind:    ProtocSourceRelease,
+		Version: protoc,
+	}, nil
+}
+
+// GetArchiveRepo is used to download the archive, verify its sha256 checksum and unarchive it.
+// The single top-level directory of archive is used as the local dir
+func GetArchiveRepo(ctx context.Context, uri string, checksum string) (*Archive, error) {
+	workspace, err := os.MkdirTemp("", "")
+	if err != nil {
+		return nil, err
+	}
+	dir, err := downloadArchive(ctx, uri, checksum, workspace)
+	if err != nil {
+		os.RemoveAll(workspace)
+		return nil, err
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		os.RemoveAll(workspace)
+		return nil, err
+	}
+	if len(entries) == 1 && entries[0].IsDir() {
+		dir = filepath.Join(dir, entries[0].Name())
+	}
+	return &Archive{
+		uri:       uri,
+		commit:    checksum,
+		workspace: workspace,
+		dir:       dir,
+	}, nil
+}
+
+// downloadVerified is used to download the file into the workspace and verify its sha256 checksum,
+// the file is named by the url so that the archive format can be detected by its extension
+func downloadVerified(ctx context.Context, uri string, checksum string, workspace string) (string, error) {
+	parsed, err := url.Parse(uri)
+	if err != nil {
+		return "", err
+	}
+	filename := filepath.Join(workspace, path.Base(parsed.Path))
+	if err := downloadURL(ctx, uri, filename); err != nil {
+		return "", err
+	}
+	actual, err := hashFile(filename)
+	if err != nil {
+		return "", err
+	}
+	if actual != strings.ToLower(checksum) {
+		return "", &ErrChecksumMismatch{
+			Path:     uri,
+			Expected: checksum,
+			Actual:   actual,
+		}
+	}
+	return filename, nil
+}
+
+// downloadArchive is used to download the archive into the workspace,
+// verify its sha256 checksum and unarchive it into the returned directory
+func downloadArchive(ctx context.Context, uri string, checksum string, workspace string) (string, error) {
+	filename, err := downloadVerified(ctx, uri, checksum, workspace)
+	if err != nil {
+		return "", err
+	}
+	dir := filepath.Join(workspace, "code")
+	if err := os.MkdirAll(dir, fs.ModePerm); err != nil {
+		return "", err
+	}
+	if err := archiver.Unarchive(filename, dir); err != nil {
+		return "", errors.Wrapf(err, "failed to unarchive %s", uri)
+	}
+	return dir, nil
+}
+
+// GoModule defines the model of go mod download data
+type GoModule struct {
+	Path    string // module path
+	Version string // module version
+	Error   string // error loading module
+	Dir     string // absolute path to cached source root directory
+	Sum     string // checksum for path, version (as in go.sum)
+}
+
+// DownloadGoModule is used to download the go module into the local module cache by go mod download,
+// the version can be latest or a query supported by go. In offline mode, only the module cache is used
+func DownloadGoModule(ctx context.Context, log logger.Logger, path string, version string) (*GoModule, error) {
+	env := []string{"GO111MODULE=on"}
+	if consts.IsOffline(ctx) {
+		env = append(env, "GOPROXY=off")
+	}
+	pkg := util.JoinGoPackageVersion(path, version)
+	// the directory in module cache is required to compile, so it is downloaded even in dry run mode,
+	// and it is executed out of the current module to avoid touching its go.sum
+	data, err := command.Execute(consts.WithIgnoreDryRun(ctx), log, os.TempDir(), "go", []string{
+		"mod", "download", "-json", pkg,
+	}, env)
+	if err != nil {
+		execErr := err.(*command.ErrCommandExec)
+		// the reason is reported in the json output
+		data = []byte(execErr.Stdout)
+		if len(data) == 0 {
+			return nil, &ErrGoModDownload{
+				ErrCommandExec: execErr,
+			}
+		}
+	}
+	var module GoModule
+	if err := jsoniter.Unmarshal(data, &module); err != nil {
+		return nil, err
+	}
+	if module.Error != "" {
+		return nil, errors.Errorf("failed to download %s: %s", pkg, module.Error)
+	}
+	if module.Dir == "" {
+		return nil, errors.Errorf("failed to download %s: no directory is returned", pkg)
+	}
+	return &module, nil
+}
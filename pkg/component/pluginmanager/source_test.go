@@ -0,0 +1,296 @@
+// Copyright 2021 storyicon@foxmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pluginmanager_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/storyicon/powerproto/pkg/component/pluginmanager"
+	"github.com/storyicon/powerproto/pkg/configs"
+	"github.com/storyicon/powerproto/pkg/consts"
+	"github.com/storyicon/powerproto/pkg/util"
+	"github.com/storyicon/powerproto/pkg/util/logger"
+)
+
+func newTarGz(files ...string) []byte {
+	buf := &bytes.Buffer{}
+	gw := gzip.NewWriter(buf)
+	tw := tar.NewWriter(gw)
+	for _, file := range files {
+		Expect(tw.WriteHeader(&tar.Header{
+			Name:     file,
+			Mode:     0644,
+			Size:     int64(len(file)),
+			Typeflag: tar.TypeReg,
+		})).To(BeNil())
+		_, err := tw.Write([]byte(file))
+		Expect(err).To(BeNil())
+	}
+	Expect(tw.Close()).To(BeNil())
+	Expect(gw.Close()).To(BeNil())
+	return buf.Bytes()
+}
+
+var _ = Describe("Source", func() {
+	const checksum = "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08"
+	It("should able to parse repository source", func() {
+		for pkg, expected := range map[string]*pluginmanager.RepositorySource{
+			"https://github.com/googleapis/googleapis@75e9812478607db997376ccea247dd6928f70f45": {
+				Kind:    pluginmanager.RepositorySourceGit,
+				URI:     "https://github.com/googleapis/googleapis",
+				Version: "75e9812478607db997376ccea247dd6928f70f45",
+			},
+			"https://example.com/protos-1.0.tar.gz#sha256=" + strings.ToUpper(checksum): {
+				Kind:    pluginmanager.RepositorySourceArchive,
+				URI:     "https://example.com/protos-1.0.tar.gz",
+				Version: checksum,
+			},
+			"gomod:github.com/envoyproxy/protoc-gen-validate@v1.0.2": {
+				Kind:    pluginmanager.RepositorySourceGoModule,
+				URI:     "github.com/envoyproxy/protoc-gen-validate",
+				Version: "v1.0.2",
+			},
+		} {
+			source, err := pluginmanager.ParseRepositorySource(pkg)
+			Expect(err).To(BeNil())
+			Expect(source).To(Equal(expected))
+			Expect(strings.EqualFold(source.String(), pkg)).To(BeTrue())
+		}
+		for _, pkg := range []string{
+			"https://github.com/googleapis/googleapis",
+			"https://example.com/protos.tar.gz#sha256=abc",
+			"gomod:github.com/envoyproxy/protoc-gen-validate",
+		} {
+			_, err := pluginmanager.ParseRepositorySource(pkg)
+			Expect(err).NotTo(BeNil(), pkg)
+		}
+	})
+	It("should able to parse plugin source", func() {
+		for pkg, expected := range map[string]*pluginmanager.PluginSource{
+			"google.golang.org/protobuf/cmd/protoc-gen-go@v1.27.1": {
+				Kind:    pluginmanager.PluginSourceGo,
+				Path:    "google.golang.org/protobuf/cmd/protoc-gen-go",
+				Version: "v1.27.1",
+			},
+			"release:github.com/grpc/grpc-web/protoc-gen-grpc-web@1.4.2": {
+				Kind:    pluginmanager.PluginSourceRelease,
+				Path:    "github.com/grpc/grpc-web/protoc-gen-grpc-web",
+				Version: "1.4.2",
+			},
+			"path:./bin/protoc-gen-foo": {
+				Kind: pluginmanager.PluginSourcePath,
+				Path: "./bin/protoc-gen-foo",
+			},
+			"local:./tools/protoc-gen-foo": {
+				Kind: pluginmanager.PluginSourceLocal,
+				Path: "./tools/protoc-gen-foo",
+			},
+		} {
+			source, err := pluginmanager.ParsePluginSource(pkg)
+			Expect(err).To(BeNil())
+			Expect(source).To(Equal(expected))
+			Expect(source.String()).To(Equal(pkg))
+		}
+		for _, pkg := range []string{"google.golang.org/protobuf/cmd/protoc-gen-go", "local:"} {
+			_, err := pluginmanager.ParsePluginSource(pkg)
+			Expect(err).NotTo(BeNil(), pkg)
+		}
+	})
+	It("should able to parse protoc source", func() {
+		for protoc, expected := range map[string]*pluginmanager.ProtocSource{
+			"3.17.3":         {Kind: pluginmanager.ProtocSourceRelease, Version: "3.17.3"},
+			"system":         {Kind: pluginmanager.ProtocSourceSystem},
+			"system@3.21.12": {Kind: pluginmanager.ProtocSourceSystem, Version: "3.21.12"},
+			"path:/opt/protoc/bin/protoc": {
+				Kind: pluginmanager.ProtocSourcePath,
+				Path: "/opt/protoc/bin/protoc",
+			},
+			"path:./bin/protoc@21.12": {
+				Kind:    pluginmanager.ProtocSourcePath,
+				Path:    "./bin/protoc",
+				Version: "21.12",
+			},
+		} {
+			source, err := pluginmanager.ParseProtocSource(protoc)
+			Expect(err).To(BeNil())
+			Expect(source).To(Equal(expected), protoc)
+		}
+		for _, protoc := range []string{"", "path:", "path:@3.17.3"} {
+			_, err := pluginmanager.ParseProtocSource(protoc)
+			Expect(err).NotTo(BeNil(), protoc)
+		}
+	})
+	It("should find local protoc and verify its version", func() {
+		if runtime.GOOS == "windows" {
+			Skip("the fake protoc is a shell script")
+		}
+		root, err := ioutil.TempDir("", "powerproto-protoc")
+		Expect(err).To(BeNil())
+		defer os.RemoveAll(root)
+		binary := filepath.Join(root, "bin", "protoc")
+		Expect(os.MkdirAll(filepath.Dir(binary), 0755)).To(BeNil())
+		Expect(ioutil.WriteFile(binary, []byte("#!/bin/sh\necho libprotoc 3.21.12\n"), 0755)).To(BeNil())
+		touchFile(filepath.Join(root, "include", "google", "protobuf", "empty.proto"))
+
+		log := logger.NewDefault("protoc")
+		for _, version := range []string{"", "3.21.12", "v21.12"} {
+			protoc, err := pluginmanager.FindLocalProtoc(context.TODO(), log, binary, version, "")
+			Expect(err).To(BeNil(), version)
+			Expect(protoc.Binary).To(Equal(binary))
+			Expect(protoc.Version).To(Equal("3.21.12"))
+			Expect(protoc.IncludeDir).To(Equal(filepath.Join(root, "include")))
+		}
+		_, err = pluginmanager.FindLocalProtoc(context.TODO(), log, binary, "3.17.3", "")
+		Expect(err).NotTo(BeNil())
+		protoc, err := pluginmanager.FindLocalProtoc(context.TODO(), log, binary, "", filepath.Join(root, "missing"))
+		Expect(err).To(BeNil())
+		Expect(protoc.IncludeDir).To(BeEmpty())
+		_, err = pluginmanager.FindLocalProtoc(context.TODO(), log, filepath.Join(root, "protoc"), "", "")
+		Expect(err).NotTo(BeNil())
+	})
+	It("should install prebuilt plugin from release", func() {
+		archive := newTarGz("protoc-gen-foo-1.0.0/bin/protoc-gen-foo")
+		binary := []byte("#!/bin/sh\n")
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.URL.Path {
+			case "/v1.0.0/protoc-gen-foo-linux-x86_64.tar.gz":
+				w.Write(archive)
+			case "/v1.0.0/protoc-gen-bar":
+				w.Write(binary)
+			default:
+				http.NotFound(w, r)
+			}
+		}))
+		defer server.Close()
+		storageDir, err := ioutil.TempDir("", "powerproto-source")
+		Expect(err).To(BeNil())
+		defer os.RemoveAll(storageDir)
+		hash := func(data []byte) string {
+			sum := sha256.Sum256(data)
+			return hex.EncodeToString(sum[:])
+		}
+
+		release := &configs.PluginRelease{
+			URLs: map[string]string{
+				"linux/amd64": server.URL + "/v$VERSION/protoc-gen-foo-$OS-x86_64.tar.gz",
+			},
+			Binary: "protoc-gen-foo-$VERSION/bin/protoc-gen-foo",
+			Sha256: map[string]string{
+				"linux/amd64": hash(archive),
+			},
+		}
+		_, err = pluginmanager.GetPluginAsset(release, "1.0.0", "darwin/arm64")
+		Expect(err).NotTo(BeNil())
+		asset, err := pluginmanager.GetPluginAsset(release, "1.0.0", "linux/amd64")
+		Expect(err).To(BeNil())
+		Expect(asset.URL).To(Equal(server.URL + "/v1.0.0/protoc-gen-foo-linux-x86_64.tar.gz"))
+		Expect(asset.Binary).To(Equal("protoc-gen-foo-1.0.0/bin/protoc-gen-foo"))
+		const fooPath = "github.com/example/foo/protoc-gen-foo"
+		local, err := pluginmanager.InstallPluginFromRelease(context.TODO(), storageDir, fooPath, "1.0.0", asset)
+		Expect(err).To(BeNil())
+		expected, err := pluginmanager.PathForPlugin(storageDir, fooPath, "1.0.0")
+		Expect(err).To(BeNil())
+		Expect(local).To(Equal(expected))
+		recorded, err := pluginmanager.VerifyChecksum(local)
+		Expect(err).To(BeNil())
+		Expect(recorded).To(BeTrue())
+
+		const barPath = "github.com/example/bar/protoc-gen-bar"
+		_, err = pluginmanager.InstallPluginFromRelease(context.TODO(), storageDir, barPath, "1.0.0", &pluginmanager.PluginAsset{
+			URL:    server.URL + "/v1.0.0/protoc-gen-bar",
+			Sha256: hash(archive),
+		})
+		var mismatch *pluginmanager.ErrChecksumMismatch
+		Expect(errors.As(err, &mismatch)).To(BeTrue())
+		local, err = pluginmanager.InstallPluginFromRelease(context.TODO(), storageDir, barPath, "1.0.0", &pluginmanager.PluginAsset{
+			URL:    server.URL + "/v1.0.0/protoc-gen-bar",
+			Sha256: hash(binary),
+		})
+		Expect(err).To(BeNil())
+		data, err := ioutil.ReadFile(local)
+		Expect(err).To(BeNil())
+		Expect(data).To(Equal(binary))
+	})
+	It("should install archive with verified checksum", func() {
+		data := newTarGz("protos-1.0/validate/validate.proto", "protos-1.0/README.md")
+		sum := sha256.Sum256(data)
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write(data)
+		}))
+		defer server.Close()
+		storageDir, err := ioutil.TempDir("", "powerproto-source")
+		Expect(err).To(BeNil())
+		defer os.RemoveAll(storageDir)
+
+		cfg := pluginmanager.NewConfig()
+		cfg.StorageDir = storageDir
+		manager, err := pluginmanager.NewBasicPluginManager(cfg, logger.NewDefault("source"))
+		Expect(err).To(BeNil())
+		uri := server.URL + "/releases/protos-1.0.tar.gz"
+		include := []string{"**/*.proto"}
+		local, err := manager.InstallArchiveRepo(context.TODO(), uri, hex.EncodeToString(sum[:]), include)
+		Expect(err).To(BeNil())
+		exists, err := util.IsFileExists(filepath.Join(local, "validate", "validate.proto"))
+		Expect(err).To(BeNil())
+		Expect(exists).To(BeTrue())
+		exists, err = util.IsFileExists(filepath.Join(local, "README.md"))
+		Expect(err).To(BeNil())
+		Expect(exists).To(BeFalse())
+		installed, _, err := manager.IsArchiveRepoInstalled(context.TODO(), uri, hex.EncodeToString(sum[:]), include)
+		Expect(err).To(BeNil())
+		Expect(installed).To(BeTrue())
+
+		entries, err := pluginmanager.ListCacheEntries(storageDir)
+		Expect(err).To(BeNil())
+		Expect(entries).To(HaveLen(1))
+		Expect(entries[0].Kind).To(Equal(pluginmanager.CacheKindArchive))
+		Expect(entries[0].Version).To(Equal(hex.EncodeToString(sum[:])))
+
+		_, err = manager.InstallArchiveRepo(context.TODO(), uri, checksum, nil)
+		var mismatch *pluginmanager.ErrChecksumMismatch
+		Expect(errors.As(err, &mismatch)).To(BeTrue())
+		installed, _, err = manager.IsArchiveRepoInstalled(context.TODO(), uri, checksum, nil)
+		Expect(err).To(BeNil())
+		Expect(installed).To(BeFalse())
+	})
+	It("should resolve go module from the module cache in offline mode", func() {
+		ctx := consts.WithOffline(context.TODO())
+		module, err := pluginmanager.DownloadGoModule(ctx, logger.NewDefault("source"), "github.com/pkg/errors", "v0.9.1")
+		Expect(err).To(BeNil())
+		Expect(module.Version).To(Equal("v0.9.1"))
+		exists, err := util.IsFileExists(filepath.Join(module.Dir, "errors.go"))
+		Expect(err).To(BeNil())
+		Expect(exists).To(BeTrue())
+
+		_, err = pluginmanager.DownloadGoModule(ctx, logger.NewDefault("source"), "example.com/not/cached", "v1.0.0")
+		Expect(err).NotTo(BeNil())
+	})
+})
@@ -16,10 +16,14 @@ package configs
 
 import (
 	"bytes"
+	"io"
 	"io/fs"
 	"io/ioutil"
+	"os"
 	"path/filepath"
+	"strings"
 
+	"github.com/pkg/errors"
 	"gopkg.in/yaml.v3"
 
 	"github.com/storyicon/powerproto/pkg/consts"
@@ -37,6 +41,43 @@ type Config struct {
 	ImportPaths   []string          `json:"importPaths" yaml:"importPaths"`
 	PostActions   []*PostAction     `json:"postActions" yaml:"postActions"`
 	PostShell     string            `json:"postShell" yaml:"postShell"`
+	Breaking      *BreakingConfig   `json:"breaking,omitempty" yaml:"breaking,omitempty"`
+	Lint          *LintConfig       `json:"lint,omitempty" yaml:"lint,omitempty"`
+
+	// ProtocInclude is the include dir of protoc that is not installed by PowerProto,
+	// e.g. protoc: system, it defaults to the include directory next to the bin directory of protoc
+	ProtocInclude string `json:"protocInclude,omitempty" yaml:"protocInclude,omitempty"`
+
+	// RepositoryConfigs is used to configure how the repositories are stored and referenced, keyed by name
+	RepositoryConfigs map[string]*RepositoryConfig `json:"repositoryConfigs,omitempty" yaml:"repositoryConfigs,omitempty"`
+
+	// PluginReleases is used to configure how the prebuilt plugins are downloaded, keyed by name in plugins
+	PluginReleases map[string]*PluginRelease `json:"pluginReleases,omitempty" yaml:"pluginReleases,omitempty"`
+
+	// Replace maps the repository url or plugin module path to a local directory,
+	// which is used instead of the version in repositories or plugins
+	Replace map[string]string `json:"replace,omitempty" yaml:"replace,omitempty"`
+
+	// RepositoryRefs is the branch, tag or version constraint tracked by the repositories resolved to commits
+	// or versions, e.g. branch:master and ^1.2, it is stored as the line comment of repositories in config file
+	RepositoryRefs map[string]string `json:"-" yaml:"-"`
+
+	// ProtocConstraint is the version constraint that protoc is resolved from, e.g. ~3.17,
+	// it is stored as the line comment of protoc in config file
+	ProtocConstraint string `json:"-" yaml:"-"`
+
+	// PluginConstraints is the version constraints that the plugins are resolved from, keyed by name,
+	// they are stored as the line comments of plugins in config file
+	PluginConstraints map[string]string `json:"-" yaml:"-"`
+
+	// overrides is the replace directives in the override config file,
+	// it takes precedence over Replace and is never saved into the config file
+	overrides map[string]string
+}
+
+// OverrideConfig defines the model of override config file
+type OverrideConfig struct {
+	Replace map[string]string `json:"replace" yaml:"replace"`
 }
 
 // PostAction defines the Action model
@@ -45,11 +86,109 @@ type PostAction struct {
 	Args []string `json:"args" yaml:"args"`
 }
 
+// RepositoryConfig defines how the repository is stored and referenced
+type RepositoryConfig struct {
+	// Root is the directory of proto files relative to the repository, e.g. '.' for the repository itself,
+	// when it is specified, the variable of repository points to the root
+	// instead of the directory containing the repository
+	Root string `json:"root,omitempty" yaml:"root,omitempty"`
+	// Include is the doublestar glob patterns of files relative to the repository
+	// that are kept in cache, e.g. **/*.proto. All files are kept when it is empty
+	Include []string `json:"include,omitempty" yaml:"include,omitempty"`
+}
+
+// PluginRelease defines how the prebuilt plugin is downloaded for each platform.
+// $VERSION, $OS and $ARCH in the templates are replaced with the version of plugin and the platform
+type PluginRelease struct {
+	// URLs is the url templates of release asset keyed by platform, e.g. linux/amd64
+	URLs map[string]string `json:"urls" yaml:"urls"`
+	// Binary is the path template of binary in the archive,
+	// the downloaded file is used as the binary when it is empty
+	Binary string `json:"binary,omitempty" yaml:"binary,omitempty"`
+	// Sha256 is the sha256 checksum of release asset keyed by platform
+	Sha256 map[string]string `json:"sha256" yaml:"sha256"`
+}
+
+// GetPluginRelease is used to get the release config of plugin,
+// nil is returned if it is not specified
+func (c *Config) GetPluginRelease(name string) *PluginRelease {
+	return c.PluginReleases[name]
+}
+
+// GetRepositoryConfig is used to get the config of repository,
+// nil is returned if it is not specified
+func (c *Config) GetRepositoryConfig(name string) *RepositoryConfig {
+	return c.RepositoryConfigs[name]
+}
+
+// GetRepositoryInclude is used to get the include patterns of repository
+func (c *Config) GetRepositoryInclude(name string) []string {
+	if cfg := c.GetRepositoryConfig(name); cfg != nil {
+		return cfg.Include
+	}
+	return nil
+}
+
+// BreakingConfig defines the rules of breaking change detection
+type BreakingConfig struct {
+	// Categories is used to select the rule categories, e.g. WIRE, SOURCE
+	// All categories are used when it is empty
+	Categories []string `json:"categories,omitempty" yaml:"categories,omitempty"`
+	// Except is used to disable the specified rules
+	Except []string `json:"except,omitempty" yaml:"except,omitempty"`
+}
+
+// LintConfig defines the rules of lint
+type LintConfig struct {
+	// Use is used to select the rules, all rules are used when it is empty
+	Use []string `json:"use,omitempty" yaml:"use,omitempty"`
+	// Except is used to disable the specified rules
+	Except []string `json:"except,omitempty" yaml:"except,omitempty"`
+}
+
+// GetReplace is used to get the local directory that replaces the repository url or plugin module path.
+// The plugin path is matched by its module path, and rel is the package path relative to the module
+func (c *Config) GetReplace(path string) (dir string, rel string, ok bool) {
+	for _, replace := range []map[string]string{c.overrides, c.Replace} {
+		var matched string
+		for key, value := range replace {
+			key = strings.TrimSuffix(key, "/")
+			if key != path && !strings.HasPrefix(path, key+"/") {
+				continue
+			}
+			if len(key) > len(matched) {
+				matched, dir = key, value
+			}
+		}
+		if matched != "" {
+			return dir, "." + strings.TrimPrefix(path, matched), true
+		}
+	}
+	return "", "", false
+}
+
 // SaveConfigs is used to save configs into files
 func SaveConfigs(path string, configs ...*Config) error {
 	parts := make([][]byte, 0, len(configs))
 	for _, config := range configs {
-		data, err := yaml.Marshal(config)
+		var node yaml.Node
+		if err := node.Encode(config); err != nil {
+			return err
+		}
+		if value := getValueNode(&node, "protoc"); value != nil && config.ProtocConstraint != "" {
+			value.LineComment = config.ProtocConstraint
+		}
+		for name, value := range getMappingNodes(&node, "plugins") {
+			if constraint, ok := config.PluginConstraints[name]; ok {
+				value.LineComment = constraint
+			}
+		}
+		for name, value := range getMappingNodes(&node, "repositories") {
+			if ref, ok := config.RepositoryRefs[name]; ok {
+				value.LineComment = ref
+			}
+		}
+		data, err := yaml.Marshal(&node)
 		if err != nil {
 			return err
 		}
@@ -68,30 +207,139 @@ func LoadConfigs(path string) ([]*Config, error) {
 	if err != nil {
 		return nil, err
 	}
-	items, err := util.SplitYAML(raw)
-	if err != nil {
-		return nil, err
-	}
+	// the documents are decoded as nodes to keep the comments
+	decoder := yaml.NewDecoder(bytes.NewReader(raw))
 	var ret []*Config
-	for _, item := range items {
+	for {
+		var node yaml.Node
+		err := decoder.Decode(&node)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
 		var config Config
-		if err := yaml.Unmarshal(item, &config); err != nil {
+		if err := node.Decode(&config); err != nil {
 			return nil, err
 		}
+		if value := getValueNode(&node, "protoc"); value != nil {
+			if constraint := getLineComment(value); util.IsVersionConstraint(constraint) {
+				config.ProtocConstraint = constraint
+			}
+		}
+		for name, value := range getMappingNodes(&node, "plugins") {
+			if constraint := getLineComment(value); util.IsVersionConstraint(constraint) {
+				if config.PluginConstraints == nil {
+					config.PluginConstraints = map[string]string{}
+				}
+				config.PluginConstraints[name] = constraint
+			}
+		}
+		for name, value := range getMappingNodes(&node, "repositories") {
+			ref := getLineComment(value)
+			if strings.HasPrefix(ref, RepositoryRefBranchPrefix) || strings.HasPrefix(ref, RepositoryRefTagPrefix) ||
+				util.IsVersionConstraint(ref) {
+				if config.RepositoryRefs == nil {
+					config.RepositoryRefs = map[string]string{}
+				}
+				config.RepositoryRefs[name] = ref
+			}
+		}
 		ret = append(ret, &config)
 	}
 	return ret, nil
 }
 
+// getLineComment is used to get the line comment of node without the leading #
+func getLineComment(node *yaml.Node) string {
+	return strings.TrimSpace(strings.TrimPrefix(node.LineComment, "#"))
+}
+
+// getValueNode is used to get the value node of the key in the top-level mapping,
+// nil is returned if the key does not exist
+func getValueNode(node *yaml.Node, key string) *yaml.Node {
+	if node.Kind == yaml.DocumentNode && len(node.Content) != 0 {
+		node = node.Content[0]
+	}
+	if node.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// getMappingNodes is used to get the value nodes of the mapping of the key keyed by name, e.g. repositories
+func getMappingNodes(node *yaml.Node, key string) map[string]*yaml.Node {
+	nodes := map[string]*yaml.Node{}
+	mapping := getValueNode(node, key)
+	if mapping == nil || mapping.Kind != yaml.MappingNode {
+		return nodes
+	}
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		nodes[mapping.Content[i].Value] = mapping.Content[i+1]
+	}
+	return nodes
+}
+
 // LoadConfigItems is similar to LoadConfigs, but obtains the abstraction of the Config prototype structure
 func LoadConfigItems(path string) ([]ConfigItem, error) {
 	data, err := LoadConfigs(path)
 	if err != nil {
 		return nil, err
 	}
+	override, err := LoadOverrideConfig(filepath.Join(filepath.Dir(path), consts.OverrideConfigFileName))
+	if err != nil {
+		return nil, err
+	}
+	if override != nil {
+		for _, config := range data {
+			config.overrides = override.Replace
+		}
+	}
 	return GetConfigItems(data, path), nil
 }
 
+// LoadOverrideConfig is used to load the override config file, nil is returned if it does not exist
+func LoadOverrideConfig(path string) (*OverrideConfig, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var override OverrideConfig
+	if err := yaml.Unmarshal(data, &override); err != nil {
+		return nil, errors.Wrapf(err, "failed to parse %s", path)
+	}
+	return &override, nil
+}
+
+// GetReplaceDir is used to get the absolute local directory that replaces the repository url
+// or plugin module path in config item, the relative directory is relative to the config file
+func GetReplaceDir(item ConfigItem, path string) (dir string, rel string, ok bool) {
+	dir, rel, ok = item.Config().GetReplace(path)
+	if !ok {
+		return "", "", false
+	}
+	return ResolvePath(item, dir), rel, true
+}
+
+// ResolvePath is used to render the environment variables in path,
+// and resolve it relative to the directory of config file
+func ResolvePath(item ConfigItem, path string) string {
+	path = util.RenderPathWithEnv(path, nil)
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(filepath.Dir(item.Path()), path)
+	}
+	return path
+}
+
 // ListConfigPaths is used to list all possible config paths
 func ListConfigPaths(sourceDir string) []string {
 	var paths []string
@@ -24,6 +24,8 @@ type ConfigItem interface {
 	ID() string
 	// Path is used to return the config path
 	Path() string
+	// Index is used to return the index of config in the file
+	Index() int
 	// Config is used to return the Config
 	Config() *Config
 }
@@ -38,9 +40,10 @@ func GetConfigItems(data []*Config, path string) []ConfigItem {
 }
 
 type configItem struct {
-	id   string
-	c    *Config
-	path string
+	id    string
+	c     *Config
+	path  string
+	index int
 }
 
 // ID is used to return to config unique id
@@ -53,6 +56,11 @@ func (c *configItem) Path() string {
 	return c.path
 }
 
+// Index is used to return the index of config in the file
+func (c *configItem) Index() int {
+	return c.index
+}
+
 // Config is used to return the Config
 func (c *configItem) Config() *Config {
 	return c.c
@@ -60,8 +68,9 @@ func (c *configItem) Config() *Config {
 
 func newConfigItem(c *Config, path string, idx int) ConfigItem {
 	return &configItem{
-		id:   fmt.Sprintf("%s:%d", path, idx),
-		c:    c,
-		path: path,
+		id:    fmt.Sprintf("%s:%d", path, idx),
+		c:     c,
+		path:  path,
+		index: idx,
 	}
 }
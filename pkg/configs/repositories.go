@@ -0,0 +1,102 @@
+// Copyright 2021 storyicon@foxmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package configs
+
+import (
+	"fmt"
+	"strings"
+)
+
+// defines the prefixes of the branch or tag in the version of repository,
+// e.g. https://github.com/googleapis/googleapis@branch:master
+const (
+	RepositoryRefBranchPrefix = "branch:"
+	RepositoryRefTagPrefix    = "tag:"
+)
+
+// Repository defines the well known repository
+type Repository struct {
+	OptionsValue string
+
+	Name        string
+	Pkg         string
+	ImportPaths []string
+	// Provides is the prefixes of the import paths of proto files in the repository
+	Provides []string
+}
+
+// OptionsValue is used to return the options value
+func (repo *Repository) GetOptionsValue() string {
+	if repo.OptionsValue != "" {
+		return repo.OptionsValue
+	}
+	return fmt.Sprintf("%s: %s", strings.ToLower(repo.Name), repo.Pkg)
+}
+
+// GetWellKnownRepositories is used to get well known repositories
+func GetWellKnownRepositories() []*Repository {
+	return []*Repository{
+		GetRepositoryGoogleAPIs(),
+		GetRepositoryGoGoProtobuf(),
+	}
+}
+
+// GetRepositoryGoGoProtobuf is used to get gogo protobuf repository
+func GetRepositoryGoGoProtobuf() *Repository {
+	return &Repository{
+		Name: "GOGO_PROTOBUF",
+		Pkg:  "https://github.com/gogo/protobuf@226206f39bd7276e88ec684ea0028c18ec2c91ae",
+		ImportPaths: []string{
+			"$GOGO_PROTOBUF",
+		},
+		Provides: []string{
+			"github.com/gogo/protobuf/",
+		},
+	}
+}
+
+// GetRepositoryGoogleAPIs is used to get google apis repository
+func GetRepositoryGoogleAPIs() *Repository {
+	return &Repository{
+		Name: "GOOGLE_APIS",
+		Pkg:  "https://github.com/googleapis/googleapis@75e9812478607db997376ccea247dd6928f70f45",
+		ImportPaths: []string{
+			"$GOOGLE_APIS/github.com/googleapis/googleapis",
+		},
+		Provides: []string{
+			"google/api/",
+			"google/cloud/",
+			"google/geo/",
+			"google/iam/",
+			"google/logging/",
+			"google/longrunning/",
+			"google/rpc/",
+			"google/type/",
+		},
+	}
+}
+
+// GetWellKnownRepositoryByImport is used to get the well known repository
+// which provides the proto file of specified import path
+func GetWellKnownRepositoryByImport(path string) (*Repository, bool) {
+	for _, repo := range GetWellKnownRepositories() {
+		for _, prefix := range repo.Provides {
+			if strings.HasPrefix(path, prefix) {
+				return repo, true
+			}
+		}
+	}
+	return nil, false
+}
@@ -0,0 +1,86 @@
+// Copyright 2021 storyicon@foxmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package configs
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+
+	"github.com/storyicon/powerproto/pkg/consts"
+)
+
+// Settings defines the user settings, which is stored in the program directory of PowerProto
+type Settings struct {
+	Mirrors *MirrorSettings `json:"mirrors,omitempty" yaml:"mirrors,omitempty"`
+}
+
+// MirrorSettings defines the ordered url templates used to download files,
+// the next one is tried when the download fails
+type MirrorSettings struct {
+	// Protoc is the url templates of protoc releases,
+	// $VERSION and $FILENAME can be used in them
+	Protoc []string `json:"protoc,omitempty" yaml:"protoc,omitempty"`
+	// Archive is the url templates of repository archives,
+	// $URI, $HOST, $REPO_PATH, $REPO_NAME, $COMMIT, $FILENAME and $ARCHIVE_URL can be used in them
+	Archive []string `json:"archive,omitempty" yaml:"archive,omitempty"`
+	// Hosts is the archive url templates keyed by git host, which are merged
+	// with the built-in ones and used to render $ARCHIVE_URL
+	Hosts map[string]string `json:"hosts,omitempty" yaml:"hosts,omitempty"`
+}
+
+// LoadSettings is used to load user settings from the program directory,
+// the settings can be overridden by environment variables
+func LoadSettings() (*Settings, error) {
+	return LoadSettingsFrom(consts.PathForSettings())
+}
+
+// LoadSettingsFrom is used to load user settings from specified path,
+// the settings can be overridden by environment variables
+func LoadSettingsFrom(path string) (*Settings, error) {
+	settings := &Settings{}
+	data, err := ioutil.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if err == nil {
+		if err := yaml.Unmarshal(data, settings); err != nil {
+			return nil, errors.Wrapf(err, "failed to parse %s", path)
+		}
+	}
+	if settings.Mirrors == nil {
+		settings.Mirrors = &MirrorSettings{}
+	}
+	if mirrors := splitEnvList(os.Getenv(consts.EnvProtocMirrors)); len(mirrors) != 0 {
+		settings.Mirrors.Protoc = mirrors
+	}
+	if mirrors := splitEnvList(os.Getenv(consts.EnvArchiveMirrors)); len(mirrors) != 0 {
+		settings.Mirrors.Archive = mirrors
+	}
+	return settings, nil
+}
+
+func splitEnvList(val string) []string {
+	var items []string
+	for _, item := range strings.Split(val, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -26,21 +26,38 @@ import (
 // defines a set of const value
 const (
 	// ConfigFileName defines the config file name
-	ConfigFileName            = "powerproto.yaml"
+	ConfigFileName = "powerproto.yaml"
+	// OverrideConfigFileName defines the file name of untracked config overriding
+	// the config file in the same directory, e.g. the local replace directives
+	OverrideConfigFileName = "powerproto.override.yaml"
 	// KeyNamePowerProtocInclude is the key name of powerproto default include
 	KeyNamePowerProtocInclude = "POWERPROTO_INCLUDE"
 	// The default include can be referenced by this key in import paths
-	KeyPowerProtoInclude = "$" + KeyNamePowerProtocInclude
+	KeyPowerProtoInclude  = "$" + KeyNamePowerProtocInclude
 	KeyNameSourceRelative = "SOURCE_RELATIVE"
 	// KeySourceRelative can be specified in import paths to refer to
 	// the folder where the current proto file is located
 	KeySourceRelative = "$" + KeyNameSourceRelative
 	// Defines the program directory of PowerProto, including various binary and include files
 	EnvHomeDir = "POWERPROTO_HOME"
+	// EnvOffline defines whether to run in offline mode, in which the network is never accessed
+	// and only the cache in the program directory is used, e.g. POWERPROTO_OFFLINE=1
+	EnvOffline = "POWERPROTO_OFFLINE"
+	// SettingsFileName defines the file name of user settings in the program directory
+	SettingsFileName = "settings.yaml"
+	// EnvProtocMirrors defines the comma separated url templates to download protoc releases,
+	// it overrides the mirrors in user settings
+	EnvProtocMirrors = "POWERPROTO_PROTOC_MIRRORS"
+	// EnvArchiveMirrors defines the comma separated url templates to download repository archives,
+	// it overrides the mirrors in user settings
+	EnvArchiveMirrors = "POWERPROTO_ARCHIVE_MIRRORS"
 	// ProtobufRepository defines the protobuf repository
 	ProtobufRepository = "https://github.com/protocolbuffers/protobuf"
 	// GoogleAPIsRepository defines the google apis repository
 	GoogleAPIsRepository = "https://github.com/googleapis/googleapis"
+	// VersionLatestPrerelease is resolved to the newest version including prereleases,
+	// while latest is resolved to the newest stable version
+	VersionLatestPrerelease = "latest-prerelease"
 )
 
 // defines a set of text style
@@ -63,6 +80,11 @@ func PathForGlobalConfig() string {
 	return filepath.Join(GetHomeDir(), ConfigFileName)
 }
 
+// PathForSettings is used to get path of user settings
+func PathForSettings() string {
+	return filepath.Join(GetHomeDir(), SettingsFileName)
+}
+
 func getHomeDir() (string, error) {
 	val := os.Getenv(EnvHomeDir)
 	if val != "" {
@@ -16,6 +16,8 @@ package consts
 
 import (
 	"context"
+	"os"
+	"strconv"
 	"time"
 )
 
@@ -24,6 +26,8 @@ type dryRun struct{}
 type ignoreDryRun struct{}
 type disableAction struct{}
 type perCommandTimeout struct{}
+type fixImports struct{}
+type offline struct{}
 
 func GetContextWithPerCommandTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
 	val := ctx.Value(perCommandTimeout{})
@@ -57,6 +61,16 @@ func WithDisableAction(ctx context.Context) context.Context {
 	return context.WithValue(ctx, disableAction{}, "true")
 }
 
+// WithFixImports is used to allow the config to be updated to resolve missing imports
+func WithFixImports(ctx context.Context) context.Context {
+	return context.WithValue(ctx, fixImports{}, "true")
+}
+
+// WithOffline is used to forbid network access
+func WithOffline(ctx context.Context) context.Context {
+	return context.WithValue(ctx, offline{}, "true")
+}
+
 // WithDryRun is used to inject dryRun flag into context
 func WithDryRun(ctx context.Context) context.Context {
 	ctx = WithDebugMode(ctx)
@@ -82,3 +96,18 @@ func IsIgnoreDryRun(ctx context.Context) bool {
 func IsDryRun(ctx context.Context) bool {
 	return ctx.Value(dryRun{}) != nil
 }
+
+// IsFixImports is used to decide whether to update the config to resolve missing imports
+func IsFixImports(ctx context.Context) bool {
+	return ctx.Value(fixImports{}) != nil
+}
+
+// IsOffline is used to decide whether the network access is forbidden,
+// it is enabled by WithOffline or the environment variable EnvOffline
+func IsOffline(ctx context.Context) bool {
+	if ctx.Value(offline{}) != nil {
+		return true
+	}
+	val, _ := strconv.ParseBool(os.Getenv(EnvOffline))
+	return val
+}
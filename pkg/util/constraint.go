@@ -0,0 +1,158 @@
+// Copyright 2021 storyicon@foxmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/coreos/go-semver/semver"
+	"github.com/pkg/errors"
+)
+
+var (
+	// regexpConstraintItem matches the items of constraint, e.g. ~1.27, ^2.5.0, >=3.17 and v1
+	regexpConstraintItem = regexp.MustCompile(`^(>=|<=|>|<|=|~|\^)?v?([0-9]+)(?:\.([0-9]+))?(?:\.([0-9]+))?$`)
+	// regexpMajorVersion matches the constraint of major version without operator, e.g. v1
+	regexpMajorVersion = regexp.MustCompile(`^v?[0-9]+$`)
+)
+
+// versionBound defines a bound of versions, e.g. >=1.27.0
+type versionBound struct {
+	op      string
+	version *semver.Version
+}
+
+func (b *versionBound) check(version *semver.Version) bool {
+	switch b.op {
+	case ">=":
+		return !version.LessThan(*b.version)
+	case ">":
+		return b.version.LessThan(*version)
+	case "<=":
+		return !b.version.LessThan(*version)
+	case "<":
+		return version.LessThan(*b.version)
+	}
+	return version.Equal(*b.version)
+}
+
+// VersionConstraint defines the constraint of semantic versions, the bounds are all satisfied
+type VersionConstraint struct {
+	raw    string
+	bounds []*versionBound
+}
+
+// IsVersionConstraint reports whether the version is a constraint rather than a version or keyword,
+// e.g. ~1.27, ^2.5.0, >=3.17 <4 and v1
+func IsVersionConstraint(s string) bool {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return false
+	}
+	if !regexpMajorVersion.MatchString(s) && !strings.ContainsAny(s[:1], "<>=~^") {
+		return false
+	}
+	_, err := ParseVersionConstraint(s)
+	return err == nil
+}
+
+// ParseVersionConstraint is used to parse the constraint separated by spaces, the items are:
+// ~1.27 for >=1.27.0 <1.28.0, ^2.5.0 for >=2.5.0 <3.0.0, v1 for >=1.0.0 <2.0.0,
+// and the comparisons such as >=3.17 and <4, in which the missing components are zero
+func ParseVersionConstraint(s string) (*VersionConstraint, error) {
+	items := strings.Fields(strings.ReplaceAll(s, ",", " "))
+	if len(items) == 0 {
+		return nil, errors.New("empty version constraint")
+	}
+	constraint := &VersionConstraint{raw: strings.Join(items, " ")}
+	for _, item := range items {
+		matches := regexpConstraintItem.FindStringSubmatch(item)
+		if matches == nil {
+			return nil, errors.Errorf("invalid version constraint %s", item)
+		}
+		op := matches[1]
+		var parts [3]int64
+		for i, part := range matches[2:] {
+			if part != "" {
+				parts[i], _ = strconv.ParseInt(part, 10, 64)
+			}
+		}
+		lower := &semver.Version{Major: parts[0], Minor: parts[1], Patch: parts[2]}
+		var upper *semver.Version
+		switch {
+		case op == "~" && matches[3] == "":
+			upper = &semver.Version{Major: parts[0] + 1}
+		case op == "~":
+			upper = &semver.Version{Major: parts[0], Minor: parts[1] + 1}
+		case op == "^" && parts[0] != 0:
+			upper = &semver.Version{Major: parts[0] + 1}
+		case op == "^" && parts[1] != 0:
+			upper = &semver.Version{Minor: parts[1] + 1}
+		case op == "^":
+			upper = &semver.Version{Patch: parts[2] + 1}
+		case op == "" && matches[3] == "":
+			upper = &semver.Version{Major: parts[0] + 1}
+		case op == "" && matches[4] == "":
+			upper = &semver.Version{Major: parts[0], Minor: parts[1] + 1}
+		case op == "":
+			op = "="
+		}
+		if upper != nil {
+			constraint.bounds = append(constraint.bounds,
+				&versionBound{op: ">=", version: lower},
+				&versionBound{op: "<", version: upper},
+			)
+			continue
+		}
+		constraint.bounds = append(constraint.bounds, &versionBound{op: op, version: lower})
+	}
+	return constraint, nil
+}
+
+// String returns the constraint in normalized format
+func (c *VersionConstraint) String() string {
+	return c.raw
+}
+
+// Check reports whether the version satisfies the constraint, the prereleases never satisfy it
+func (c *VersionConstraint) Check(version string) bool {
+	v, err := parseSemanticVersion(version)
+	if err != nil || v.PreRelease != "" {
+		return false
+	}
+	for _, bound := range c.bounds {
+		if !bound.check(v) {
+			return false
+		}
+	}
+	return true
+}
+
+// ResolveVersionConstraint is used to get the newest version satisfying the constraint
+func ResolveVersionConstraint(constraint string, versions []string) (string, error) {
+	c, err := ParseVersionConstraint(constraint)
+	if err != nil {
+		return "", err
+	}
+	_, sorted := SortSemanticVersion(versions)
+	for i := len(sorted) - 1; i >= 0; i-- {
+		if c.Check(sorted[i]) {
+			return sorted[i], nil
+		}
+	}
+	return "", errors.Errorf("no version satisfies %s", constraint)
+}
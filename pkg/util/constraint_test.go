@@ -0,0 +1,82 @@
+// Copyright 2021 storyicon@foxmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import "testing"
+
+func TestIsVersionConstraint(t *testing.T) {
+	tests := []struct {
+		version string
+		want    bool
+	}{
+		{version: "~1.27", want: true},
+		{version: "^2.5.0", want: true},
+		{version: ">=3.17 <4", want: true},
+		{version: "v1", want: true},
+		{version: "3", want: true},
+		{version: "latest", want: false},
+		{version: "v1.27.1", want: false},
+		{version: "21.12", want: false},
+		{version: "branch:master", want: false},
+		{version: "75e9812478607db997376ccea247dd6928f70f45", want: false},
+		{version: ">=x", want: false},
+		{version: "", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.version, func(t *testing.T) {
+			if got := IsVersionConstraint(tt.version); got != tt.want {
+				t.Errorf("IsVersionConstraint() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestResolveVersionConstraint(t *testing.T) {
+	versions := []string{
+		"v0.1.0", "v0.1.3", "v0.2.0", "v1.26.0", "v1.27.0", "v1.27.1", "v1.28.0-rc1", "v1.28.0",
+		"v2.4.9", "v2.5.0", "v2.7.3", "v3.0.0-alpha", "v3.17.3", "v3.20.3", "v21.12", "v22.0-rc3",
+	}
+	tests := []struct {
+		constraint string
+		want       string
+		wantErr    bool
+	}{
+		{constraint: "~1.27", want: "v1.27.1"},
+		{constraint: "~1", want: "v1.28.0"},
+		{constraint: "^2.5.0", want: "v2.7.3"},
+		{constraint: "^0.1.0", want: "v0.1.3"},
+		{constraint: "^0.0.1", wantErr: true},
+		{constraint: ">=3.17 <4", want: "v3.20.3"},
+		{constraint: ">=3.17, <21", want: "v3.20.3"},
+		{constraint: ">21", want: "v21.12"},
+		{constraint: "v1", want: "v1.28.0"},
+		{constraint: "=1.27.0", want: "v1.27.0"},
+		{constraint: "<1.27", want: "v1.26.0"},
+		{constraint: "^4", wantErr: true},
+		{constraint: "~x", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.constraint, func(t *testing.T) {
+			got, err := ResolveVersionConstraint(tt.constraint, versions)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ResolveVersionConstraint() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("ResolveVersionConstraint() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,127 @@
+// Copyright 2021 storyicon@foxmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package descriptor
+
+import (
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// defines the field numbers used in the path of source code info
+// see google/protobuf/descriptor.proto
+const (
+	FilePackageTag     = 2
+	FileDependencyTag  = 3
+	FileMessageTypeTag = 4
+	FileEnumTypeTag    = 5
+	FileServiceTag     = 6
+	FileOptionsTag     = 8
+	FileSyntaxTag      = 12
+
+	FileOptionsGoPackageTag = 11
+
+	MessageFieldTag      = 2
+	MessageNestedTypeTag = 3
+	MessageEnumTypeTag   = 4
+
+	FieldNameTag     = 1
+	FieldNumberTag   = 3
+	FieldLabelTag    = 4
+	FieldTypeTag     = 5
+	FieldTypeNameTag = 6
+
+	EnumValueTag = 2
+
+	ServiceMethodTag = 2
+
+	MethodInputTypeTag       = 2
+	MethodOutputTypeTag      = 3
+	MethodClientStreamingTag = 5
+	MethodServerStreamingTag = 6
+)
+
+// JoinPath is used to append elements to a copy of path
+func JoinPath(path []int32, elements ...int32) []int32 {
+	data := make([]int32, 0, len(path)+len(elements))
+	data = append(data, path...)
+	return append(data, elements...)
+}
+
+// GetCompiledFile is used to get the descriptor of the compiled file from
+// the descriptor set generated with --include_imports
+func GetCompiledFile(set *descriptorpb.FileDescriptorSet) *descriptorpb.FileDescriptorProto {
+	files := set.GetFile()
+	if len(files) == 0 {
+		return nil
+	}
+	// the compiled file is always placed after its dependencies
+	return files[len(files)-1]
+}
+
+// FindLocation is used to find the location of specified path in file
+func FindLocation(file *descriptorpb.FileDescriptorProto, path []int32) *descriptorpb.SourceCodeInfo_Location {
+	for _, location := range file.GetSourceCodeInfo().GetLocation() {
+		if isSamePath(location.GetPath(), path) {
+			return location
+		}
+	}
+	return nil
+}
+
+// GetPosition is used to get the position of specified path in file,
+// the line and column start from 1.
+// If the path can not be found, the position of its nearest ancestor will be returned
+func GetPosition(file *descriptorpb.FileDescriptorProto, path []int32) (line int, column int) {
+	for i := len(path); i > 0; i-- {
+		location := FindLocation(file, path[:i])
+		if location == nil {
+			continue
+		}
+		span := location.GetSpan()
+		if len(span) < 3 {
+			continue
+		}
+		return int(span[0]) + 1, int(span[1]) + 1
+	}
+	return 1, 1
+}
+
+// GetComments is used to get the leading, trailing and detached comments of specified path in file
+func GetComments(file *descriptorpb.FileDescriptorProto, path []int32) []string {
+	location := FindLocation(file, path)
+	if location == nil {
+		return nil
+	}
+	var comments []string
+	comments = append(comments, location.GetLeadingDetachedComments()...)
+	if location.LeadingComments != nil {
+		comments = append(comments, location.GetLeadingComments())
+	}
+	if location.TrailingComments != nil {
+		comments = append(comments, location.GetTrailingComments())
+	}
+	return comments
+}
+
+func isSamePath(a, b []int32) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,103 @@
+// Copyright 2021 storyicon@foxmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package diagnostic
+
+import (
+	"fmt"
+	"io"
+	"sort"
+
+	jsoniter "github.com/json-iterator/go"
+	"github.com/pkg/errors"
+)
+
+// defines a set of output formats
+const (
+	// FormatText is in the same form as the errors of protoc, e.g.
+	// 		path/to/file.proto:12:3: message (RULE)
+	FormatText = "text"
+	// FormatJSON outputs a json array
+	FormatJSON = "json"
+	// FormatGithubActions outputs the workflow commands of github actions
+	FormatGithubActions = "github-actions"
+)
+
+// Formats defines the supported output formats
+var Formats = []string{
+	FormatText,
+	FormatJSON,
+	FormatGithubActions,
+}
+
+// Diagnostic defines a problem found in proto file
+type Diagnostic struct {
+	// Path is the local path of the proto file
+	Path string `json:"path"`
+	// Line starts from 1, 0 means unknown
+	Line int `json:"line"`
+	// Column starts from 1, 0 means unknown
+	Column  int    `json:"column"`
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+// String implements the fmt.Stringer
+func (d *Diagnostic) String() string {
+	return fmt.Sprintf("%s:%d:%d: %s (%s)", d.Path, d.Line, d.Column, d.Message, d.Rule)
+}
+
+// Sort is used to sort diagnostics by path, line, column and rule
+func Sort(diagnostics []*Diagnostic) {
+	sort.SliceStable(diagnostics, func(i, j int) bool {
+		a, b := diagnostics[i], diagnostics[j]
+		if a.Path != b.Path {
+			return a.Path < b.Path
+		}
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+		if a.Column != b.Column {
+			return a.Column < b.Column
+		}
+		return a.Rule < b.Rule
+	})
+}
+
+// Write is used to write diagnostics into writer in specified format
+func Write(writer io.Writer, format string, diagnostics []*Diagnostic) error {
+	switch format {
+	case FormatText, "":
+		for _, d := range diagnostics {
+			if _, err := fmt.Fprintln(writer, d.String()); err != nil {
+				return err
+			}
+		}
+		return nil
+	case FormatJSON:
+		if diagnostics == nil {
+			diagnostics = []*Diagnostic{}
+		}
+		return jsoniter.NewEncoder(writer).Encode(diagnostics)
+	case FormatGithubActions:
+		for _, d := range diagnostics {
+			if _, err := fmt.Fprintf(writer, "::error file=%s,line=%d,col=%d,title=%s::%s\n",
+				d.Path, d.Line, d.Column, d.Rule, d.Message); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return errors.Errorf("unknown format: %s, should be one of %s", format, Formats)
+}
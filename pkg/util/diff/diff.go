@@ -0,0 +1,147 @@
+// Copyright 2021 storyicon@foxmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package diff
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// context is the number of unchanged lines around the changes
+const context = 3
+
+type operation struct {
+	kind byte
+	text string
+	// indexes of the line in old and new text
+	a, b int
+}
+
+func splitLines(data []byte) []string {
+	lines := strings.SplitAfter(string(data), "\n")
+	if len(lines) != 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// getOperations is used to get the edit script based on the longest common subsequence
+func getOperations(x, y []string) []operation {
+	n, m := len(x), len(y)
+	lcs := make([][]int32, n+1)
+	for i := range lcs {
+		lcs[i] = make([]int32, m+1)
+	}
+	for i := n - 1; i >= 0; i-- {
+		for j := m - 1; j >= 0; j-- {
+			if x[i] == y[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+	var operations []operation
+	i, j := 0, 0
+	for i < n || j < m {
+		switch {
+		case i < n && j < m && x[i] == y[j]:
+			operations = append(operations, operation{kind: ' ', text: x[i], a: i, b: j})
+			i++
+			j++
+		case j >= m || (i < n && lcs[i+1][j] >= lcs[i][j+1]):
+			operations = append(operations, operation{kind: '-', text: x[i], a: i, b: j})
+			i++
+		default:
+			operations = append(operations, operation{kind: '+', text: y[j], a: i, b: j})
+			j++
+		}
+	}
+	return operations
+}
+
+// Unified is used to generate the unified diff between old and new text,
+// nil will be returned if they are the same
+func Unified(oldName, newName string, old, new []byte) []byte {
+	if bytes.Equal(old, new) {
+		return nil
+	}
+	operations := getOperations(splitLines(old), splitLines(new))
+	buf := &bytes.Buffer{}
+	fmt.Fprintf(buf, "--- %s\n+++ %s\n", oldName, newName)
+	for start := 0; start < len(operations); {
+		if operations[start].kind == ' ' {
+			start++
+			continue
+		}
+		// extend the hunk until the unchanged lines are enough to split it
+		end, unchanged := start, 0
+		for i := start; i < len(operations) && unchanged <= 2*context; i++ {
+			if operations[i].kind == ' ' {
+				unchanged++
+				continue
+			}
+			end, unchanged = i, 0
+		}
+		from, to := maxInt(start-context, 0), minInt(end+context+1, len(operations))
+		writeHunk(buf, operations[from:to])
+		start = to
+	}
+	return buf.Bytes()
+}
+
+func writeHunk(buf *bytes.Buffer, operations []operation) {
+	var oldCount, newCount int
+	for _, operation := range operations {
+		if operation.kind != '+' {
+			oldCount++
+		}
+		if operation.kind != '-' {
+			newCount++
+		}
+	}
+	oldStart, newStart := operations[0].a, operations[0].b
+	if oldCount != 0 {
+		oldStart++
+	}
+	if newCount != 0 {
+		newStart++
+	}
+	fmt.Fprintf(buf, "@@ -%d,%d +%d,%d @@\n", oldStart, oldCount, newStart, newCount)
+	for _, operation := range operations {
+		buf.WriteByte(operation.kind)
+		buf.WriteString(operation.text)
+		if !strings.HasSuffix(operation.text, "\n") {
+			buf.WriteString("\n\\ No newline at end of file\n")
+		}
+	}
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
@@ -93,16 +93,48 @@ func IsDirExists(path string) (bool, error) {
 	return true, nil
 }
 
+// GetDirSize is used to get the total size of the files in dir
+func GetDirSize(dir string) (int64, error) {
+	var size int64
+	err := filepath.Walk(dir, func(path string, info fs.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			size += info.Size()
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return size, nil
+}
+
 // GetFilesWithExtRecursively is used to recursively list files with a specific suffix
 // expectExt should contain the prefix '.'
+// The paths matched by the IgnoreFileName in the directories are skipped
 func GetFilesWithExtRecursively(target string, targetExt string) ([]string, error) {
 	var data []string
+	rules := map[string][]*ignoreRule{}
 	err := filepath.Walk(target, func(path string, info fs.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		parent := rules[filepath.Dir(path)]
 		if info.IsDir() {
+			if path != target && isIgnored(parent, path, true) {
+				return filepath.SkipDir
+			}
+			items, err := loadIgnoreRules(path)
+			if err != nil {
+				return err
+			}
+			rules[path] = append(append([]*ignoreRule{}, parent...), items...)
 			return nil
 		}
 		ext := filepath.Ext(path)
-		if ext == targetExt {
+		if ext == targetExt && !isIgnored(parent, path, false) {
 			data = append(data, path)
 		}
 		return nil
@@ -112,11 +144,16 @@ func GetFilesWithExtRecursively(target string, targetExt string) ([]string, erro
 
 // GetFilesWithExt is used to list files with a specific suffix
 // expectExt should contain the prefix '.'
+// The paths matched by the IgnoreFileName in the directory are skipped
 func GetFilesWithExt(dir string, targetExt string) ([]string, error) {
 	children, err := ioutil.ReadDir(dir)
 	if err != nil {
 		return nil, err
 	}
+	rules, err := loadIgnoreRules(dir)
+	if err != nil {
+		return nil, err
+	}
 	var data []string
 	for _, child := range children {
 		if child.IsDir() {
@@ -125,7 +162,11 @@ func GetFilesWithExt(dir string, targetExt string) ([]string, error) {
 		if ext := filepath.Ext(child.Name()); ext != targetExt {
 			continue
 		}
-		data = append(data, filepath.Join(dir, child.Name()))
+		path := filepath.Join(dir, child.Name())
+		if isIgnored(rules, path, false) {
+			continue
+		}
+		data = append(data, path)
 	}
 	return data, nil
 }
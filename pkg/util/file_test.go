@@ -0,0 +1,123 @@
+// Copyright 2021 storyicon@foxmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestGetFilesWithExtRecursively(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	files := map[string]string{
+		IgnoreFileName:                   "# comment\nthird_party/\n/legacy/*.proto\n!/legacy/keep.proto\n",
+		"a.proto":                        "",
+		"a.txt":                          "",
+		"third_party/b.proto":            "",
+		"legacy/c.proto":                 "",
+		"legacy/keep.proto":              "",
+		"sub/d.proto":                    "",
+		"sub/" + IgnoreFileName:          "*_internal.proto\n",
+		"sub/e_internal.proto":           "",
+		"sub/legacy/f.proto":             "",
+		"sub/nested/third_party/g.proto": "",
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	got, err := GetFilesWithExtRecursively(dir, ".proto")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var rel []string
+	for _, path := range got {
+		item, _ := filepath.Rel(dir, path)
+		rel = append(rel, filepath.ToSlash(item))
+	}
+	sort.Strings(rel)
+	want := []string{"a.proto", "legacy/keep.proto", "sub/d.proto", "sub/legacy/f.proto"}
+	if !reflect.DeepEqual(rel, want) {
+		t.Errorf("GetFilesWithExtRecursively() = %v, want %v", rel, want)
+	}
+
+	got, err = GetFilesWithExt(filepath.Join(dir, "sub"), ".proto")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{filepath.Join(dir, "sub", "d.proto")}; !reflect.DeepEqual(got, want) {
+		t.Errorf("GetFilesWithExt() = %v, want %v", got, want)
+	}
+}
+
+func TestIgnoreMatcher(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	files := map[string]string{
+		IgnoreFileName:          "third_party/\n/legacy/*.proto\n!/legacy/keep.proto\n",
+		"sub/" + IgnoreFileName: "*_internal.proto\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tests := []struct {
+		file string
+		want bool
+	}{
+		{file: "a.proto", want: false},
+		{file: "third_party/b.proto", want: true},
+		{file: "sub/nested/third_party/g.proto", want: true},
+		{file: "legacy/c.proto", want: true},
+		{file: "legacy/keep.proto", want: false},
+		{file: "sub/d.proto", want: false},
+		{file: "sub/e_internal.proto", want: true},
+		{file: "e_internal.proto", want: false},
+		{file: "../third_party/outside.proto", want: false},
+	}
+	matcher := NewIgnoreMatcher(dir)
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			got, err := matcher.IsIgnored(filepath.Join(dir, filepath.FromSlash(tt.file)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("IsIgnored() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,63 @@
+// Copyright 2021 storyicon@foxmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package filelock
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestAcquire(t *testing.T) {
+	dir, err := ioutil.TempDir("", "filelock")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "locks", "a.lock")
+
+	lock, err := Acquire(context.TODO(), path)
+	if err != nil {
+		t.Fatalf("Acquire() error = %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.TODO(), 3*pollInterval)
+	defer cancel()
+	if _, err := Acquire(ctx, path); err != context.DeadlineExceeded {
+		t.Fatalf("Acquire() of held lock error = %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	acquired := make(chan *Lock)
+	go func() {
+		lock, err := Acquire(context.TODO(), path)
+		if err != nil {
+			t.Errorf("Acquire() error = %v", err)
+		}
+		acquired <- lock
+	}()
+	select {
+	case <-acquired:
+		t.Fatal("Acquire() returns before the lock is released")
+	case <-time.After(2 * pollInterval):
+	}
+	if err := lock.Release(); err != nil {
+		t.Fatalf("Release() error = %v", err)
+	}
+	if lock := <-acquired; lock != nil {
+		lock.Release()
+	}
+}
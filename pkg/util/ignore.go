@@ -0,0 +1,169 @@
+// Copyright 2021 storyicon@foxmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/bmatcuk/doublestar"
+)
+
+// IgnoreFileName is the name of the file that lists the patterns of
+// paths to be ignored when looking up files in its directory and sub directories.
+// The patterns follow the format of .gitignore:
+//
+//	# comment
+//	third_party/
+//	/legacy/*.proto
+//	!/legacy/keep.proto
+const IgnoreFileName = ".powerprotoignore"
+
+type ignoreRule struct {
+	// dir is the directory of the ignore file
+	dir      string
+	pattern  string
+	negative bool
+	dirOnly  bool
+	// anchored means the pattern is matched against the path relative to dir,
+	// otherwise it is matched against the base name
+	anchored bool
+}
+
+// loadIgnoreRules is used to load the rules of ignore file in dir
+func loadIgnoreRules(dir string) ([]*ignoreRule, error) {
+	data, err := ioutil.ReadFile(filepath.Join(dir, IgnoreFileName))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var rules []*ignoreRule
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		rule := &ignoreRule{dir: dir}
+		if strings.HasPrefix(line, "!") {
+			rule.negative = true
+			line = line[1:]
+		}
+		if strings.HasSuffix(line, "/") {
+			rule.dirOnly = true
+			line = strings.TrimSuffix(line, "/")
+		}
+		if strings.Contains(line, "/") {
+			rule.anchored = true
+			line = strings.TrimPrefix(line, "/")
+		}
+		if line == "" {
+			continue
+		}
+		rule.pattern = line
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// isIgnored is used to check whether the path is ignored by rules,
+// the last matched rule takes effect
+func isIgnored(rules []*ignoreRule, file string, isDir bool) bool {
+	ignored := false
+	for _, rule := range rules {
+		if rule.dirOnly && !isDir {
+			continue
+		}
+		name := filepath.Base(file)
+		if rule.anchored {
+			rel, err := filepath.Rel(rule.dir, file)
+			if err != nil {
+				continue
+			}
+			name = filepath.ToSlash(rel)
+		}
+		if matched, _ := doublestar.Match(rule.pattern, name); !matched {
+			continue
+		}
+		ignored = !rule.negative
+	}
+	return ignored
+}
+
+// IgnoreMatcher is used to check whether the paths under root are ignored
+// by the IgnoreFileName in root and the directories between root and the paths
+type IgnoreMatcher struct {
+	root  string
+	rules map[string][]*ignoreRule
+}
+
+// NewIgnoreMatcher is used to create IgnoreMatcher of root
+func NewIgnoreMatcher(root string) *IgnoreMatcher {
+	return &IgnoreMatcher{
+		root:  filepath.Clean(root),
+		rules: map[string][]*ignoreRule{},
+	}
+}
+
+// IsIgnored is used to check whether the file, or any of its parent directories
+// under root, is ignored. The paths outside root are never ignored
+func (m *IgnoreMatcher) IsIgnored(file string) (bool, error) {
+	rel, err := filepath.Rel(m.root, filepath.Clean(file))
+	if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return false, nil
+	}
+	dir := m.root
+	parts := strings.Split(rel, string(filepath.Separator))
+	for i, part := range parts {
+		rules, err := m.loadRules(dir)
+		if err != nil {
+			return false, err
+		}
+		path := filepath.Join(dir, part)
+		if i == len(parts)-1 {
+			return isIgnored(rules, path, false), nil
+		}
+		if isIgnored(rules, path, true) {
+			return true, nil
+		}
+		dir = path
+	}
+	return false, nil
+}
+
+// loadRules is used to load the rules that take effect in dir, including the ones of its parents
+func (m *IgnoreMatcher) loadRules(dir string) ([]*ignoreRule, error) {
+	if rules, ok := m.rules[dir]; ok {
+		return rules, nil
+	}
+	var parent []*ignoreRule
+	if dir != m.root {
+		var err error
+		parent, err = m.loadRules(filepath.Dir(dir))
+		if err != nil {
+			return nil, err
+		}
+	}
+	items, err := loadIgnoreRules(dir)
+	if err != nil {
+		return nil, err
+	}
+	rules := append(append([]*ignoreRule{}, parent...), items...)
+	m.rules[dir] = rules
+	return rules, nil
+}
@@ -17,6 +17,7 @@ package progressbar
 import (
 	"context"
 	"fmt"
+	"sync"
 
 	"github.com/fatih/color"
 	"github.com/vbauerster/mpb/v7"
@@ -41,20 +42,38 @@ type ProgressBar interface {
 type progressBar struct {
 	container *mpb.Progress
 	bar       *mpb.Bar
-	prefix    string
-	suffix    string
+	// lock guards prefix and suffix, which may be set by concurrent workers
+	lock   sync.RWMutex
+	prefix string
+	suffix string
 }
 
 // SetPrefix is used to set the prefix of progress bar
 func (s *progressBar) SetPrefix(format string, args ...interface{}) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
 	s.prefix = fmt.Sprintf(format, args...)
 }
 
 // SetSuffix is used to set the suffix of progress bar
 func (s *progressBar) SetSuffix(format string, args ...interface{}) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
 	s.suffix = fmt.Sprintf(format, args...)
 }
 
+func (s *progressBar) getPrefix() string {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return s.prefix
+}
+
+func (s *progressBar) getSuffix() string {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return s.suffix
+}
+
 func newEmbedProgressBar(container *mpb.Progress, bar *mpb.Bar) *progressBar {
 	return &progressBar{
 		container: container,
@@ -86,6 +105,7 @@ func getSpinner() []string {
 }
 
 type fakeProgressbar struct {
+	lock    sync.Mutex
 	prefix  string
 	suffix  string
 	total   int
@@ -94,6 +114,8 @@ type fakeProgressbar struct {
 }
 
 func (f *fakeProgressbar) Incr() {
+	f.lock.Lock()
+	defer f.lock.Unlock()
 	if f.current < f.total {
 		f.current++
 	}
@@ -104,11 +126,15 @@ func (f *fakeProgressbar) Wait() {}
 
 // SetSuffix is used to set the prefix of progress bar
 func (f *fakeProgressbar) SetPrefix(format string, args ...interface{}) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
 	f.prefix = fmt.Sprintf(format, args...)
 }
 
 // SetSuffix is used to set the suffix of progress bar
 func (f *fakeProgressbar) SetSuffix(format string, args ...interface{}) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
 	f.suffix = fmt.Sprintf(format, args...)
 	f.LogInfo(map[string]interface{}{
 		"progress": fmt.Sprintf("%3.f", float64(f.current)/float64(f.total)*100),
@@ -123,6 +149,19 @@ func newFakeProgressbar(total int) ProgressBar {
 	}
 }
 
+type silentProgressbar struct{}
+
+func (silentProgressbar) Incr()                                        {}
+func (silentProgressbar) Wait()                                        {}
+func (silentProgressbar) SetPrefix(format string, args ...interface{}) {}
+func (silentProgressbar) SetSuffix(format string, args ...interface{}) {}
+
+// GetSilentProgressBar is used to get the progress bar that renders nothing,
+// e.g. when the stdout is used to output the result in json
+func GetSilentProgressBar() ProgressBar {
+	return silentProgressbar{}
+}
+
 // GetProgressBar is used to get progress bar
 func GetProgressBar(ctx context.Context, count int) ProgressBar {
 	if consts.IsDebugMode(ctx) {
@@ -150,7 +189,7 @@ func GetProgressBar(ctx context.Context, count int) ProgressBar {
 			}(),
 			decor.Any(func(statistics decor.Statistics) string {
 				if progressBar != nil {
-					return progressBar.prefix
+					return progressBar.getPrefix()
 				}
 				return ""
 			}),
@@ -159,7 +198,7 @@ func GetProgressBar(ctx context.Context, count int) ProgressBar {
 			decor.NewPercentage("%d  "),
 			decor.Any(func(statistics decor.Statistics) string {
 				if progressBar != nil {
-					return fmt.Sprintf("(%d/%d) %s", statistics.Current, count, progressBar.suffix)
+					return fmt.Sprintf("(%d/%d) %s", statistics.Current, count, progressBar.getSuffix())
 				}
 				return ""
 			}),
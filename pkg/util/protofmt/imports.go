@@ -0,0 +1,153 @@
+// Copyright 2021 storyicon@foxmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package protofmt
+
+import (
+	"sort"
+	"strings"
+)
+
+// unit is a top level statement with its leading and trailing comments
+type unit []*token
+
+// statement is used to get the tokens of unit without comments
+func (u unit) statement() []*token {
+	var tokens []*token
+	for _, tok := range u {
+		if tok.kind != kindComment {
+			tokens = append(tokens, tok)
+		}
+	}
+	return tokens
+}
+
+func (u unit) isImport() bool {
+	tokens := u.statement()
+	return len(tokens) != 0 && tokens[0].text == "import"
+}
+
+func (u unit) hasComments() bool {
+	return len(u.statement()) != len(u)
+}
+
+// importPath is used to get the path of import statement without quotes
+func (u unit) importPath() string {
+	for _, tok := range u.statement() {
+		if tok.kind == kindString {
+			return tok.text[1 : len(tok.text)-1]
+		}
+	}
+	return ""
+}
+
+func (u unit) key() string {
+	var texts []string
+	for _, tok := range u.statement() {
+		texts = append(texts, tok.text)
+	}
+	return strings.Join(texts, " ")
+}
+
+// splitUnits is used to split tokens into top level units
+func splitUnits(tokens []*token) []unit {
+	var units []unit
+	var current unit
+	depth := 0
+	for i := 0; i < len(tokens); i++ {
+		tok := tokens[i]
+		current = append(current, tok)
+		switch tok.text {
+		case "{":
+			depth++
+			continue
+		case "}":
+			depth--
+			if depth != 0 {
+				continue
+			}
+		case ";":
+			if depth != 0 {
+				continue
+			}
+		default:
+			continue
+		}
+		// comments on the same line belong to the statement
+		for i+1 < len(tokens) && tokens[i+1].kind == kindComment && tokens[i+1].newlines == 0 {
+			i++
+			current = append(current, tokens[i])
+		}
+		units = append(units, current)
+		current = nil
+	}
+	if len(current) != 0 {
+		units = append(units, current)
+	}
+	return units
+}
+
+// detachHeader is used to split the comments separated from the statement
+// by blank lines, they describe the section rather than the statement
+func detachHeader(u unit) (header unit, rest unit) {
+	index := -1
+	for i := 0; i+1 < len(u) && u[i].kind == kindComment; i++ {
+		if u[i+1].newlines >= 2 {
+			index = i
+		}
+	}
+	return u[:index+1], u[index+1:]
+}
+
+// sortImports is used to sort every consecutive run of import statements by
+// path and remove the duplicate ones
+func sortImports(tokens []*token) []*token {
+	units := splitUnits(tokens)
+	var result []*token
+	for i := 0; i < len(units); {
+		if !units[i].isImport() {
+			result = append(result, units[i]...)
+			i++
+			continue
+		}
+		j := i
+		for j < len(units) && units[j].isImport() {
+			j++
+		}
+		header, first := detachHeader(units[i])
+		result = append(result, header...)
+		newlines := first[0].newlines
+		run := append([]unit{first}, units[i+1:j]...)
+		sort.SliceStable(run, func(a, b int) bool {
+			return run[a].importPath() < run[b].importPath()
+		})
+		seen := map[string]struct{}{}
+		count := 0
+		for _, item := range run {
+			if _, ok := seen[item.key()]; ok && !item.hasComments() {
+				continue
+			}
+			seen[item.key()] = struct{}{}
+			if count == 0 {
+				item[0].newlines = newlines
+			} else {
+				item[0].newlines = 1
+			}
+			count++
+			result = append(result, item...)
+		}
+		i = j
+	}
+	return result
+}
@@ -0,0 +1,141 @@
+// Copyright 2021 storyicon@foxmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package protofmt
+
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+type tokenKind int
+
+const (
+	kindIdent tokenKind = iota
+	kindNumber
+	kindString
+	kindComment
+	kindPunct
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	// newlines is the number of line breaks before the token
+	newlines int
+	line     int
+}
+
+func (t *token) isLineComment() bool {
+	return t.kind == kindComment && strings.HasPrefix(t.text, "//")
+}
+
+func isLetter(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\r' || c == '\f' || c == '\v'
+}
+
+// tokenize is used to split the source of proto file into tokens.
+// Qualified names such as foo.bar.Baz and .foo.Bar are treated as one token
+func tokenize(src string) ([]*token, error) {
+	var tokens []*token
+	line, newlines := 1, 0
+	for i := 0; i < len(src); {
+		c := src[i]
+		if c == '\n' {
+			line++
+			newlines++
+			i++
+			continue
+		}
+		if isSpace(c) {
+			i++
+			continue
+		}
+		start, kind := i, kindPunct
+		switch {
+		case strings.HasPrefix(src[i:], "//"):
+			kind = kindComment
+			end := strings.IndexByte(src[i:], '\n')
+			if end < 0 {
+				end = len(src) - i
+			}
+			i += end
+		case strings.HasPrefix(src[i:], "/*"):
+			kind = kindComment
+			end := strings.Index(src[i+2:], "*/")
+			if end < 0 {
+				return nil, errors.Errorf("line %d: unterminated comment", line)
+			}
+			i += end + 4
+		case c == '"' || c == '\'':
+			kind = kindString
+			i++
+			for ; i < len(src) && src[i] != c; i++ {
+				if src[i] == '\\' {
+					i++
+				}
+				if i < len(src) && src[i] == '\n' {
+					break
+				}
+			}
+			if i >= len(src) || src[i] != c {
+				return nil, errors.Errorf("line %d: unterminated string", line)
+			}
+			i++
+		case isLetter(c) || (c == '.' && i+1 < len(src) && isLetter(src[i+1])):
+			kind = kindIdent
+			for i++; i < len(src); i++ {
+				if isLetter(src[i]) || isDigit(src[i]) {
+					continue
+				}
+				if src[i] == '.' && i+1 < len(src) && isLetter(src[i+1]) {
+					continue
+				}
+				break
+			}
+		case isDigit(c) || (c == '.' && i+1 < len(src) && isDigit(src[i+1])):
+			kind = kindNumber
+			for i++; i < len(src); i++ {
+				if isLetter(src[i]) || isDigit(src[i]) || src[i] == '.' {
+					continue
+				}
+				if (src[i] == '+' || src[i] == '-') && (src[i-1] == 'e' || src[i-1] == 'E') {
+					continue
+				}
+				break
+			}
+		default:
+			i++
+		}
+		text := src[start:i]
+		tokens = append(tokens, &token{
+			kind:     kind,
+			text:     text,
+			newlines: newlines,
+			line:     line,
+		})
+		line += strings.Count(text, "\n")
+		newlines = 0
+	}
+	return tokens, nil
+}
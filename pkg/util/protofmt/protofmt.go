@@ -0,0 +1,254 @@
+// Copyright 2021 storyicon@foxmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package protofmt implements a deterministic formatter of proto files.
+//
+// The formatter keeps all comments and the order of declarations. It indents
+// blocks with four spaces, normalizes the spaces between tokens, collapses
+// consecutive blank lines, and sorts the import statements by path.
+// Line breaks inside brackets, such as field options and message literals
+// of options, are kept as the author wrote them.
+package protofmt
+
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const indentation = "    "
+
+// Format is used to format the source of proto file
+func Format(src []byte) ([]byte, error) {
+	tokens, err := tokenize(string(src))
+	if err != nil {
+		return nil, err
+	}
+	p := &printer{}
+	if err := p.print(sortImports(tokens)); err != nil {
+		return nil, err
+	}
+	return []byte(p.String()), nil
+}
+
+type printer struct {
+	lines   []string
+	current string
+	// opened is true when the last line opens a block
+	opened bool
+}
+
+func (p *printer) flush() {
+	if strings.TrimSpace(p.current) != "" {
+		p.lines = append(p.lines, strings.TrimRight(p.current, " "))
+	}
+	p.current = ""
+}
+
+func (p *printer) startLine(indent int) {
+	p.flush()
+	p.current = strings.Repeat(indentation, indent)
+}
+
+func (p *printer) blankLine() {
+	p.flush()
+	if len(p.lines) == 0 || p.opened || p.lines[len(p.lines)-1] == "" {
+		return
+	}
+	p.lines = append(p.lines, "")
+}
+
+func (p *printer) write(text string, space bool) {
+	if space && strings.TrimSpace(p.current) != "" {
+		p.current += " "
+	}
+	p.current += text
+	p.opened = false
+}
+
+// appendTrailing is used to append the comment to the end of the last line
+func (p *printer) appendTrailing(text string) {
+	if strings.TrimSpace(p.current) == "" && len(p.lines) != 0 {
+		p.lines[len(p.lines)-1] += " " + text
+		return
+	}
+	p.write(text, true)
+}
+
+func (p *printer) String() string {
+	p.flush()
+	lines := make([]string, 0, len(p.lines))
+	for _, line := range p.lines {
+		// the continuation lines of block comments
+		for _, item := range strings.Split(line, "\n") {
+			lines = append(lines, strings.TrimRight(item, " \t\r"))
+		}
+	}
+	for len(lines) != 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	if len(lines) == 0 {
+		return ""
+	}
+	return strings.Join(lines, "\n") + "\n"
+}
+
+var closing = map[string]string{
+	"(": ")",
+	"[": "]",
+	"<": ">",
+	"{": "}",
+}
+
+func isClosing(text string) bool {
+	return text == ")" || text == "]" || text == ">" || text == "}"
+}
+
+// statement holds the state of the statement being printed
+type statement struct {
+	first string
+	// brackets are the unclosed brackets in the statement
+	brackets []string
+	previous *token
+	// newline is true when the next token must start a new line
+	newline bool
+}
+
+func (s *statement) isAggregate() bool {
+	if len(s.brackets) != 0 || s.first == "option" {
+		return true
+	}
+	return s.previous != nil && (s.previous.text == "=" || s.previous.text == ":")
+}
+
+func (p *printer) print(tokens []*token) error {
+	depth := 0
+	var stmt *statement
+	for i := 0; i < len(tokens); i++ {
+		tok := tokens[i]
+		if tok.kind == kindComment {
+			switch {
+			case tok.newlines == 0 && i != 0:
+				p.appendTrailing(tok.text)
+				if stmt != nil && tok.isLineComment() {
+					stmt.newline = true
+				}
+			case stmt != nil:
+				p.startLine(depth + maxInt(len(stmt.brackets), 1))
+				p.write(tok.text, false)
+				stmt.newline = true
+			default:
+				if tok.newlines >= 2 {
+					p.blankLine()
+				}
+				p.startLine(depth)
+				p.write(tok.text, false)
+				p.flush()
+			}
+			continue
+		}
+		if stmt == nil {
+			switch tok.text {
+			case ";":
+				// empty statement
+				continue
+			case "}":
+				if depth == 0 {
+					return errors.Errorf("line %d: unexpected '}'", tok.line)
+				}
+				depth--
+				p.startLine(depth)
+				p.write(tok.text, false)
+				p.flush()
+				continue
+			}
+			if tok.newlines >= 2 {
+				p.blankLine()
+			}
+			p.startLine(depth)
+			stmt = &statement{first: tok.text}
+		}
+		if tok.text == "{" && !stmt.isAggregate() {
+			p.write(tok.text, true)
+			if i+1 < len(tokens) && tokens[i+1].text == "}" {
+				p.write("}", false)
+				i++
+			} else {
+				depth++
+				p.opened = true
+			}
+			p.flush()
+			stmt = nil
+			continue
+		}
+		if stmt.newline || (tok.newlines != 0 && len(stmt.brackets) != 0) {
+			indent := depth + maxInt(len(stmt.brackets), 1)
+			if isClosing(tok.text) && len(stmt.brackets) != 0 {
+				indent--
+			}
+			p.startLine(indent)
+			p.write(tok.text, false)
+			stmt.newline = false
+		} else {
+			p.write(tok.text, needSpace(stmt.previous, tok))
+		}
+		stmt.previous = tok
+		switch {
+		case closing[tok.text] != "" && tok.kind == kindPunct:
+			stmt.brackets = append(stmt.brackets, tok.text)
+		case isClosing(tok.text):
+			last := len(stmt.brackets) - 1
+			if last < 0 || closing[stmt.brackets[last]] != tok.text {
+				return errors.Errorf("line %d: unexpected '%s'", tok.line, tok.text)
+			}
+			stmt.brackets = stmt.brackets[:last]
+		case tok.text == ";" && len(stmt.brackets) == 0:
+			p.flush()
+			stmt = nil
+		}
+	}
+	if stmt != nil || depth != 0 {
+		return errors.New("unexpected end of file")
+	}
+	return nil
+}
+
+func needSpace(previous *token, tok *token) bool {
+	if previous == nil {
+		return false
+	}
+	switch tok.text {
+	case ";", ",", ")", "]", ">", "}", ":", "<":
+		return false
+	case "(":
+		if previous.kind == kindIdent {
+			return previous.text == "returns" || previous.text == "option"
+		}
+	}
+	switch previous.text {
+	case "(", "[", "<", "{", "-":
+		return false
+	case ")":
+		// option name like (foo).bar
+		return !strings.HasPrefix(tok.text, ".")
+	}
+	return true
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
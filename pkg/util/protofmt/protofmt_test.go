@@ -0,0 +1,159 @@
+// Copyright 2021 storyicon@foxmail.com
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package protofmt
+
+import (
+	"testing"
+)
+
+func TestFormat(t *testing.T) {
+	tests := []struct {
+		name    string
+		src     string
+		want    string
+		wantErr bool
+	}{
+		{
+			name: "spacing and indentation",
+			src: `syntax="proto3";
+package  greeter ;
+service Greeter{
+rpc SayHello ( HelloRequest )returns( stream HelloReply );
+}
+message HelloRequest{string name=1 [json_name="n",deprecated=true];
+map < string , int32 > labels = 2;
+enum Kind { KIND_UNSPECIFIED=0; }
+message Empty { }
+}
+`,
+			want: `syntax = "proto3";
+package greeter;
+service Greeter {
+    rpc SayHello(HelloRequest) returns (stream HelloReply);
+}
+message HelloRequest {
+    string name = 1 [json_name = "n", deprecated = true];
+    map<string, int32> labels = 2;
+    enum Kind {
+        KIND_UNSPECIFIED = 0;
+    }
+    message Empty {}
+}
+`,
+		},
+		{
+			name: "comments and blank lines",
+			src: `// header
+
+
+syntax = "proto3"; // trailing
+
+message Foo { // brace
+  /* block */
+
+
+  // leading
+  int32 a = 1;
+
+}
+`,
+			want: `// header
+
+syntax = "proto3"; // trailing
+
+message Foo { // brace
+    /* block */
+
+    // leading
+    int32 a = 1;
+}
+`,
+		},
+		{
+			name: "import sorting",
+			src: `syntax = "proto3";
+
+// section
+
+import "b.proto";
+import public "a.proto"; // a
+
+import "c.proto";
+import "b.proto";
+`,
+			want: `syntax = "proto3";
+
+// section
+
+import public "a.proto"; // a
+import "b.proto";
+import "c.proto";
+`,
+		},
+		{
+			name: "options",
+			src: `option (foo).bar = {
+  name: "x"
+  values: [1,2]
+};
+message Foo {
+  int32 a = 1 [
+  (validate.rules).int32.gt = -1,
+  deprecated=true
+  ];
+}
+`,
+			want: `option (foo).bar = {
+    name: "x"
+    values: [1, 2]
+};
+message Foo {
+    int32 a = 1 [
+        (validate.rules).int32.gt = -1,
+        deprecated = true
+    ];
+}
+`,
+		},
+		{
+			name:    "unbalanced braces",
+			src:     "message Foo {",
+			wantErr: true,
+		},
+		{
+			name:    "unterminated string",
+			src:     `syntax = "proto3;`,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Format([]byte(tt.src))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Format() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if string(got) != tt.want {
+				t.Errorf("Format() = \n%v, want \n%v", string(got), tt.want)
+			}
+			again, err := Format(got)
+			if err != nil || string(again) != string(got) {
+				t.Errorf("Format() is not idempotent: \n%v", string(again))
+			}
+		})
+	}
+}
@@ -15,6 +15,7 @@
 package util
 
 import (
+	"fmt"
 	"os"
 	"os/exec"
 	"path/filepath"
@@ -33,11 +34,7 @@ func SortSemanticVersion(items []string) ([]string, []string) {
 	versions := make(semver.Versions, 0, len(items))
 	var malformed []string
 	for _, item := range items {
-		s := item
-		if strings.HasPrefix(s, "v") {
-			s = item[1:]
-		}
-		version, err := semver.NewVersion(s)
+		version, err := parseSemanticVersion(item)
 		if err != nil {
 			malformed = append(malformed, item)
 			continue
@@ -54,6 +51,21 @@ func SortSemanticVersion(items []string) ([]string, []string) {
 	return malformed, data
 }
 
+// parseSemanticVersion is used to parse the version with or without the prefix v
+func parseSemanticVersion(item string) (*semver.Version, error) {
+	s := strings.TrimPrefix(item, "v")
+	// since v21, protobuf is released in two-component versions, e.g. v21.12 and v22.0-rc3
+	s = regexpTwoComponentVersion.ReplaceAllString(s, "$1.0$2")
+	return semver.NewVersion(s)
+}
+
+// IsStableVersion reports whether the version is a semantic version without prerelease,
+// the pseudo-versions of go modules like v0.0.0-20210101000000-abcdefabcdef are prereleases
+func IsStableVersion(version string) bool {
+	v, err := parseSemanticVersion(version)
+	return err == nil && v.PreRelease == ""
+}
+
 // DeduplicateSliceStably is used to deduplicate slice items stably
 func DeduplicateSliceStably(items []string) []string {
 	data := make([]string, 0, len(items))
@@ -118,9 +130,10 @@ func GetExitCode(err error) int {
 var (
 	regexpEnvironmentVar = regexp.MustCompile(`\$[A-Za-z_]+`)
 	regexpRegularVersion = regexp.MustCompile(`^v[0-9]+\.[0-9]+\.[0-9]+$`)
+	// regexpTwoComponentVersion matches the version like 21.12 and 22.0-rc3
+	regexpTwoComponentVersion = regexp.MustCompile(`^([0-9]+\.[0-9]+)(-.*)?$`)
 )
 
-
 // IsRegularVersion is used to determine whether the version number is a regular version number
 // Regular: va.b.c, and a, b, c are all numbers
 func IsRegularVersion(s string) bool {
@@ -174,3 +187,17 @@ func GetBinaryFileName(name string) string {
 	}
 	return name
 }
+
+// FormatSize is used to format the size in bytes to a human readable string, e.g. 1.5MB
+func FormatSize(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%dB", size)
+	}
+	div, exp := int64(unit), 0
+	for n := size / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f%cB", float64(size)/float64(div), "KMGTPE"[exp])
+}
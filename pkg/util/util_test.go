@@ -107,6 +107,12 @@ func TestSortSemanticVersion(t *testing.T) {
 			want:  []string{"conformance-build-tag"},
 			want1: []string{"v2.4.1", "v3.0.0-alpha-2", "v3.0.0-beta-3.1", "3.15.0-rc1"},
 		},
+		{
+			args: args{
+				items: []string{"v21.12", "v3.20.3", "v22.0", "v22.0-rc3", "v3.21.0-rc1", "v21.0-rc1"},
+			},
+			want1: []string{"v3.20.3", "v3.21.0-rc1", "v21.0-rc1", "v21.12", "v22.0-rc3", "v22.0"},
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -166,4 +172,47 @@ func TestIsRegularVersion(t *testing.T) {
 			}
 		})
 	}
-}
\ No newline at end of file
+}
+
+func TestIsStableVersion(t *testing.T) {
+	tests := []struct {
+		version string
+		want    bool
+	}{
+		{version: "v1.27.1", want: true},
+		{version: "21.12", want: true},
+		{version: "v2.0.0+incompatible", want: true},
+		{version: "v1.28.0-rc.1", want: false},
+		{version: "v22.0-rc3", want: false},
+		{version: "v0.0.0-20210101000000-abcdefabcdef", want: false},
+		{version: "latest", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.version, func(t *testing.T) {
+			if got := IsStableVersion(tt.version); got != tt.want {
+				t.Errorf("IsStableVersion() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFormatSize(t *testing.T) {
+	tests := []struct {
+		size int64
+		want string
+	}{
+		{size: 0, want: "0B"},
+		{size: 1023, want: "1023B"},
+		{size: 1024, want: "1.0KB"},
+		{size: 1536, want: "1.5KB"},
+		{size: 5 * 1024 * 1024, want: "5.0MB"},
+		{size: 3 * 1024 * 1024 * 1024, want: "3.0GB"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			if got := FormatSize(tt.size); got != tt.want {
+				t.Errorf("FormatSize() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}